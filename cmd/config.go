@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/logging"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/ratelimit"
+	"github.com/pmokeev/chartographer/internal/routers"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"image/color"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultConfigFile = "configs/config.yml"
+
+type config struct {
+	Storage           string
+	Port              int
+	MaxUploadBytes    int64
+	UploadTTL         time.Duration
+	Workers           int
+	MaxConcurrentJobs int
+	CacheMaxBytes     int64
+	FlushInterval     time.Duration
+	MaxDirtyBytes     int64
+	VerifyOnRead      bool
+	MaxWidth          int
+	MaxHeight         int
+	MaxPartWidth      int
+	MaxPartHeight     int
+	MaxRegions        int
+	MaxImages         int
+	MaxProjects       int
+	FillColor         string
+	IntegerIDs        bool
+	RateLimit         float64
+	RateLimitBurst    int
+	MaxInFlight       int
+	TrustedProxies    []string
+	AuditMaxBytes     int64
+	AuditMaxFiles     int
+	LogLevel          string
+	LogFormat         string
+	Quotas            quotasConfig
+	Auth              authConfig
+}
+
+// quotasConfig is the quotas section of the config file. Tenant names are
+// case-insensitive there, as all config keys.
+type quotasConfig struct {
+	Default quotaConfig            `mapstructure:"default"`
+	Tenants map[string]quotaConfig `mapstructure:"tenants"`
+}
+
+// authConfig is the auth section of the config file. Authentication is off
+// unless it names credentials.
+type authConfig struct {
+	APIKeys []apiKeyConfig `mapstructure:"api_keys"`
+	JWT     jwtConfig      `mapstructure:"jwt"`
+}
+
+type apiKeyConfig struct {
+	Key    string   `mapstructure:"key"`
+	Name   string   `mapstructure:"name"`
+	Tenant string   `mapstructure:"tenant"`
+	Roles  []string `mapstructure:"roles"`
+}
+
+// jwtConfig names the files holding the keys that sign accepted tokens
+// and the claims of the principal.
+type jwtConfig struct {
+	JWKSFile    string   `mapstructure:"jwks_file"`
+	PublicKeys  []string `mapstructure:"public_keys"`
+	Issuer      string   `mapstructure:"issuer"`
+	Audience    string   `mapstructure:"audience"`
+	NameClaim   string   `mapstructure:"name_claim"`
+	TenantClaim string   `mapstructure:"tenant_claim"`
+	RolesClaim  string   `mapstructure:"roles_claim"`
+}
+
+func (jwt jwtConfig) enabled() bool {
+	return jwt.JWKSFile != "" || len(jwt.PublicKeys) != 0
+}
+
+type quotaConfig struct {
+	MaxImages int64 `mapstructure:"max_images"`
+	MaxPixels int64 `mapstructure:"max_pixels"`
+	MaxBytes  int64 `mapstructure:"max_bytes"`
+}
+
+// newFlagSet returns the flags shared by all commands. Every flag sets the
+// config key with dashes replaced by underscores.
+func newFlagSet(command string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(command, pflag.ContinueOnError)
+	flags.String("config", defaultConfigFile, "path to the config file")
+	flags.String("storage", "", "folder where images are stored")
+	flags.Int("port", 8000, "port to listen on")
+	flags.Int64("max-upload-bytes", 0, "maximum size of a fragment upload in bytes, 0 disables the limit")
+	flags.Duration("upload-ttl", services.DefaultOptions().Uploads.TTL, "how long a resumable upload is kept without a chunk written, 0 keeps it until restart")
+	flags.Int("workers", 0, "goroutines processing pixels, 0 means GOMAXPROCS")
+	flags.Int("max-concurrent-jobs", 0, "image operations processed at once, 0 means the number of workers")
+	flags.Int64("cache-max-bytes", 0, "memory budget for decoded images in bytes, 0 disables the cache")
+	flags.Duration("flush-interval", 0, "how often buffered updates are written to the image files")
+	flags.Int64("max-dirty-bytes", 0, "buffered updates in bytes after which they are written right away")
+	flags.Bool("verify-on-read", false, "check image files against their checksums when they are read")
+	defaultOptions := services.DefaultOptions()
+	flags.Int("max-width", defaultOptions.Limits.MaxWidth, "maximum width of a new image, 0 means no limit")
+	flags.Int("max-height", defaultOptions.Limits.MaxHeight, "maximum height of a new image, 0 means no limit")
+	flags.Int("max-part-width", defaultOptions.Limits.MaxPartWidth, "maximum width of a requested part, 0 means no limit")
+	flags.Int("max-part-height", defaultOptions.Limits.MaxPartHeight, "maximum height of a requested part, 0 means no limit")
+	flags.Int("max-regions", defaultOptions.Limits.MaxRegions, "maximum number of regions read by one request, 0 means no limit")
+	flags.Int("max-images", 0, "maximum number of stored images, 0 means no limit")
+	flags.Int("max-projects", defaultOptions.Limits.MaxProjects, "maximum number of projects, 0 means no limit")
+	flags.String("fill-color", "#000000", "colour of new images as #RRGGBB or #RRGGBBAA")
+	flags.Bool("integer-ids", false, "give new images sequential integer ids instead of UUIDs")
+	flags.Float64("rate-limit", 0, "requests per second of a client on average, 0 disables the limit")
+	flags.Int("rate-limit-burst", 0, "requests a client may make at once, 0 means the rate limit")
+	flags.Int("max-in-flight", 0, "image operations of a client processed at once, 0 means no limit")
+	flags.StringSlice("trusted-proxies", nil, "addresses or CIDRs of proxies whose X-Forwarded-For header gives the client IP")
+	flags.Int64("audit-max-bytes", 64<<20, "size in bytes after which the audit trail is rotated, 0 disables rotation")
+	flags.Int("audit-max-files", 0, "rotated audit trail files kept, older ones are removed, 0 keeps all")
+	flags.String("log-level", "info", "lowest level of logged lines: debug, info, warn or error")
+	flags.String("log-format", logging.FormatJSON, "format of logged lines: json or console")
+
+	return flags
+}
+
+// loadConfig merges the parsed flags, CHARTOGRAPHER_* environment variables
+// and the config file, in this order of precedence, over the flag defaults
+// and validates the result.
+func loadConfig(flags *pflag.FlagSet) (*config, error) {
+	settings := viper.New()
+	var bindErr error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "config" {
+			if err := settings.BindPFlag(strings.ReplaceAll(flag.Name, "-", "_"), flag); err != nil {
+				bindErr = err
+			}
+		}
+	})
+	if bindErr != nil {
+		return nil, bindErr
+	}
+	settings.SetEnvPrefix("CHARTOGRAPHER")
+	settings.AutomaticEnv()
+
+	configFile, _ := flags.GetString("config")
+	if envConfigFile, ok := os.LookupEnv("CHARTOGRAPHER_CONFIG"); ok && !flags.Changed("config") {
+		configFile = envConfigFile
+	}
+	settings.SetConfigFile(configFile)
+	if err := settings.ReadInConfig(); err != nil {
+		var pathError *os.PathError
+		if !errors.As(err, &pathError) || configFile != defaultConfigFile {
+			return nil, fmt.Errorf("error while reading config %s: %w", configFile, err)
+		}
+	}
+
+	currentConfig := &config{
+		Storage:           settings.GetString("storage"),
+		Port:              settings.GetInt("port"),
+		MaxUploadBytes:    settings.GetInt64("max_upload_bytes"),
+		UploadTTL:         settings.GetDuration("upload_ttl"),
+		Workers:           settings.GetInt("workers"),
+		MaxConcurrentJobs: settings.GetInt("max_concurrent_jobs"),
+		CacheMaxBytes:     settings.GetInt64("cache_max_bytes"),
+		FlushInterval:     settings.GetDuration("flush_interval"),
+		MaxDirtyBytes:     settings.GetInt64("max_dirty_bytes"),
+		VerifyOnRead:      settings.GetBool("verify_on_read"),
+		MaxWidth:          settings.GetInt("max_width"),
+		MaxHeight:         settings.GetInt("max_height"),
+		MaxPartWidth:      settings.GetInt("max_part_width"),
+		MaxPartHeight:     settings.GetInt("max_part_height"),
+		MaxRegions:        settings.GetInt("max_regions"),
+		MaxImages:         settings.GetInt("max_images"),
+		MaxProjects:       settings.GetInt("max_projects"),
+		FillColor:         settings.GetString("fill_color"),
+		IntegerIDs:        settings.GetBool("integer_ids"),
+		RateLimit:         settings.GetFloat64("rate_limit"),
+		RateLimitBurst:    settings.GetInt("rate_limit_burst"),
+		MaxInFlight:       settings.GetInt("max_in_flight"),
+		TrustedProxies:    settings.GetStringSlice("trusted_proxies"),
+		AuditMaxBytes:     settings.GetInt64("audit_max_bytes"),
+		AuditMaxFiles:     settings.GetInt("audit_max_files"),
+		LogLevel:          settings.GetString("log_level"),
+		LogFormat:         settings.GetString("log_format")}
+	if err := settings.UnmarshalKey("quotas", &currentConfig.Quotas); err != nil {
+		return nil, fmt.Errorf("error while reading quotas: %w", err)
+	}
+	if err := settings.UnmarshalKey("auth", &currentConfig.Auth); err != nil {
+		return nil, fmt.Errorf("error while reading auth: %w", err)
+	}
+
+	return currentConfig, currentConfig.validate()
+}
+
+func (currentConfig *config) validate() error {
+	if currentConfig.Storage == "" {
+		return errors.New("storage folder is not set")
+	}
+	info, err := os.Stat(currentConfig.Storage)
+	if err != nil {
+		return fmt.Errorf("storage folder %s: %w", currentConfig.Storage, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage folder %s is not a directory", currentConfig.Storage)
+	}
+	if currentConfig.Port <= 0 || currentConfig.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", currentConfig.Port)
+	}
+	for name, value := range map[string]int64{
+		"max_upload_bytes":    currentConfig.MaxUploadBytes,
+		"upload_ttl":          int64(currentConfig.UploadTTL),
+		"workers":             int64(currentConfig.Workers),
+		"max_concurrent_jobs": int64(currentConfig.MaxConcurrentJobs),
+		"cache_max_bytes":     currentConfig.CacheMaxBytes,
+		"flush_interval":      int64(currentConfig.FlushInterval),
+		"max_dirty_bytes":     currentConfig.MaxDirtyBytes,
+		"max_width":           int64(currentConfig.MaxWidth),
+		"max_height":          int64(currentConfig.MaxHeight),
+		"max_part_width":      int64(currentConfig.MaxPartWidth),
+		"max_part_height":     int64(currentConfig.MaxPartHeight),
+		"max_regions":         int64(currentConfig.MaxRegions),
+		"max_images":          int64(currentConfig.MaxImages),
+		"max_projects":        int64(currentConfig.MaxProjects),
+		"rate_limit_burst":    int64(currentConfig.RateLimitBurst),
+		"max_in_flight":       int64(currentConfig.MaxInFlight),
+		"audit_max_bytes":     currentConfig.AuditMaxBytes,
+		"audit_max_files":     int64(currentConfig.AuditMaxFiles),
+	} {
+		if value < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if currentConfig.RateLimit < 0 {
+		return errors.New("rate_limit must not be negative")
+	}
+	if _, err := parseColor(currentConfig.FillColor); err != nil {
+		return err
+	}
+	for _, proxy := range currentConfig.TrustedProxies {
+		if !isIPOrCIDR(proxy) {
+			return fmt.Errorf("trusted proxy %s is neither an IP address nor a CIDR", proxy)
+		}
+	}
+	if _, err := logging.New(currentConfig.LogLevel, currentConfig.LogFormat); err != nil {
+		return err
+	}
+	if err := currentConfig.Quotas.Default.validate("quotas.default"); err != nil {
+		return err
+	}
+	for tenant, quota := range currentConfig.Quotas.Tenants {
+		if err := quota.validate("quotas.tenants." + tenant); err != nil {
+			return err
+		}
+	}
+	if err := currentConfig.Auth.validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// options returns the policy of the chart service. The config has to be
+// valid.
+func (currentConfig *config) options() services.Options {
+	fillColor, _ := parseColor(currentConfig.FillColor)
+
+	return services.Options{
+		Limits: services.Limits{
+			MaxWidth:      currentConfig.MaxWidth,
+			MaxHeight:     currentConfig.MaxHeight,
+			MaxPartWidth:  currentConfig.MaxPartWidth,
+			MaxPartHeight: currentConfig.MaxPartHeight,
+			MaxRegions:    currentConfig.MaxRegions,
+			MaxImages:     currentConfig.MaxImages,
+			MaxProjects:   currentConfig.MaxProjects},
+		FillColor: fillColor,
+		WriteBack: services.WriteBackOptions{
+			FlushInterval: currentConfig.FlushInterval,
+			MaxDirtyBytes: currentConfig.MaxDirtyBytes},
+		Uploads: services.UploadOptions{
+			MaxBytes: currentConfig.MaxUploadBytes,
+			TTL:      currentConfig.UploadTTL},
+		VerifyOnRead: currentConfig.VerifyOnRead,
+		Quotas:       currentConfig.Quotas.options(),
+		IntegerIDs:   currentConfig.IntegerIDs}
+}
+
+// routerOptions returns the middlewares settings of the router. It reads
+// the keys of JSON Web Tokens, so it fails if their files are unreadable.
+func (currentConfig *config) routerOptions() (routers.Options, error) {
+	options := routers.Options{
+		MaxUploadBytes: currentConfig.MaxUploadBytes,
+		TrustedProxies: currentConfig.TrustedProxies,
+		RateLimit: ratelimit.Options{
+			Rate:        currentConfig.RateLimit,
+			Burst:       currentConfig.RateLimitBurst,
+			MaxInFlight: currentConfig.MaxInFlight}}
+	var authenticators auth.Authenticators
+	if len(currentConfig.Auth.APIKeys) != 0 {
+		authenticators = append(authenticators, currentConfig.Auth.apiKeys())
+	}
+	if currentConfig.Auth.JWT.enabled() {
+		jwtAuthenticator, err := currentConfig.Auth.JWT.authenticator()
+		if err != nil {
+			return options, err
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+	switch len(authenticators) {
+	case 0:
+	case 1:
+		options.Authenticator = authenticators[0]
+	default:
+		options.Authenticator = authenticators
+	}
+
+	return options, nil
+}
+
+func isIPOrCIDR(address string) bool {
+	if _, _, err := net.ParseCIDR(address); err == nil {
+		return true
+	}
+
+	return net.ParseIP(address) != nil
+}
+
+func (authentication authConfig) validate() error {
+	jwt := authentication.JWT
+	if !jwt.enabled() && (jwt.Issuer != "" || jwt.Audience != "" || jwt.NameClaim != "" || jwt.TenantClaim != "" || jwt.RolesClaim != "") {
+		return errors.New("auth.jwt needs jwks_file or public_keys")
+	}
+	keys := make(map[string]bool, len(authentication.APIKeys))
+	for ind, apiKey := range authentication.APIKeys {
+		if apiKey.Key == "" || apiKey.Name == "" {
+			return fmt.Errorf("auth.api_keys[%d] needs a key and a name", ind)
+		}
+		if keys[apiKey.Key] {
+			return fmt.Errorf("auth.api_keys[%d] repeats a key", ind)
+		}
+		if apiKey.Tenant != "" && !auth.IsValidTenant(apiKey.Tenant) {
+			return fmt.Errorf("auth.api_keys[%d] tenant %s is not a valid tenant name", ind, apiKey.Tenant)
+		}
+		keys[apiKey.Key] = true
+	}
+
+	return nil
+}
+
+func (jwt jwtConfig) authenticator() (*auth.JWTAuthenticator, error) {
+	var keys []auth.PublicKey
+	if jwt.JWKSFile != "" {
+		jwksKeys, err := auth.ReadJWKS(jwt.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading auth.jwt.jwks_file: %w", err)
+		}
+		keys = append(keys, jwksKeys...)
+	}
+	for _, path := range jwt.PublicKeys {
+		pemKeys, err := auth.ReadPEMPublicKeys(path)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading auth.jwt.public_keys: %w", err)
+		}
+		keys = append(keys, pemKeys...)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("auth.jwt names no signing keys")
+	}
+
+	return auth.NewJWTAuthenticator(keys, auth.JWTOptions{
+		Issuer:      jwt.Issuer,
+		Audience:    jwt.Audience,
+		NameClaim:   jwt.NameClaim,
+		TenantClaim: jwt.TenantClaim,
+		RolesClaim:  jwt.RolesClaim}), nil
+}
+
+func (authentication authConfig) apiKeys() *auth.APIKeys {
+	principals := make(map[string]auth.Principal, len(authentication.APIKeys))
+	for _, apiKey := range authentication.APIKeys {
+		principals[apiKey.Key] = auth.Principal{Name: apiKey.Name, Tenant: apiKey.Tenant, Roles: apiKey.Roles}
+	}
+
+	return auth.NewAPIKeys(principals)
+}
+
+func (quotas quotasConfig) options() services.QuotaOptions {
+	options := services.QuotaOptions{Default: quotas.Default.quota()}
+	for tenant, quota := range quotas.Tenants {
+		if options.Tenants == nil {
+			options.Tenants = make(map[string]models.Quota, len(quotas.Tenants))
+		}
+		options.Tenants[tenant] = quota.quota()
+	}
+
+	return options
+}
+
+func (quota quotaConfig) validate(name string) error {
+	if quota.MaxImages < 0 || quota.MaxPixels < 0 || quota.MaxBytes < 0 {
+		return fmt.Errorf("%s must not be negative", name)
+	}
+
+	return nil
+}
+
+func (quota quotaConfig) quota() models.Quota {
+	return models.Quota{MaxImages: quota.MaxImages, MaxPixels: quota.MaxPixels, MaxBytes: quota.MaxBytes}
+}
+
+// parseColor parses a #RRGGBB or #RRGGBBAA colour.
+func parseColor(value string) (color.RGBA, error) {
+	components, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+	if err != nil || !strings.HasPrefix(value, "#") || (len(components) != 3 && len(components) != 4) {
+		return color.RGBA{}, fmt.Errorf("colour %s is not #RRGGBB or #RRGGBBAA", value)
+	}
+	nonPremultiplied := color.NRGBA{R: components[0], G: components[1], B: components[2], A: 0xFF}
+	if len(components) == 4 {
+		nonPremultiplied.A = components[3]
+	}
+
+	return color.RGBAModel.Convert(nonPremultiplied).(color.RGBA), nil
+}
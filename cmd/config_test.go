@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/ratelimit"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/pmokeev/chartographer/internal/utils"
+	"github.com/pmokeev/chartographer/internal/workers"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0777))
+	return path
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	storage := t.TempDir()
+	configFile := writeConfigFile(t, "port: 8001\nworkers: 3\nmax_concurrent_jobs: 5\nflush_interval: 5s\nstorage: "+storage+"\n")
+	t.Setenv("CHARTOGRAPHER_WORKERS", "4")
+	t.Setenv("CHARTOGRAPHER_MAX_CONCURRENT_JOBS", "6")
+
+	flags := newFlagSet("serve")
+	assert.NoError(t, flags.Parse([]string{"--config", configFile, "--max-concurrent-jobs", "7"}))
+	currentConfig, err := loadConfig(flags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, &config{
+		Storage:           storage,
+		Port:              8001,
+		Workers:           4,
+		MaxConcurrentJobs: 7,
+		UploadTTL:         24 * time.Hour,
+		FlushInterval:     5 * time.Second,
+		MaxWidth:          20000,
+		MaxHeight:         50000,
+		MaxPartWidth:      5000,
+		MaxPartHeight:     5000,
+		MaxRegions:        100,
+		MaxProjects:       100,
+		FillColor:         "#000000",
+		TrustedProxies:    []string{},
+		AuditMaxBytes:     64 << 20,
+		LogLevel:          "info",
+		LogFormat:         "json",
+	}, currentConfig)
+}
+
+func TestLoadConfig_ConfigFromEnv(t *testing.T) {
+	storage := t.TempDir()
+	t.Setenv("CHARTOGRAPHER_CONFIG", writeConfigFile(t, "cache_max_bytes: 1024\n"))
+	t.Setenv("CHARTOGRAPHER_STORAGE", storage)
+
+	currentConfig, err := loadConfig(newFlagSet("serve"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), currentConfig.CacheMaxBytes)
+	assert.Equal(t, storage, currentConfig.Storage)
+	assert.Equal(t, 8000, currentConfig.Port)
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	storage := t.TempDir()
+	storageFile := filepath.Join(storage, "file")
+	assert.NoError(t, ioutil.WriteFile(storageFile, nil, 0777))
+
+	tests := []struct {
+		testName string
+		args     []string
+	}{
+		{
+			testName: "Without storage",
+			args:     []string{},
+		},
+		{
+			testName: "Missing storage",
+			args:     []string{"--storage", filepath.Join(storage, "missing")},
+		},
+		{
+			testName: "Storage is a file",
+			args:     []string{"--storage", storageFile},
+		},
+		{
+			testName: "Port out of range",
+			args:     []string{"--storage", storage, "--port", "70000"},
+		},
+		{
+			testName: "Negative workers",
+			args:     []string{"--storage", storage, "--workers", "-1"},
+		},
+		{
+			testName: "Negative upload TTL",
+			args:     []string{"--storage", storage, "--upload-ttl", "-1h"},
+		},
+		{
+			testName: "Negative flush interval",
+			args:     []string{"--storage", storage, "--flush-interval", "-1s"},
+		},
+		{
+			testName: "Negative max images",
+			args:     []string{"--storage", storage, "--max-images", "-1"},
+		},
+		{
+			testName: "Negative rate limit",
+			args:     []string{"--storage", storage, "--rate-limit", "-0.5"},
+		},
+		{
+			testName: "Invalid fill color",
+			args:     []string{"--storage", storage, "--fill-color", "black"},
+		},
+		{
+			testName: "Invalid trusted proxy",
+			args:     []string{"--storage", storage, "--trusted-proxies", "10.0.0.0/8,proxy.local"},
+		},
+		{
+			testName: "Unknown log level",
+			args:     []string{"--storage", storage, "--log-level", "verbose"},
+		},
+		{
+			testName: "Unknown log format",
+			args:     []string{"--storage", storage, "--log-format", "xml"},
+		},
+		{
+			testName: "Negative quota",
+			args:     []string{"--storage", storage, "--config", writeConfigFile(t, "quotas:\n  tenants:\n    lab:\n      max_bytes: -1\n")},
+		},
+		{
+			testName: "API key without name",
+			args:     []string{"--storage", storage, "--config", writeConfigFile(t, "auth:\n  api_keys:\n    - key: secret\n")},
+		},
+		{
+			testName: "Repeated API key",
+			args:     []string{"--storage", storage, "--config", writeConfigFile(t, "auth:\n  api_keys:\n    - key: secret\n      name: alice\n    - key: secret\n      name: bob\n")},
+		},
+		{
+			testName: "Missing config file",
+			args:     []string{"--storage", storage, "--config", filepath.Join(storage, "missing.yml")},
+		},
+		{
+			testName: "Malformed config file",
+			args:     []string{"--storage", storage, "--config", writeConfigFile(t, "port: [")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			flags := newFlagSet("serve")
+			assert.NoError(t, flags.Parse(test.args))
+			_, err := loadConfig(flags)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRun_ImportExport(t *testing.T) {
+	storage := t.TempDir()
+	output := filepath.Join(t.TempDir(), "out.bmp")
+	input := "../internal/utils/testData/common/testImage.bmp"
+
+	assert.NoError(t, run([]string{"import", "--storage", storage, "--integer-ids", input}))
+	_, err := os.Stat(filepath.Join(storage, "0.bmp"))
+	assert.NoError(t, err)
+	trail, err := ioutil.ReadFile(filepath.Join(storage, "audit.jsonl"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(trail), `"action":"create"`)
+	assert.Contains(t, string(trail), `"action":"update"`)
+
+	assert.NoError(t, run([]string{"export", "--storage", storage, "0", output}))
+	assert.NoError(t, run([]string{"fsck", "--storage", storage}))
+	assert.Error(t, run([]string{"export", "--storage", storage, "1", output}))
+	assert.Error(t, run([]string{"unknown-command-" + storage}))
+	assert.Error(t, run([]string{"--unknown"}))
+}
+
+func TestRun_ExportProject(t *testing.T) {
+	storage := t.TempDir()
+	output := filepath.Join(t.TempDir(), "out.bmp")
+	service := services.NewService(storage, workers.NewPool(0, 0), cache.NewCanvasCache(0), services.DefaultOptions())
+	assert.NoError(t, service.CreateProject(context.Background(), "dig-a"))
+	id, err := service.CreateBMP(services.WithProject(context.Background(), "dig-a"), 3, 2)
+	assert.NoError(t, err)
+	service.Close()
+
+	assert.NoError(t, run([]string{"export", "--storage", storage, "dig-a", id, output}))
+	exportedFile, err := os.Open(output)
+	assert.NoError(t, err)
+	defer exportedFile.Close()
+	exportedImage, err := bmp.Decode(exportedFile)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 3, 2), exportedImage.Bounds())
+
+	assert.Error(t, run([]string{"export", "--storage", storage, id, output}))
+	assert.Error(t, run([]string{"export", "--storage", storage, "dig-b", id, output}))
+	assert.Error(t, run([]string{"export", "--storage", storage, "../dig-a", id, output}))
+}
+
+func TestRun_ReadOnly(t *testing.T) {
+	storage := t.TempDir()
+	output := filepath.Join(t.TempDir(), "out.bmp")
+	assert.NoError(t, run([]string{"import", "--storage", storage, "--integer-ids", "../internal/utils/testData/common/testImage.bmp"}))
+	stray := filepath.Join(storage, "0.bmp.123.tmp")
+	assert.NoError(t, ioutil.WriteFile(stray, nil, 0666))
+	trail, err := ioutil.ReadFile(filepath.Join(storage, "audit.jsonl"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, run([]string{"export", "--storage", storage, "0", output}))
+	assert.NoError(t, run([]string{"fsck", "--storage", storage}))
+	_, err = os.Stat(stray)
+	assert.NoError(t, err)
+	actualTrail, err := ioutil.ReadFile(filepath.Join(storage, "audit.jsonl"))
+	assert.NoError(t, err)
+	assert.Equal(t, trail, actualTrail)
+
+	assert.NoError(t, run([]string{"import", "--storage", storage, "--integer-ids", "../internal/utils/testData/common/testImage.bmp"}))
+	_, err = os.Stat(stray)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRun_Locked(t *testing.T) {
+	storage := t.TempDir()
+	lock, err := utils.LockFolder(storage)
+	assert.NoError(t, err)
+	defer lock.Close()
+
+	assert.ErrorIs(t, run([]string{"fsck", "--storage", storage}), utils.ErrLocked)
+	assert.ErrorIs(t, run([]string{"import", "--storage", storage, "../internal/utils/testData/common/testImage.bmp"}), utils.ErrLocked)
+}
+
+func TestRun_ServeListenFails(t *testing.T) {
+	storage := t.TempDir()
+	listener, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	assert.Error(t, run([]string{"serve", "--storage", storage, "--port", strconv.Itoa(port)}))
+	assert.NoError(t, run([]string{"fsck", "--storage", storage}))
+}
+
+func TestConfig_Options(t *testing.T) {
+	storage := t.TempDir()
+	flags := newFlagSet("serve")
+	assert.NoError(t, flags.Parse([]string{"--storage", storage, "--max-width", "100", "--max-part-height", "0", "--max-images", "3", "--fill-color", "#FF000080", "--verify-on-read", "--integer-ids"}))
+	currentConfig, err := loadConfig(flags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, services.Options{
+		Limits:       services.Limits{MaxWidth: 100, MaxHeight: 50000, MaxPartWidth: 5000, MaxRegions: 100, MaxImages: 3, MaxProjects: 100},
+		FillColor:    color.RGBA{R: 0x80, A: 0x80},
+		Uploads:      services.UploadOptions{TTL: 24 * time.Hour},
+		VerifyOnRead: true,
+		IntegerIDs:   true,
+	}, currentConfig.options())
+}
+
+func TestConfig_Quotas(t *testing.T) {
+	storage := t.TempDir()
+	configFile := writeConfigFile(t, "quotas:\n  default:\n    max_images: 10\n  tenants:\n    lab:\n      max_pixels: 1000000\n      max_bytes: 4000054\n")
+	flags := newFlagSet("serve")
+	assert.NoError(t, flags.Parse([]string{"--storage", storage, "--config", configFile}))
+	currentConfig, err := loadConfig(flags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, services.QuotaOptions{
+		Default: models.Quota{MaxImages: 10},
+		Tenants: map[string]models.Quota{"lab": {MaxPixels: 1000000, MaxBytes: 4000054}},
+	}, currentConfig.options().Quotas)
+}
+
+func TestConfig_RouterOptions(t *testing.T) {
+	storage := t.TempDir()
+	flags := newFlagSet("serve")
+	assert.NoError(t, flags.Parse([]string{"--storage", storage, "--max-upload-bytes", "10", "--rate-limit", "2.5", "--max-in-flight", "3", "--trusted-proxies", "10.0.0.0/8,192.168.1.1"}))
+	currentConfig, err := loadConfig(flags)
+	assert.NoError(t, err)
+	options, err := currentConfig.routerOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), options.MaxUploadBytes)
+	assert.Equal(t, ratelimit.Options{Rate: 2.5, MaxInFlight: 3}, options.RateLimit)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.1"}, options.TrustedProxies)
+	assert.Nil(t, options.Authenticator)
+
+	configFile := writeConfigFile(t, "auth:\n  api_keys:\n    - key: secret\n      name: alice\n      tenant: lab\n      roles: [admin]\n")
+	flags = newFlagSet("serve")
+	assert.NoError(t, flags.Parse([]string{"--storage", storage, "--config", configFile}))
+	currentConfig, err = loadConfig(flags)
+	assert.NoError(t, err)
+	options, err = currentConfig.routerOptions()
+	assert.NoError(t, err)
+
+	principal, err := options.Authenticator.Authenticate("secret")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Principal{Name: "alice", Tenant: "lab", Roles: []string{auth.RoleAdmin}}, principal)
+}
+
+func TestConfig_RouterOptions_JWT(t *testing.T) {
+	storage := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	assert.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644))
+
+	configFile := writeConfigFile(t, "auth:\n  api_keys:\n    - key: secret\n      name: alice\n  jwt:\n    public_keys: ["+keyFile+"]\n    audience: chartographer\n")
+	flags := newFlagSet("serve")
+	assert.NoError(t, flags.Parse([]string{"--storage", storage, "--config", configFile}))
+	currentConfig, err := loadConfig(flags)
+	assert.NoError(t, err)
+	options, err := currentConfig.routerOptions()
+	assert.NoError(t, err)
+	assert.Len(t, options.Authenticator, 2)
+
+	currentConfig.Auth.JWT.PublicKeys = []string{filepath.Join(storage, "missing.pem")}
+	_, err = currentConfig.routerOptions()
+	assert.Error(t, err)
+
+	configFile = writeConfigFile(t, "auth:\n  jwt:\n    issuer: https://id.example.org\n")
+	flags = newFlagSet("serve")
+	assert.NoError(t, flags.Parse([]string{"--storage", storage, "--config", configFile}))
+	_, err = loadConfig(flags)
+	assert.Error(t, err)
+}
+
+func TestParseColor(t *testing.T) {
+	fillColor, err := parseColor("#102030")
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF}, fillColor)
+
+	for _, value := range []string{"", "102030", "#10203", "#1020304050", "#GG0000"} {
+		_, err := parseColor(value)
+		assert.Error(t, err, value)
+	}
+}
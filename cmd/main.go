@@ -2,54 +2,329 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	server "github.com/pmokeev/chartographer/internal"
+	"github.com/pmokeev/chartographer/internal/audit"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/logging"
+	"github.com/pmokeev/chartographer/internal/metrics"
 	"github.com/pmokeev/chartographer/internal/routers"
 	"github.com/pmokeev/chartographer/internal/services"
-	"github.com/spf13/viper"
-	"log"
+	"github.com/pmokeev/chartographer/internal/utils"
+	"github.com/pmokeev/chartographer/internal/workers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"golang.org/x/image/bmp"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
-func initConfigFile() error {
-	viper.AddConfigPath("configs")
-	viper.SetConfigName("config")
-	return viper.ReadInConfig()
-}
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+const usage = `Usage: chartographer <command> [flags] [arguments]
+
+Commands:
+  serve [storage]                     run the HTTP API
+  import <file.bmp>...                store BMP files as new images and print their ids
+  export [project] <id> <file.bmp>    write an image into a BMP file
+  fsck                                verify the storage folder without changing it
+  version                             print the version
+
+Settings are taken from flags, then CHARTOGRAPHER_* environment variables,
+e.g. CHARTOGRAPHER_MAX_UPLOAD_BYTES, then the config file. Run
+"chartographer <command> --help" to list the flags.
+`
 
 func main() {
-	if err := initConfigFile(); err != nil {
-		log.Fatalf("Error while init config %s", err.Error())
+	err := run(os.Args[1:])
+	zap.L().Sync()
+	if err != nil && !errors.Is(err, pflag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "chartographer: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("no command given")
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		return serve(args)
+	case "import":
+		return importImages(args)
+	case "export":
+		return exportImage(args)
+	case "fsck":
+		return fsck(args)
+	case "version":
+		fmt.Println(version)
+		return nil
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		// Before subcommands the storage folder was the only argument.
+		if !strings.HasPrefix(command, "-") {
+			return serve(append([]string{command}, args...))
+		}
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %s", command)
+	}
+}
+
+// parseCommand parses the flags of the command, loads the config and sets
+// up the global logger. A single argument named storage is taken as the
+// storage folder.
+func parseCommand(command string, args []string, argsUsage string, storageArgument bool) (*config, []string, error) {
+	flags := newFlagSet(command)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: chartographer %s [flags] %s\n\nFlags:\n%s", command, argsUsage, flags.FlagUsages())
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	args = flags.Args()
+	if storageArgument && len(args) == 1 {
+		if err := flags.Set("storage", args[0]); err != nil {
+			return nil, nil, err
+		}
+		args = nil
 	}
 
-	service := services.NewService(os.Args[1])
-	chartRouter := routers.NewChartRouter(service)
+	currentConfig, err := loadConfig(flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger, err := logging.New(currentConfig.LogLevel, currentConfig.LogFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+	zap.ReplaceGlobals(logger)
+
+	return currentConfig, args, nil
+}
+
+// openService locks the storage folder, starts the service on it and
+// restores the images stored by previous runs. Changes are written to the
+// audit trail in the storage folder. A read-only service leaves the storage
+// folder as it is and has no audit trail. close has to be called when done.
+func openService(currentConfig *config, readOnly bool) (*services.Service, func(), error) {
+	lock, err := utils.LockFolder(currentConfig.Storage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while locking storage %w", err)
+	}
+	options := currentConfig.options()
+	options.ReadOnly = readOnly
+	var auditLog *audit.Log
+	if !readOnly {
+		auditLog, err = audit.Open(currentConfig.Storage, currentConfig.AuditMaxBytes, currentConfig.AuditMaxFiles)
+		if err != nil {
+			lock.Close()
+			return nil, nil, fmt.Errorf("error while opening audit trail %w", err)
+		}
+		options.AuditLog = auditLog
+	}
+	workerPool := workers.NewPool(currentConfig.Workers, currentConfig.MaxConcurrentJobs)
+	canvasCache := cache.NewCanvasCache(currentConfig.CacheMaxBytes)
+	service := services.NewService(currentConfig.Storage, workerPool, canvasCache, options)
+	closeService := func() {
+		service.Close()
+		workerPool.Close()
+		if auditLog != nil {
+			auditLog.Close()
+		}
+		lock.Close()
+	}
+	if err := service.Recover(); err != nil {
+		closeService()
+		return nil, nil, fmt.Errorf("error while recovering storage %w", err)
+	}
+
+	return service, closeService, nil
+}
+
+func serve(args []string) error {
+	currentConfig, args, err := parseCommand("serve", args, "[storage]", true)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	routerOptions, err := currentConfig.routerOptions()
+	if err != nil {
+		return err
+	}
+	service, closeService, err := openService(currentConfig, false)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	prometheus.MustRegister(metrics.NewStorageCollector(func() metrics.Usage {
+		usage := service.Usage()
+		return metrics.Usage{Canvases: usage.Images, Pixels: usage.Pixels, Bytes: usage.Bytes}
+	}))
+	chartRouter := routers.NewChartRouter(service, routerOptions)
 	chartServer := server.NewServer()
 
+	runErrors := make(chan error, 1)
 	go func() {
-		if err := chartServer.Run(viper.GetString("port"), chartRouter.InitChartRouter()); err != nil && errors.Is(err, http.ErrServerClosed) {
-			log.Printf("Listen: %s\n", err)
+		if err := chartServer.Run(strconv.Itoa(currentConfig.Port), chartRouter.InitChartRouter()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			runErrors <- err
 		}
 	}()
 
-	log.Println("API started")
+	zap.L().Info("API started", zap.Int("port", currentConfig.Port), zap.String("version", version))
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down API...")
+	select {
+	case err := <-runErrors:
+		return fmt.Errorf("listening failed: %w", err)
+	case <-quit:
+	}
+	zap.L().Info("Shutting down API")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := chartServer.Shutdown(ctx); err != nil {
-		log.Fatal("API forced to shutdown:", err)
+		return fmt.Errorf("API forced to shutdown: %w", err)
+	}
+
+	zap.L().Info("API exiting")
+	return nil
+}
+
+func importImages(args []string) error {
+	currentConfig, args, err := parseCommand("import", args, "<file.bmp>...", false)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("no files to import")
+	}
+
+	service, closeService, err := openService(currentConfig, false)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	for _, path := range args {
+		id, err := importImage(service, path)
+		if err != nil {
+			return fmt.Errorf("error while importing %s: %w", path, err)
+		}
+		fmt.Printf("%s\t%s\n", path, id)
+	}
+
+	return nil
+}
+
+func importImage(service *services.Service, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	imageConfig, err := bmp.DecodeConfig(file)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	id, err := service.CreateBMP(context.Background(), imageConfig.Width, imageConfig.Height)
+	if err != nil {
+		return "", err
+	}
+	if err := service.UpdateBMP(context.Background(), id, 0, 0, imageConfig.Width, imageConfig.Height, file); err != nil {
+		service.DeleteBMP(context.Background(), id)
+		return "", err
+	}
+
+	return id, nil
+}
+
+func exportImage(args []string) error {
+	currentConfig, args, err := parseCommand("export", args, "[project] <id> <file.bmp>", false)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return errors.New("export needs an image id and an output file")
+	}
+	ctx := context.Background()
+	if len(args) == 3 {
+		if !services.IsValidProject(args[0]) {
+			return fmt.Errorf("invalid project %s", args[0])
+		}
+		ctx = services.WithProject(ctx, args[0])
+		args = args[1:]
+	}
+	id := strings.ToLower(args[0])
+	if !utils.IsValidID(id) {
+		return fmt.Errorf("invalid image id %s", args[0])
+	}
+
+	service, closeService, err := openService(currentConfig, true)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	return utils.WriteFileAtomic(args[1], func(writer io.Writer) error {
+		return service.ExportBMP(ctx, id, writer)
+	})
+}
+
+func fsck(args []string) error {
+	currentConfig, args, err := parseCommand("fsck", args, "", false)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	service, closeService, err := openService(currentConfig, true)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	report, err := service.VerifyStorage(context.Background())
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if len(report.Corrupt) != 0 || len(report.Missing) != 0 {
+		return fmt.Errorf("storage has %d corrupt and %d missing images", len(report.Corrupt), len(report.Missing))
 	}
 
-	log.Println("API exiting")
+	return nil
 }
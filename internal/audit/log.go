@@ -0,0 +1,245 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/pmokeev/chartographer/internal/models"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileName       = "audit.jsonl"
+	rotatedPrefix  = "audit-"
+	rotatedSuffix  = ".jsonl"
+	rotationLayout = "20060102T150405.000000000Z"
+)
+
+// Log is an append-only trail of audit entries, one JSON object per line,
+// in audit.jsonl of a folder. Once the file would grow beyond its maximum
+// size it is renamed to audit-{time}.jsonl and a new one is started. Only
+// the newest rotated files up to the maximum count are kept.
+type Log struct {
+	pathToFolder string
+	maxBytes     int64
+	maxFiles     int
+	file         *os.File
+	size         int64
+	now          func() time.Time
+
+	sync.Mutex
+}
+
+// Open opens the trail in the folder. A zero maxBytes never rotates it and
+// a zero maxFiles keeps every rotated file.
+func Open(pathToFolder string, maxBytes int64, maxFiles int) (*Log, error) {
+	auditLog := &Log{pathToFolder: pathToFolder, maxBytes: maxBytes, maxFiles: maxFiles, now: time.Now}
+	if err := auditLog.openFile(); err != nil {
+		return nil, err
+	}
+
+	return auditLog, nil
+}
+
+// openFile opens the current file for appending. A line torn by a crash
+// is ended, so the next entry starts on a line of its own.
+func (auditLog *Log) openFile() error {
+	file, err := os.OpenFile(filepath.Join(auditLog.pathToFolder, fileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err == nil && size > 0 {
+		lastByte := make([]byte, 1)
+		if _, err = file.ReadAt(lastByte, size-1); err == nil && lastByte[0] != '\n' {
+			_, err = file.Write([]byte{'\n'})
+			size++
+		}
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	auditLog.file = file
+	auditLog.size = size
+
+	return nil
+}
+
+// Record durably appends the entry to the trail.
+func (auditLog *Log) Record(entry models.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	auditLog.Lock()
+	defer auditLog.Unlock()
+
+	if auditLog.maxBytes > 0 && auditLog.size > 0 && auditLog.size+int64(len(line)) > auditLog.maxBytes {
+		if err := auditLog.rotate(); err != nil {
+			return err
+		}
+	}
+	written, err := auditLog.file.Write(line)
+	auditLog.size += int64(written)
+	if err != nil {
+		return err
+	}
+
+	return auditLog.file.Sync()
+}
+
+// rotate moves the current file aside and starts a new one. The lock has
+// to be held.
+func (auditLog *Log) rotate() error {
+	if err := auditLog.file.Close(); err != nil {
+		return err
+	}
+	rotatedName := rotatedPrefix + auditLog.now().UTC().Format(rotationLayout) + rotatedSuffix
+	if err := os.Rename(filepath.Join(auditLog.pathToFolder, fileName), filepath.Join(auditLog.pathToFolder, rotatedName)); err != nil {
+		auditLog.openFile()
+		return err
+	}
+	if err := auditLog.openFile(); err != nil {
+		return err
+	}
+
+	return auditLog.prune()
+}
+
+// prune removes the oldest rotated files beyond the maximum count.
+func (auditLog *Log) prune() error {
+	if auditLog.maxFiles <= 0 {
+		return nil
+	}
+	names, err := auditLog.rotatedNames()
+	if err != nil {
+		return err
+	}
+	for len(names) > auditLog.maxFiles {
+		if err := os.Remove(filepath.Join(auditLog.pathToFolder, names[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		names = names[1:]
+	}
+
+	return nil
+}
+
+// rotatedNames returns the names of the rotated files, oldest first.
+func (auditLog *Log) rotatedNames() ([]string, error) {
+	files, err := ioutil.ReadDir(auditLog.pathToFolder)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, file := range files {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), rotatedPrefix) && strings.HasSuffix(file.Name(), rotatedSuffix) {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Query returns the entries selected by the filter from the current file
+// and the rotated ones, newest first, so older entries can be paged
+// through by setting To to the time of the last entry returned. Lines that
+// cannot be parsed, like a line torn by a crash, are skipped.
+//
+// Record is not blocked while the files are read: the lock is only held
+// to open the current file and take its size, so entries recorded after
+// that are not returned.
+func (auditLog *Log) Query(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	auditLog.Lock()
+	current, err := os.Open(filepath.Join(auditLog.pathToFolder, fileName))
+	size := auditLog.size
+	var names []string
+	if err == nil {
+		names, err = auditLog.rotatedNames()
+	}
+	auditLog.Unlock()
+	if err != nil {
+		if current != nil {
+			current.Close()
+		}
+		return nil, err
+	}
+
+	// The current file may be rotated meanwhile, but stays open under its
+	// new name, which is not listed yet.
+	entries, err := readEntries(io.NewSectionReader(current, 0, size), filter, make([]models.AuditEntry, 0))
+	current.Close()
+	if err != nil {
+		return nil, err
+	}
+	for ind := len(names) - 1; ind >= 0; ind-- {
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		// Files pruned meanwhile hold the oldest entries and are skipped.
+		file, err := os.Open(filepath.Join(auditLog.pathToFolder, names[ind]))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries, err = readEntries(file, filter, entries)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// readEntries appends the entries of the file selected by the filter to
+// entries, newest first, up to the limit of the filter.
+func readEntries(file io.Reader, filter models.AuditFilter, entries []models.AuditEntry) ([]models.AuditEntry, error) {
+	remaining := filter.Limit - len(entries)
+	selected := make([]models.AuditEntry, 0)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		var entry models.AuditEntry
+		if len(line) > 0 && json.Unmarshal(line, &entry) == nil && filter.Matches(entry) {
+			selected = append(selected, entry)
+			// Only the newest remaining entries of the file are kept.
+			if filter.Limit > 0 && len(selected) >= 2*remaining {
+				selected = append(selected[:0], selected[len(selected)-remaining:]...)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if filter.Limit > 0 && len(selected) > remaining {
+		selected = selected[len(selected)-remaining:]
+	}
+	for ind := len(selected) - 1; ind >= 0; ind-- {
+		entries = append(entries, selected[ind])
+	}
+
+	return entries, nil
+}
+
+func (auditLog *Log) Close() error {
+	auditLog.Lock()
+	defer auditLog.Unlock()
+
+	return auditLog.file.Close()
+}
@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog_RecordQuery(t *testing.T) {
+	folder := t.TempDir()
+	auditLog, err := Open(folder, 0, 0)
+	assert.NoError(t, err)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []models.AuditEntry{
+		{Time: start, Action: models.AuditCreate, Principal: "alice", CanvasID: "1", Result: models.AuditOK},
+		{Time: start.Add(time.Minute), Action: models.AuditUpdate, Principal: "bob", CanvasID: "1", Fragments: []models.Region{{Width: 2, Height: 3}}, Result: models.AuditDenied},
+		{Time: start.Add(2 * time.Minute), Action: models.AuditDelete, Principal: "alice", CanvasID: "2", Result: models.AuditOK},
+		{Time: start.Add(3 * time.Minute), Action: models.AuditDelete, Project: "maps", CanvasID: "1", Result: models.AuditOK},
+	}
+	for _, entry := range entries {
+		assert.NoError(t, auditLog.Record(entry))
+	}
+
+	selected, err := auditLog.Query(models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, newestFirst(entries[:3]), selected)
+
+	selected, err = auditLog.Query(models.AuditFilter{CanvasID: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, newestFirst(entries[:2]), selected)
+
+	selected, err = auditLog.Query(models.AuditFilter{From: start.Add(time.Minute), To: start.Add(2 * time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, entries[1:2], selected)
+
+	selected, err = auditLog.Query(models.AuditFilter{Project: "maps"})
+	assert.NoError(t, err)
+	assert.Equal(t, entries[3:], selected)
+
+	selected, err = auditLog.Query(models.AuditFilter{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, newestFirst(entries[1:3]), selected)
+
+	selected, err = auditLog.Query(models.AuditFilter{To: selected[1].Time, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, entries[:1], selected)
+
+	assert.NoError(t, auditLog.Close())
+	reopened, err := Open(folder, 0, 0)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	selected, err = reopened.Query(models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, newestFirst(entries[:3]), selected)
+}
+
+func TestLog_Rotate(t *testing.T) {
+	folder := t.TempDir()
+	auditLog, err := Open(folder, 150, 0)
+	assert.NoError(t, err)
+	defer auditLog.Close()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	auditLog.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	entries := make([]models.AuditEntry, 0)
+	for ind := 0; ind < 5; ind++ {
+		entry := models.AuditEntry{Time: now, Action: models.AuditUpdate, CanvasID: "1", Result: models.AuditOK}
+		assert.NoError(t, auditLog.Record(entry))
+		entries = append(entries, entry)
+	}
+
+	files, err := ioutil.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Len(t, files, 5)
+	for _, file := range files {
+		assert.LessOrEqual(t, file.Size(), int64(150))
+	}
+
+	selected, err := auditLog.Query(models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, newestFirst(entries), selected)
+
+	selected, err = auditLog.Query(models.AuditFilter{Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, newestFirst(entries[2:]), selected)
+}
+
+func TestLog_Rotate_MaxFiles(t *testing.T) {
+	folder := t.TempDir()
+	auditLog, err := Open(folder, 150, 2)
+	assert.NoError(t, err)
+	defer auditLog.Close()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	auditLog.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	entries := make([]models.AuditEntry, 0)
+	for ind := 0; ind < 5; ind++ {
+		entry := models.AuditEntry{Time: now, Action: models.AuditUpdate, CanvasID: "1", Result: models.AuditOK}
+		assert.NoError(t, auditLog.Record(entry))
+		entries = append(entries, entry)
+	}
+
+	files, err := ioutil.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	selected, err := auditLog.Query(models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, newestFirst(entries[2:]), selected)
+}
+
+func newestFirst(entries []models.AuditEntry) []models.AuditEntry {
+	reversed := make([]models.AuditEntry, len(entries))
+	for ind, entry := range entries {
+		reversed[len(entries)-1-ind] = entry
+	}
+
+	return reversed
+}
+
+func TestLog_Query_TornLine(t *testing.T) {
+	folder := t.TempDir()
+	auditLog, err := Open(folder, 0, 0)
+	assert.NoError(t, err)
+
+	entry := models.AuditEntry{Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Action: models.AuditCreate, CanvasID: "1", Result: models.AuditOK}
+	assert.NoError(t, auditLog.Record(entry))
+	file, err := os.OpenFile(filepath.Join(folder, fileName), os.O_WRONLY|os.O_APPEND, 0666)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"time":"2026-01-01T00:`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	selected, err := auditLog.Query(models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuditEntry{entry}, selected)
+
+	assert.NoError(t, auditLog.Close())
+	reopened, err := Open(folder, 0, 0)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	assert.NoError(t, reopened.Record(entry))
+	selected, err = reopened.Query(models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuditEntry{entry, entry}, selected)
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator resolves the credentials of a request to its principal.
+type Authenticator interface {
+	Authenticate(credentials string) (Principal, error)
+}
+
+// APIKeys authenticates static API keys. Keys are kept as SHA-256 hashes,
+// so looking them up takes the same time whatever part of a key matches.
+type APIKeys struct {
+	principals map[[sha256.Size]byte]Principal
+}
+
+// NewAPIKeys returns the authenticator of the keys. Principals without a
+// tenant belong to DefaultTenant.
+func NewAPIKeys(keys map[string]Principal) *APIKeys {
+	apiKeys := &APIKeys{principals: make(map[[sha256.Size]byte]Principal, len(keys))}
+	for key, principal := range keys {
+		if principal.Tenant == "" {
+			principal.Tenant = DefaultTenant
+		}
+		apiKeys.principals[sha256.Sum256([]byte(key))] = principal
+	}
+
+	return apiKeys
+}
+
+func (apiKeys *APIKeys) Authenticate(credentials string) (Principal, error) {
+	principal, ok := apiKeys.principals[sha256.Sum256([]byte(credentials))]
+	if !ok {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	return principal, nil
+}
+
+// Authenticators accepts the credentials accepted by any of them and
+// returns the error of the last one otherwise.
+type Authenticators []Authenticator
+
+func (authenticators Authenticators) Authenticate(credentials string) (Principal, error) {
+	err := ErrInvalidCredentials
+	for _, authenticator := range authenticators {
+		var principal Principal
+		if principal, err = authenticator.Authenticate(credentials); err == nil {
+			return principal, nil
+		}
+	}
+
+	return Principal{}, err
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAPIKeys_Authenticate(t *testing.T) {
+	apiKeys := NewAPIKeys(map[string]Principal{
+		"secret-1": {Name: "alice", Tenant: "lab", Roles: []string{RoleAdmin}},
+		"secret-2": {Name: "bob"},
+	})
+
+	principal, err := apiKeys.Authenticate("secret-1")
+	assert.NoError(t, err)
+	assert.Equal(t, Principal{Name: "alice", Tenant: "lab", Roles: []string{RoleAdmin}}, principal)
+	assert.True(t, principal.HasRole(RoleAdmin))
+
+	principal, err = apiKeys.Authenticate("secret-2")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTenant, principal.Tenant)
+	assert.False(t, principal.HasRole(RoleAdmin))
+
+	_, err = apiKeys.Authenticate("secret-3")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = apiKeys.Authenticate("")
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
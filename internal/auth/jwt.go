@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the clocks of the issuer and the service may differ.
+const clockSkew = time.Minute
+
+// PublicKey verifies the signatures of tokens whose kid header is ID. A key
+// without an ID verifies tokens with any kid.
+type PublicKey struct {
+	ID  string
+	Key crypto.PublicKey
+}
+
+// JWTOptions describe the accepted tokens. Empty Issuer and Audience are not
+// checked. Claims are named by their path in the payload, e.g.
+// "realm_access.roles".
+type JWTOptions struct {
+	Issuer      string
+	Audience    string
+	NameClaim   string
+	TenantClaim string
+	RolesClaim  string
+}
+
+// JWTAuthenticator authenticates signed JSON Web Tokens with public keys
+// configured up front, so no key is ever fetched over the network.
+type JWTAuthenticator struct {
+	keys    []PublicKey
+	options JWTOptions
+	now     func() time.Time
+}
+
+func NewJWTAuthenticator(keys []PublicKey, options JWTOptions) *JWTAuthenticator {
+	if options.NameClaim == "" {
+		options.NameClaim = "sub"
+	}
+	if options.TenantClaim == "" {
+		options.TenantClaim = "tenant"
+	}
+	if options.RolesClaim == "" {
+		options.RolesClaim = "roles"
+	}
+
+	return &JWTAuthenticator{keys: keys, options: options, now: time.Now}
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Authenticate verifies the signature, the validity period, the issuer and
+// the audience of the token and maps its claims to the principal.
+func (authenticator *JWTAuthenticator) Authenticate(credentials string) (Principal, error) {
+	parts := strings.Split(credentials, ".")
+	if len(parts) != 3 {
+		return Principal{}, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed header", ErrInvalidCredentials)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed signature", ErrInvalidCredentials)
+	}
+	if !authenticator.verify(header, []byte(parts[0]+"."+parts[1]), signature) {
+		return Principal{}, fmt.Errorf("%w: invalid signature", ErrInvalidCredentials)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed claims", ErrInvalidCredentials)
+	}
+	if err := authenticator.validateClaims(claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	return authenticator.principal(claims)
+}
+
+func (authenticator *JWTAuthenticator) verify(header jwtHeader, signed, signature []byte) bool {
+	for _, key := range authenticator.keys {
+		if key.ID != "" && header.KeyID != "" && key.ID != header.KeyID {
+			continue
+		}
+		if verifySignature(header.Algorithm, key.Key, signed, signature) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (authenticator *JWTAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := authenticator.now()
+	expiresAt, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("token does not expire")
+	}
+	if now.After(time.Unix(int64(expiresAt), 0).Add(clockSkew)) {
+		return fmt.Errorf("token expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(notBefore), 0)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if authenticator.options.Issuer != "" && claims["iss"] != authenticator.options.Issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if authenticator.options.Audience != "" && !containsString(stringsClaim(claims["aud"]), authenticator.options.Audience) {
+		return fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+
+	return nil
+}
+
+func (authenticator *JWTAuthenticator) principal(claims map[string]interface{}) (Principal, error) {
+	name, _ := claimValue(claims, authenticator.options.NameClaim).(string)
+	if name == "" {
+		return Principal{}, fmt.Errorf("%w: claim %s is missing", ErrInvalidCredentials, authenticator.options.NameClaim)
+	}
+	tenant, _ := claimValue(claims, authenticator.options.TenantClaim).(string)
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	if !IsValidTenant(tenant) {
+		return Principal{}, fmt.Errorf("%w: invalid tenant %s", ErrInvalidCredentials, tenant)
+	}
+
+	return Principal{Name: name, Tenant: tenant, Roles: stringsClaim(claimValue(claims, authenticator.options.RolesClaim))}, nil
+}
+
+// verifySignature checks the signature of the algorithm with the key. Only
+// asymmetric algorithms are accepted.
+func verifySignature(algorithm string, key crypto.PublicKey, signed, signature []byte) bool {
+	if len(algorithm) != 5 {
+		return false
+	}
+	var hash crypto.Hash
+	switch algorithm[len(algorithm)-3:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if hash == 0 {
+			return false
+		}
+		digest := hash.New()
+		digest.Write(signed)
+		switch algorithm[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(key, hash, digest.Sum(nil), signature) == nil
+		case "PS":
+			return rsa.VerifyPSS(key, hash, digest.Sum(nil), signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+		keySize := (key.Curve.Params().BitSize + 7) / 8
+		if curves[algorithm] != key.Curve || len(signature) != 2*keySize {
+			return false
+		}
+		digest := hash.New()
+		digest.Write(signed)
+		r := new(big.Int).SetBytes(signature[:keySize])
+		s := new(big.Int).SetBytes(signature[keySize:])
+		return ecdsa.Verify(key, digest.Sum(nil), r, s)
+	case ed25519.PublicKey:
+		return algorithm == "EdDSA" && ed25519.Verify(key, signed, signature)
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+// claimValue returns the claim at the dot separated path.
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	return value
+}
+
+// stringsClaim reads a claim that is either a list of strings or a space
+// separated string, as the scope claim.
+func stringsClaim(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, element := range value {
+			if element, ok := element.(string); ok {
+				values = append(values, element)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func signToken(t *testing.T, algorithm, keyID string, key crypto.Signer, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "kid": keyID, "typ": "JWT"})
+	assert.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signed))
+	}
+	assert.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testClaims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub":    "alice",
+		"iss":    "https://id.example.org",
+		"aud":    []string{"chartographer"},
+		"exp":    testNow.Add(time.Hour).Unix(),
+		"tenant": "lab",
+		"realm":  map[string]interface{}{"roles": []string{RoleAdmin, "curator"}},
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+
+	return claims
+}
+
+func TestJWTAuthenticator_Authenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	authenticator := NewJWTAuthenticator([]PublicKey{
+		{ID: "rsa", Key: rsaKey.Public()},
+		{ID: "ec", Key: ecKey.Public()},
+		{Key: edKey.Public()},
+	}, JWTOptions{Issuer: "https://id.example.org", Audience: "chartographer", RolesClaim: "realm.roles"})
+	authenticator.now = func() time.Time { return testNow }
+
+	expectedPrincipal := Principal{Name: "alice", Tenant: "lab", Roles: []string{RoleAdmin, "curator"}}
+	tests := []struct {
+		testName          string
+		token             string
+		expectedPrincipal Principal
+		expectedError     bool
+	}{
+		{
+			testName:          "RS256",
+			token:             signToken(t, "RS256", "rsa", rsaKey, testClaims(nil)),
+			expectedPrincipal: expectedPrincipal,
+		},
+		{
+			testName:          "ES256",
+			token:             signToken(t, "ES256", "ec", ecKey, testClaims(nil)),
+			expectedPrincipal: expectedPrincipal,
+		},
+		{
+			testName:          "EdDSA with any kid",
+			token:             signToken(t, "EdDSA", "unknown", edKey, testClaims(nil)),
+			expectedPrincipal: expectedPrincipal,
+		},
+		{
+			testName:          "Without tenant and roles",
+			token:             signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"tenant": nil, "realm": nil})),
+			expectedPrincipal: Principal{Name: "alice", Tenant: DefaultTenant, Roles: nil},
+		},
+		{
+			testName:      "Expired",
+			token:         signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"exp": testNow.Add(-2 * time.Minute).Unix()})),
+			expectedError: true,
+		},
+		{
+			testName:          "Expired within clock skew",
+			token:             signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"exp": testNow.Add(-30 * time.Second).Unix()})),
+			expectedPrincipal: expectedPrincipal,
+		},
+		{
+			testName:      "Without expiry",
+			token:         signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"exp": nil})),
+			expectedError: true,
+		},
+		{
+			testName:      "Not valid yet",
+			token:         signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"nbf": testNow.Add(time.Hour).Unix()})),
+			expectedError: true,
+		},
+		{
+			testName:      "Wrong issuer",
+			token:         signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"iss": "https://evil.example.org"})),
+			expectedError: true,
+		},
+		{
+			testName:      "Wrong audience",
+			token:         signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"aud": "other"})),
+			expectedError: true,
+		},
+		{
+			testName:      "Without subject",
+			token:         signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"sub": nil})),
+			expectedError: true,
+		},
+		{
+			testName:      "Invalid tenant",
+			token:         signToken(t, "ES256", "ec", ecKey, testClaims(map[string]interface{}{"tenant": "../lab"})),
+			expectedError: true,
+		},
+		{
+			testName:      "Unknown key",
+			token:         signToken(t, "ES256", "ec", otherKey, testClaims(nil)),
+			expectedError: true,
+		},
+		{
+			testName:      "Key of another kid",
+			token:         signToken(t, "RS256", "ec", rsaKey, testClaims(nil)),
+			expectedError: true,
+		},
+		{
+			testName:      "Algorithm of another key type",
+			token:         signToken(t, "RS256", "rsa", ecKey, testClaims(nil)),
+			expectedError: true,
+		},
+		{
+			testName:      "Unsigned",
+			token:         signToken(t, "RS256", "rsa", rsaKey, testClaims(nil))[:10] + ".e30.",
+			expectedError: true,
+		},
+		{
+			testName:      "Malformed",
+			token:         "not-a-token",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(test.token)
+			if test.expectedError {
+				assert.True(t, errors.Is(err, ErrInvalidCredentials), err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedPrincipal, principal)
+		})
+	}
+}
+
+func TestReadJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	encode := func(value *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(value.Bytes())
+	}
+	keySet, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec", "crv": "P-384", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edPublicKey)},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": encode(rsaKey.N), "e": "AQAB"},
+	}})
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(path, keySet, 0644))
+
+	keys, err := ReadJWKS(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []PublicKey{
+		{ID: "rsa", Key: &rsaKey.PublicKey},
+		{ID: "ec", Key: &ecKey.PublicKey},
+		{ID: "ed", Key: edPublicKey},
+	}, keys)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`), 0644))
+	_, err = ReadJWKS(path)
+	assert.Error(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`), 0644))
+	_, err = ReadJWKS(path)
+	assert.Error(t, err)
+}
+
+func TestReadPEMPublicKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(ecKey.Public())
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})...)
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+
+	keys, err := ReadPEMPublicKeys(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []PublicKey{{Key: &ecKey.PublicKey}, {Key: &rsaKey.PublicKey}}, keys)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("no keys"), 0644))
+	_, err = ReadPEMPublicKeys(path)
+	assert.Error(t, err)
+}
+
+func TestAuthenticators_Authenticate(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	jwtAuthenticator := NewJWTAuthenticator([]PublicKey{{Key: ecKey.Public()}}, JWTOptions{})
+	jwtAuthenticator.now = func() time.Time { return testNow }
+	authenticators := Authenticators{NewAPIKeys(map[string]Principal{"secret": {Name: "bob"}}), jwtAuthenticator}
+
+	principal, err := authenticators.Authenticate("secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", principal.Name)
+	principal, err = authenticators.Authenticate(signToken(t, "ES256", "", ecKey, testClaims(nil)))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", principal.Name)
+	_, err = authenticators.Authenticate("guess")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+}
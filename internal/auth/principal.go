@@ -0,0 +1,48 @@
+package auth
+
+import "context"
+
+// DefaultTenant owns everything created without a tenant.
+const DefaultTenant = "default"
+
+// RoleAdmin may use the admin routes and every image.
+const RoleAdmin = "admin"
+
+// Principal is the caller of a request. Name is empty unless the caller
+// is authenticated.
+type Principal struct {
+	Name   string
+	Tenant string
+	Roles  []string
+}
+
+func (principal Principal) HasRole(role string) bool {
+	for _, current := range principal.Roles {
+		if current == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// TenantFromContext returns the tenant of the caller or DefaultTenant.
+func TenantFromContext(ctx context.Context) string {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok || principal.Tenant == "" {
+		return DefaultTenant
+	}
+
+	return principal.Tenant
+}
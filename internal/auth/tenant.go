@@ -0,0 +1,11 @@
+package auth
+
+import "regexp"
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// IsValidTenant reports whether name may name a tenant. Tenant names are
+// lower case, as the keys of the config file they are looked up in.
+func IsValidTenant(name string) bool {
+	return tenantPattern.MatchString(name)
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/pmokeev/chartographer/internal/models"
+	"image"
+	"sync"
+)
+
+type cacheEntry struct {
+	key   string
+	image *image.RGBA
+	size  int64
+}
+
+// CanvasCache keeps recently used decoded canvases in memory up to a
+// budget in bytes and evicts the least recently used ones beyond it.
+// Canvases are stored under keys unique across all chart services sharing
+// the cache.
+// The cache does not copy images: callers own the locking of a canvas
+// and must Remove it if they leave it in a state that is not on disk.
+type CanvasCache struct {
+	maxBytes  int64
+	usedBytes int64
+	entries   map[string]*list.Element
+	order     *list.List
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	sync.Mutex
+}
+
+// NewCanvasCache creates a cache holding up to maxBytes of pixels.
+// A non-positive maxBytes disables caching.
+func NewCanvasCache(maxBytes int64) *CanvasCache {
+	return &CanvasCache{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element, 0),
+		order:    list.New()}
+}
+
+func (canvasCache *CanvasCache) Get(key string) (*image.RGBA, bool) {
+	canvasCache.Lock()
+	defer canvasCache.Unlock()
+
+	element, ok := canvasCache.entries[key]
+	if !ok {
+		canvasCache.misses++
+		return nil, false
+	}
+	canvasCache.hits++
+	canvasCache.order.MoveToFront(element)
+
+	return element.Value.(*cacheEntry).image, true
+}
+
+// Put stores img as the canvas with the given key, replacing the previous
+// one. Images larger than the whole budget are not stored.
+func (canvasCache *CanvasCache) Put(key string, img *image.RGBA) {
+	canvasCache.Lock()
+	defer canvasCache.Unlock()
+
+	canvasCache.remove(key)
+
+	size := int64(len(img.Pix))
+	if size > canvasCache.maxBytes {
+		return
+	}
+	canvasCache.entries[key] = canvasCache.order.PushFront(&cacheEntry{key: key, image: img, size: size})
+	canvasCache.usedBytes += size
+
+	for canvasCache.usedBytes > canvasCache.maxBytes {
+		canvasCache.remove(canvasCache.order.Back().Value.(*cacheEntry).key)
+		canvasCache.evictions++
+	}
+}
+
+func (canvasCache *CanvasCache) Remove(key string) {
+	canvasCache.Lock()
+	defer canvasCache.Unlock()
+
+	canvasCache.remove(key)
+}
+
+func (canvasCache *CanvasCache) Stats() models.CacheStats {
+	canvasCache.Lock()
+	defer canvasCache.Unlock()
+
+	return models.CacheStats{
+		Hits:      canvasCache.hits,
+		Misses:    canvasCache.misses,
+		Evictions: canvasCache.evictions,
+		Entries:   len(canvasCache.entries),
+		UsedBytes: canvasCache.usedBytes,
+		MaxBytes:  canvasCache.maxBytes}
+}
+
+func (canvasCache *CanvasCache) remove(key string) {
+	element, ok := canvasCache.entries[key]
+	if !ok {
+		return
+	}
+	canvasCache.order.Remove(element)
+	delete(canvasCache.entries, key)
+	canvasCache.usedBytes -= element.Value.(*cacheEntry).size
+}
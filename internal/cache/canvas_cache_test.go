@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"testing"
+)
+
+// newCanvas returns a canvas taking width*4 bytes.
+func newCanvas(width int) *image.RGBA {
+	return image.NewRGBA(image.Rect(0, 0, width, 1))
+}
+
+func TestCanvasCache_GetPut(t *testing.T) {
+	canvasCache := NewCanvasCache(100)
+	canvas := newCanvas(10)
+
+	_, ok := canvasCache.Get("1")
+	assert.False(t, ok)
+
+	canvasCache.Put("1", canvas)
+	cachedCanvas, ok := canvasCache.Get("1")
+	assert.True(t, ok)
+	assert.Same(t, canvas, cachedCanvas)
+
+	stats := canvasCache.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, int64(40), stats.UsedBytes)
+	assert.Equal(t, int64(100), stats.MaxBytes)
+}
+
+func TestCanvasCache_Replace(t *testing.T) {
+	canvasCache := NewCanvasCache(100)
+	canvasCache.Put("1", newCanvas(10))
+	canvas := newCanvas(5)
+	canvasCache.Put("1", canvas)
+
+	cachedCanvas, ok := canvasCache.Get("1")
+	assert.True(t, ok)
+	assert.Same(t, canvas, cachedCanvas)
+	assert.Equal(t, int64(20), canvasCache.Stats().UsedBytes)
+	assert.Equal(t, 1, canvasCache.Stats().Entries)
+}
+
+func TestCanvasCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	canvasCache := NewCanvasCache(100)
+	canvasCache.Put("1", newCanvas(10))
+	canvasCache.Put("2", newCanvas(10))
+	_, ok := canvasCache.Get("1")
+	assert.True(t, ok)
+
+	canvasCache.Put("3", newCanvas(10))
+
+	_, ok = canvasCache.Get("2")
+	assert.False(t, ok)
+	_, ok = canvasCache.Get("1")
+	assert.True(t, ok)
+	_, ok = canvasCache.Get("3")
+	assert.True(t, ok)
+
+	stats := canvasCache.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(80), stats.UsedBytes)
+}
+
+func TestCanvasCache_OverBudget(t *testing.T) {
+	canvasCache := NewCanvasCache(100)
+	canvasCache.Put("1", newCanvas(10))
+	canvasCache.Put("2", newCanvas(30))
+
+	_, ok := canvasCache.Get("2")
+	assert.False(t, ok)
+	_, ok = canvasCache.Get("1")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), canvasCache.Stats().Evictions)
+}
+
+func TestCanvasCache_Disabled(t *testing.T) {
+	canvasCache := NewCanvasCache(0)
+	canvasCache.Put("1", newCanvas(1))
+
+	_, ok := canvasCache.Get("1")
+	assert.False(t, ok)
+	assert.Equal(t, 0, canvasCache.Stats().Entries)
+}
+
+func TestCanvasCache_Remove(t *testing.T) {
+	canvasCache := NewCanvasCache(100)
+	canvasCache.Put("1", newCanvas(10))
+	canvasCache.Remove("1")
+	canvasCache.Remove("2")
+
+	_, ok := canvasCache.Get("1")
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), canvasCache.Stats().UsedBytes)
+}
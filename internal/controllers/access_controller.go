@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"net/http"
+)
+
+type AccessController struct {
+	accessService services.ChartographerAccessManager
+}
+
+func NewAccessController(accessService services.ChartographerAccessManager) *AccessController {
+	return &AccessController{accessService: accessService}
+}
+
+func (accessController *AccessController) GetACL(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	acl, err := accessController.accessService.GetACL(context.Request.Context(), imageID)
+	if err != nil {
+		abortWithAccessError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, acl)
+}
+
+func (accessController *AccessController) GrantAccess(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	var grant struct {
+		Permissions []models.Permission `json:"permissions"`
+	}
+	if err := context.ShouldBindJSON(&grant); err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	if err := accessController.accessService.GrantAccess(context.Request.Context(), imageID, context.Param("principal"), grant.Permissions); err != nil {
+		abortWithAccessError(context, err)
+		return
+	}
+
+	context.AbortWithStatus(http.StatusOK)
+}
+
+func (accessController *AccessController) RevokeAccess(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	if err := accessController.accessService.RevokeAccess(context.Request.Context(), imageID, context.Param("principal")); err != nil {
+		abortWithAccessError(context, err)
+		return
+	}
+
+	context.AbortWithStatus(http.StatusOK)
+}
+
+func abortWithAccessError(context *gin.Context, err error) {
+	switch err.(type) {
+	case *models.ParamsError:
+		context.AbortWithError(http.StatusBadRequest, err)
+	case *models.IdError:
+		context.AbortWithError(http.StatusNotFound, err)
+	case *models.PermissionError:
+		context.AbortWithError(http.StatusForbidden, err)
+	default:
+		context.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/pmokeev/chartographer/internal/services/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_Access(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerAccessManager)
+
+	tests := []struct {
+		testName             string
+		method               string
+		target               string
+		body                 string
+		mockBehavior         mockBehavior
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			testName: "Get ACL",
+			method:   http.MethodGet,
+			target:   "/chartas/0/acl",
+			mockBehavior: func(service *mock_services.MockChartographerAccessManager) {
+				service.EXPECT().GetACL(gomock.Any(), "0").Return(models.ACL{Owner: "alice", Grants: map[string][]models.Permission{"bob": {models.PermissionRead}}}, nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: `{"owner":"alice","grants":{"bob":["read"]}}`,
+		},
+		{
+			testName: "Get ACL of unknown image",
+			method:   http.MethodGet,
+			target:   "/chartas/1/acl",
+			mockBehavior: func(service *mock_services.MockChartographerAccessManager) {
+				service.EXPECT().GetACL(gomock.Any(), "1").Return(models.ACL{}, &models.IdError{ID: "1"})
+			},
+			expectedStatusCode: 404,
+		},
+		{
+			testName: "Grant access",
+			method:   http.MethodPut,
+			target:   "/chartas/0/acl/bob",
+			body:     `{"permissions":["read","write"]}`,
+			mockBehavior: func(service *mock_services.MockChartographerAccessManager) {
+				service.EXPECT().GrantAccess(gomock.Any(), "0", "bob", []models.Permission{models.PermissionRead, models.PermissionWrite}).Return(nil)
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			testName: "Grant unknown permission",
+			method:   http.MethodPut,
+			target:   "/chartas/0/acl/bob",
+			body:     `{"permissions":["own"]}`,
+			mockBehavior: func(service *mock_services.MockChartographerAccessManager) {
+				service.EXPECT().GrantAccess(gomock.Any(), "0", "bob", []models.Permission{"own"}).Return(&models.ParamsError{})
+			},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Grant without body",
+			method:             http.MethodPut,
+			target:             "/chartas/0/acl/bob",
+			mockBehavior:       func(service *mock_services.MockChartographerAccessManager) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName: "Grant without permission",
+			method:   http.MethodPut,
+			target:   "/chartas/0/acl/bob",
+			body:     `{"permissions":["read"]}`,
+			mockBehavior: func(service *mock_services.MockChartographerAccessManager) {
+				service.EXPECT().GrantAccess(gomock.Any(), "0", "bob", []models.Permission{models.PermissionRead}).Return(&models.PermissionError{ID: "0", Permission: models.PermissionManage})
+			},
+			expectedStatusCode: 403,
+		},
+		{
+			testName: "Revoke access",
+			method:   http.MethodDelete,
+			target:   "/chartas/0/acl/bob",
+			mockBehavior: func(service *mock_services.MockChartographerAccessManager) {
+				service.EXPECT().RevokeAccess(gomock.Any(), "0", "bob").Return(nil)
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			testName: "Revoke access failed",
+			method:   http.MethodDelete,
+			target:   "/chartas/0/acl/bob",
+			mockBehavior: func(service *mock_services.MockChartographerAccessManager) {
+				service.EXPECT().RevokeAccess(gomock.Any(), "0", "bob").Return(errors.New("disk failure"))
+			},
+			expectedStatusCode: 500,
+		},
+		{
+			testName:           "Invalid ID",
+			method:             http.MethodDelete,
+			target:             "/chartas/notInteger/acl/bob",
+			mockBehavior:       func(service *mock_services.MockChartographerAccessManager) {},
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockAccessService := mock_services.NewMockChartographerAccessManager(c)
+			testCase.mockBehavior(mockAccessService)
+			service := &services.Service{ChartographerAccessManager: mockAccessService}
+			controller := &Controller{ChartographerAccessController: NewAccessController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/chartas/:id/acl", controller.GetACL)
+			router.PUT("/chartas/:id/acl/:principal", controller.GrantAccess)
+			router.DELETE("/chartas/:id/acl/:principal", controller.RevokeAccess)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(testCase.method, testCase.target, strings.NewReader(testCase.body))
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.expectedResponseBody, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultAuditLimit is the number of audit entries returned without a limit
+// parameter.
+const defaultAuditLimit = 1000
+
+type AdminController struct {
+	adminService services.ChartographerAdministrator
+}
+
+func NewAdminController(adminService services.ChartographerAdministrator) *AdminController {
+	return &AdminController{adminService: adminService}
+}
+
+func (adminController *AdminController) GetCacheStats(context *gin.Context) {
+	context.JSON(http.StatusOK, adminController.adminService.GetCacheStats())
+}
+
+func (adminController *AdminController) VerifyStorage(context *gin.Context) {
+	report, err := adminController.adminService.VerifyStorage(context.Request.Context())
+	if err != nil {
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+		case *models.ProjectError:
+			context.AbortWithError(http.StatusNotFound, err)
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	context.JSON(http.StatusOK, report)
+}
+
+func (adminController *AdminController) Reconcile(context *gin.Context) {
+	report, err := adminController.adminService.Reconcile(context.Request.Context())
+	if err != nil {
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+		case *models.ProjectError:
+			context.AbortWithError(http.StatusNotFound, err)
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	context.JSON(http.StatusOK, report)
+}
+
+func (adminController *AdminController) QueryAudit(context *gin.Context) {
+	filter, err := parseAuditFilter(context)
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	entries, err := adminController.adminService.QueryAudit(context.Request.Context(), filter)
+	if err != nil {
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	context.JSON(http.StatusOK, entries)
+}
+
+// parseAuditFilter reads the canvas, the RFC 3339 time range and the limit
+// of an audit query.
+func parseAuditFilter(context *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{Limit: defaultAuditLimit}
+	var err error
+	if canvas, ok := context.GetQuery("canvas"); ok {
+		if filter.CanvasID, err = parseImageID(canvas); err != nil {
+			return models.AuditFilter{}, err
+		}
+	}
+	if from, ok := context.GetQuery("from"); ok {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return models.AuditFilter{}, err
+		}
+	}
+	if to, ok := context.GetQuery("to"); ok {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return models.AuditFilter{}, err
+		}
+	}
+	if limit, ok := context.GetQuery("limit"); ok {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return models.AuditFilter{}, err
+		}
+		if filter.Limit <= 0 {
+			return models.AuditFilter{}, &models.ParamsError{}
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/pmokeev/chartographer/internal/services/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler_GetCacheStats(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	mockAdminService := mock_services.NewMockChartographerAdministrator(c)
+	mockAdminService.EXPECT().GetCacheStats().Return(models.CacheStats{Hits: 3, Misses: 1, Evictions: 2, Entries: 1, UsedBytes: 40, MaxBytes: 100})
+	service := &services.Service{ChartographerAdministrator: mockAdminService}
+	controller := &Controller{ChartographerAdminController: NewAdminController(service)}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/admin/cache", controller.GetCacheStats)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/cache", nil)
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, `{"hits":3,"misses":1,"evictions":2,"entries":1,"used_bytes":40,"max_bytes":100}`, recorder.Body.String())
+}
+
+func TestHandler_VerifyStorage(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerAdministrator)
+
+	tests := []struct {
+		testName             string
+		mockBehavior         mockBehavior
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			testName: "OK",
+			mockBehavior: func(service *mock_services.MockChartographerAdministrator) {
+				service.EXPECT().VerifyStorage(gomock.Any()).Return(models.VerifyReport{Checked: 3, Corrupt: []string{"1"}, Missing: []string{}, Unverified: []string{"2"}, Orphaned: []string{"7.bmp"}}, nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: `{"checked":3,"corrupt":["1"],"missing":[],"unverified":["2"],"orphaned":["7.bmp"]}`,
+		},
+		{
+			testName: "Missing project",
+			mockBehavior: func(service *mock_services.MockChartographerAdministrator) {
+				service.EXPECT().VerifyStorage(gomock.Any()).Return(models.VerifyReport{}, &models.ProjectError{Name: "dig-a"})
+			},
+			expectedStatusCode: 404,
+		},
+		{
+			testName: "Storage error",
+			mockBehavior: func(service *mock_services.MockChartographerAdministrator) {
+				service.EXPECT().VerifyStorage(gomock.Any()).Return(models.VerifyReport{}, errors.New("storage error"))
+			},
+			expectedStatusCode: 500,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockAdminService := mock_services.NewMockChartographerAdministrator(c)
+			testCase.mockBehavior(mockAdminService)
+			service := &services.Service{ChartographerAdministrator: mockAdminService}
+			controller := &Controller{ChartographerAdminController: NewAdminController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/admin/verify", controller.VerifyStorage)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/admin/verify", nil)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.expectedResponseBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHandler_Reconcile(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	mockAdminService := mock_services.NewMockChartographerAdministrator(c)
+	mockAdminService.EXPECT().Reconcile(gomock.Any()).Return(models.ReconcileReport{RemovedFiles: []string{"3.bmp"}, DroppedImages: []string{"4"}}, nil)
+	service := &services.Service{ChartographerAdministrator: mockAdminService}
+	controller := &Controller{ChartographerAdminController: NewAdminController(service)}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/admin/fsck", controller.Reconcile)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/admin/fsck", nil)
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, `{"removed_files":["3.bmp"],"dropped_images":["4"]}`, recorder.Body.String())
+}
+
+func TestHandler_QueryAudit(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerAdministrator)
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		testName             string
+		query                string
+		mockBehavior         mockBehavior
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			testName: "OK",
+			query:    "?canvas=1&from=2026-01-01T00:00:00Z&to=2026-01-02T00:00:00Z&limit=10",
+			mockBehavior: func(service *mock_services.MockChartographerAdministrator) {
+				service.EXPECT().QueryAudit(gomock.Any(), models.AuditFilter{CanvasID: "1", From: from, To: from.Add(24 * time.Hour), Limit: 10}).Return([]models.AuditEntry{{Time: from, Action: models.AuditDelete, Principal: "alice", Tenant: "default", CanvasID: "1", RequestID: "abc", Result: models.AuditOK}}, nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: `[{"time":"2026-01-01T00:00:00Z","action":"delete","principal":"alice","tenant":"default","canvas_id":"1","request_id":"abc","result":"ok"}]`,
+		},
+		{
+			testName: "Default limit",
+			mockBehavior: func(service *mock_services.MockChartographerAdministrator) {
+				service.EXPECT().QueryAudit(gomock.Any(), models.AuditFilter{Limit: defaultAuditLimit}).Return([]models.AuditEntry{}, nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: `[]`,
+		},
+		{
+			testName:           "Wrong canvas",
+			query:              "?canvas=01",
+			mockBehavior:       func(service *mock_services.MockChartographerAdministrator) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Wrong time",
+			query:              "?from=yesterday",
+			mockBehavior:       func(service *mock_services.MockChartographerAdministrator) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Wrong limit",
+			query:              "?limit=0",
+			mockBehavior:       func(service *mock_services.MockChartographerAdministrator) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName: "Storage error",
+			mockBehavior: func(service *mock_services.MockChartographerAdministrator) {
+				service.EXPECT().QueryAudit(gomock.Any(), gomock.Any()).Return(nil, errors.New("storage error"))
+			},
+			expectedStatusCode: 500,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockAdminService := mock_services.NewMockChartographerAdministrator(c)
+			testCase.mockBehavior(mockAdminService)
+			service := &services.Service{ChartographerAdministrator: mockAdminService}
+			controller := &Controller{ChartographerAdminController: NewAdminController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/admin/audit", controller.QueryAudit)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/admin/audit"+testCase.query, nil)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.expectedResponseBody, recorder.Body.String())
+		})
+	}
+}
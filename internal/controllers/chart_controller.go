@@ -2,12 +2,19 @@ package controllers
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/pmokeev/chartographer/internal/models"
 	"github.com/pmokeev/chartographer/internal/services"
 	"golang.org/x/image/bmp"
+	"image"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
 )
 
@@ -23,41 +30,50 @@ func (chartController *ChartController) CreateBMP(context *gin.Context) {
 	width, widthOk := context.GetQuery("width")
 	height, heightOk := context.GetQuery("height")
 	if !widthOk || !heightOk {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, &models.ParamsError{})
 		return
 	}
 	widthInt, err := strconv.Atoi(width)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	heightInt, err := strconv.Atoi(height)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	createdID, err := chartController.chartService.CreateBMP(widthInt, heightInt)
+	createdID, err := chartController.chartService.CreateBMP(context.Request.Context(), widthInt, heightInt)
 	if err != nil {
 		switch err.(type) {
 		case *models.ParamsError:
-			context.AbortWithStatus(http.StatusBadRequest)
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		case *models.ProjectError:
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.ImageLimitError, *models.QuotaError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusInsufficientStorage, map[string]string{
+				"error": err.Error(),
+			})
 			return
 		default:
-			context.AbortWithStatus(http.StatusInternalServerError)
+			context.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 	}
 
-	context.JSON(http.StatusCreated, map[string]int{
+	context.JSON(http.StatusCreated, map[string]string{
 		"id": createdID,
 	})
 }
 
 func (chartController *ChartController) UpdateBMP(context *gin.Context) {
-	imageID, err := strconv.Atoi(context.Param("id"))
+	imageID, err := parseImageID(context.Param("id"))
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	xPosition, xPositionOk := context.GetQuery("x")
@@ -65,51 +81,145 @@ func (chartController *ChartController) UpdateBMP(context *gin.Context) {
 	width, widthOk := context.GetQuery("width")
 	height, heightOk := context.GetQuery("height")
 	if !widthOk || !heightOk || !xPositionOk || !yPositionOk {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, &models.ParamsError{})
 		return
 	}
 	widthInt, err := strconv.Atoi(width)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	heightInt, err := strconv.Atoi(height)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	xPositionInt, err := strconv.Atoi(xPosition)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	yPositionInt, err := strconv.Atoi(yPosition)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	receivedImage, err := requestImageReader(context.Request)
+	if err != nil {
+		var limitErr *models.SizeLimitError
+		if errors.As(err, &limitErr) {
+			context.AbortWithError(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		switch err.(type) {
+		case *models.MediaTypeError:
+			context.AbortWithError(http.StatusUnsupportedMediaType, err)
+			return
+		default:
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+	}
+	err = chartController.chartService.UpdateBMP(context.Request.Context(), imageID, xPositionInt, yPositionInt, widthInt, heightInt, receivedImage)
+
+	if err != nil {
+		var limitErr *models.SizeLimitError
+		if errors.As(err, &limitErr) {
+			context.AbortWithError(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		case *models.IdError:
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		case *models.SizeMismatchError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	context.AbortWithStatus(http.StatusOK)
+}
+
+func (chartController *ChartController) UpdateBMPBatch(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
-	receivedImage, _, err := context.Request.FormFile("upload")
+	form, err := context.MultipartForm()
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		var limitErr *models.SizeLimitError
+		if errors.As(err, &limitErr) {
+			context.AbortWithError(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
-	buffer := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buffer, receivedImage); err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+	manifest, manifestOk := form.Value["manifest"]
+	if !manifestOk || len(manifest) != 1 {
+		context.AbortWithError(http.StatusBadRequest, &models.ParamsError{})
 		return
 	}
-	err = chartController.chartService.UpdateBMP(imageID, xPositionInt, yPositionInt, widthInt, heightInt, buffer.Bytes())
+	var fragments []models.Fragment
+	if err := json.Unmarshal([]byte(manifest[0]), &fragments); err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	for ind := range fragments {
+		receivedImages, receivedImagesOk := form.File[fragments[ind].Part]
+		if !receivedImagesOk || len(receivedImages) != 1 {
+			context.AbortWithError(http.StatusBadRequest, &models.ParamsError{})
+			return
+		}
+		receivedImage, err := receivedImages[0].Open()
+		if err != nil {
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		buffer := bytes.NewBuffer(nil)
+		_, err = io.Copy(buffer, receivedImage)
+		receivedImage.Close()
+		if err != nil {
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		fragments[ind].Data = buffer.Bytes()
+	}
 
+	err = chartController.chartService.UpdateBMPBatch(context.Request.Context(), imageID, fragments)
 	if err != nil {
 		switch err.(type) {
 		case *models.ParamsError:
-			context.AbortWithStatus(http.StatusBadRequest)
+			context.AbortWithError(http.StatusBadRequest, err)
 			return
 		case *models.IdError:
-			context.AbortWithStatus(http.StatusNotFound)
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		case *models.SizeMismatchError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
 			return
 		default:
-			context.AbortWithStatus(http.StatusInternalServerError)
+			context.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -118,9 +228,9 @@ func (chartController *ChartController) UpdateBMP(context *gin.Context) {
 }
 
 func (chartController *ChartController) GetPartBMP(context *gin.Context) {
-	imageID, err := strconv.Atoi(context.Param("id"))
+	imageID, err := parseImageID(context.Param("id"))
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	xPosition, xPositionOk := context.GetQuery("x")
@@ -128,41 +238,50 @@ func (chartController *ChartController) GetPartBMP(context *gin.Context) {
 	width, widthOk := context.GetQuery("width")
 	height, heightOk := context.GetQuery("height")
 	if !widthOk || !heightOk || !xPositionOk || !yPositionOk {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, &models.ParamsError{})
 		return
 	}
 	widthInt, err := strconv.Atoi(width)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	heightInt, err := strconv.Atoi(height)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	xPositionInt, err := strconv.Atoi(xPosition)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 	yPositionInt, err := strconv.Atoi(yPosition)
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	image, err := chartController.chartService.GetPartBMP(imageID, xPositionInt, yPositionInt, widthInt, heightInt)
+	image, err := chartController.chartService.GetPartBMP(context.Request.Context(), imageID, xPositionInt, yPositionInt, widthInt, heightInt)
 	if err != nil {
 		switch err.(type) {
 		case *models.ParamsError:
-			context.AbortWithStatus(http.StatusBadRequest)
+			context.AbortWithError(http.StatusBadRequest, err)
 			return
 		case *models.IdError:
-			context.AbortWithStatus(http.StatusNotFound)
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		case *models.CorruptImageError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
 			return
 		default:
-			context.AbortWithStatus(http.StatusInternalServerError)
+			context.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -175,26 +294,145 @@ func (chartController *ChartController) GetPartBMP(context *gin.Context) {
 	})
 }
 
+func (chartController *ChartController) GetPartsBMP(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	var regions []models.Region
+	if err := context.ShouldBindJSON(&regions); err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	// Parts are encoded as they are written, so the response starts with
+	// the first part and errors after it can only cut the response short.
+	writer := multipart.NewWriter(context.Writer)
+	started := false
+	err = chartController.chartService.GetPartsBMP(context.Request.Context(), imageID, regions, func(ind int, part image.Image) error {
+		if !started {
+			started = true
+			context.Header("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+			context.Status(http.StatusOK)
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", "image/bmp")
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="region%d.bmp"`, ind))
+		header.Set("X-Region", fmt.Sprintf("x=%d&y=%d&width=%d&height=%d", regions[ind].XPosition, regions[ind].YPosition, regions[ind].Width, regions[ind].Height))
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		return bmp.Encode(partWriter, part)
+	})
+	if err != nil && started {
+		context.Error(err)
+		return
+	}
+	if err != nil {
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		case *models.IdError:
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		case *models.CorruptImageError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	writer.Close()
+}
+
+func (chartController *ChartController) ListBMP(context *gin.Context) {
+	images, err := chartController.chartService.ListBMP(context.Request.Context())
+	if err != nil {
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	context.JSON(http.StatusOK, images)
+}
+
 func (chartController *ChartController) DeleteBMP(context *gin.Context) {
-	imageID, err := strconv.Atoi(context.Param("id"))
+	imageID, err := parseImageID(context.Param("id"))
 	if err != nil {
-		context.AbortWithStatus(http.StatusBadRequest)
+		context.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	if err = chartController.chartService.DeleteBMP(imageID); err != nil {
+	if err = chartController.chartService.DeleteBMP(context.Request.Context(), imageID); err != nil {
 		switch err.(type) {
 		case *models.ParamsError:
-			context.AbortWithStatus(http.StatusBadRequest)
+			context.AbortWithError(http.StatusBadRequest, err)
 			return
 		case *models.IdError:
-			context.AbortWithStatus(http.StatusNotFound)
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
 			return
 		default:
-			context.AbortWithStatus(http.StatusInternalServerError)
+			context.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 	}
 
 	context.AbortWithStatus(http.StatusOK)
 }
+
+// requestImageReader returns the uploaded fragment either from the
+// "upload" part of a multipart form or from the raw request body,
+// depending on the Content-Type of the request.
+func requestImageReader(request *http.Request) (io.Reader, error) {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, &models.MediaTypeError{MediaType: request.Header.Get("Content-Type")}
+	}
+
+	switch mediaType {
+	case "multipart/form-data":
+		return formFileReader(request, "upload")
+	case "image/bmp", "image/x-bmp", "image/x-ms-bmp", "application/octet-stream":
+		return request.Body, nil
+	default:
+		return nil, &models.MediaTypeError{MediaType: mediaType}
+	}
+}
+
+// formFileReader returns the body of the first multipart file part named
+// name without buffering it, so it has to be read before any other part.
+func formFileReader(request *http.Request, name string) (io.Reader, error) {
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name && part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
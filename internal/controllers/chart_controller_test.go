@@ -2,17 +2,25 @@ package controllers
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
+	"github.com/pmokeev/chartographer/internal/middlewares"
 	"github.com/pmokeev/chartographer/internal/models"
 	"github.com/pmokeev/chartographer/internal/services"
 	"github.com/pmokeev/chartographer/internal/services/mocks"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
 	"image"
+	"io"
+	"io/ioutil"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -34,10 +42,32 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   800,
 			params:   map[string]string{"width": "800", "height": "800"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, nil)
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("0190c6a4-3b1e-7c2d-8e4f-5a6b7c8d9e0f", nil)
 			},
 			expectedStatusCode:   201,
-			expectedResponseBody: `{"id":0}`,
+			expectedResponseBody: `{"id":"0190c6a4-3b1e-7c2d-8e4f-5a6b7c8d9e0f"}`,
+		},
+		{
+			testName: "Too many images",
+			width:    800,
+			height:   800,
+			params:   map[string]string{"width": "800", "height": "800"},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ImageLimitError{Limit: 2})
+			},
+			expectedStatusCode:   507,
+			expectedResponseBody: `{"error":"Storage already holds the maximum of 2 images"}`,
+		},
+		{
+			testName: "Quota exceeded",
+			width:    800,
+			height:   800,
+			params:   map[string]string{"width": "800", "height": "800"},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.QuotaError{Tenant: "lab", Resource: "pixels", Limit: 1000})
+			},
+			expectedStatusCode:   507,
+			expectedResponseBody: `{"error":"Tenant lab would exceed its quota of 1000 pixels"}`,
 		},
 		{
 			testName: "Too big width",
@@ -45,7 +75,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   800,
 			params:   map[string]string{"width": "20001", "height": "800"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -56,7 +86,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   50001,
 			params:   map[string]string{"width": "800", "height": "50001"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -67,7 +97,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   50001,
 			params:   map[string]string{"width": "20001", "height": "50001"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -78,7 +108,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   800,
 			params:   map[string]string{"width": "-1", "height": "800"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -89,7 +119,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   -1,
 			params:   map[string]string{"width": "800", "height": "-1"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -100,7 +130,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   -1,
 			params:   map[string]string{"width": "-1", "height": "-1"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -111,7 +141,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   1,
 			params:   map[string]string{"width": "0", "height": "1"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -122,7 +152,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   0,
 			params:   map[string]string{"width": "1", "height": "0"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -133,7 +163,7 @@ func TestHandler_CreateBMP(t *testing.T) {
 			height:   0,
 			params:   map[string]string{"width": "0", "height": "0"},
 			mockBehavior: func(service *mock_services.MockChartographerServicer, width, height int) {
-				service.EXPECT().CreateBMP(width, height).Return(0, &models.ParamsError{})
+				service.EXPECT().CreateBMP(gomock.Any(), width, height).Return("", &models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -230,12 +260,33 @@ func createRequestString(parametersMap map[string]string) string {
 	return requestString
 }
 
+type readerMatcher struct {
+	expected []byte
+}
+
+func readerWith(expected []byte) gomock.Matcher {
+	return &readerMatcher{expected: expected}
+}
+
+func (matcher *readerMatcher) Matches(x interface{}) bool {
+	reader, ok := x.(io.Reader)
+	if !ok {
+		return false
+	}
+	actual, err := ioutil.ReadAll(reader)
+	return err == nil && bytes.Equal(actual, matcher.expected)
+}
+
+func (matcher *readerMatcher) String() string {
+	return fmt.Sprintf("is a reader of %v", matcher.expected)
+}
+
 func TestHandler_UpdateBMP(t *testing.T) {
-	type mockBehavior func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte)
+	type mockBehavior func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte)
 
 	tests := []struct {
 		testName             string
-		id                   int
+		id                   string
 		xPosition            int
 		yPosition            int
 		width                int
@@ -247,7 +298,7 @@ func TestHandler_UpdateBMP(t *testing.T) {
 	}{
 		{
 			testName:  "OK",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -259,35 +310,35 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(nil)
 			},
 			expectedStatusCode:   200,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Wrong ID",
-			id:        -1,
+			id:        "42",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
 			height:    124,
 			params: map[string]string{
-				"id":     "-1",
+				"id":     "42",
 				"x":      "0",
 				"y":      "0",
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(&models.IdError{ID: -1})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(&models.IdError{ID: "42"})
 			},
 			expectedStatusCode:   404,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative width",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     -1,
@@ -299,15 +350,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "-1",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(&models.ParamsError{})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(&models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative height",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -319,15 +370,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "-1",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(&models.ParamsError{})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(&models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative width and height",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     -1,
@@ -339,15 +390,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "-1",
 				"height": "-1",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(&models.ParamsError{})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(&models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative width and positive height",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     -1,
@@ -359,15 +410,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "-1",
 				"height": "10",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(&models.ParamsError{})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(&models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Positive width and negative height",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     10,
@@ -379,15 +430,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "10",
 				"height": "-1",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(&models.ParamsError{})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(&models.ParamsError{})
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative xPosition and yPosition",
-			id:        0,
+			id:        "0",
 			xPosition: -1,
 			yPosition: -1,
 			width:     124,
@@ -399,15 +450,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(nil)
 			},
 			expectedStatusCode:   200,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative xPosition and zero yPosition",
-			id:        0,
+			id:        "0",
 			xPosition: -1,
 			yPosition: 0,
 			width:     124,
@@ -419,15 +470,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(nil)
 			},
 			expectedStatusCode:   200,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative yPosition and zero xPosition",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: -1,
 			width:     124,
@@ -439,15 +490,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(nil)
 			},
 			expectedStatusCode:   200,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Positive yPosition and xPosition",
-			id:        0,
+			id:        "0",
 			xPosition: 10,
 			yPosition: 10,
 			width:     124,
@@ -459,15 +510,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(nil)
 			},
 			expectedStatusCode:   200,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Positive yPosition and negative xPosition",
-			id:        0,
+			id:        "0",
 			xPosition: -1,
 			yPosition: 10,
 			width:     124,
@@ -479,15 +530,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(nil)
 			},
 			expectedStatusCode:   200,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Negative yPosition and positive xPosition",
-			id:        0,
+			id:        "0",
 			xPosition: 10,
 			yPosition: -1,
 			width:     124,
@@ -499,15 +550,15 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
-				service.EXPECT().UpdateBMP(id, xPosition, yPosition, width, height, receivedImage).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), id, xPosition, yPosition, width, height, readerWith(receivedImage)).Return(nil)
 			},
 			expectedStatusCode:   200,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "ID is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -519,14 +570,14 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
 		},
 		{
 			testName:  "Width and height is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     1,
@@ -538,7 +589,7 @@ func TestHandler_UpdateBMP(t *testing.T) {
 				"width":  "helloWorld",
 				"height": "helloWorld",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int, receivedImage []byte) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int, receivedImage []byte) {
 			},
 			expectedStatusCode:   400,
 			expectedResponseBody: ``,
@@ -582,6 +633,242 @@ func TestHandler_UpdateBMP(t *testing.T) {
 	}
 }
 
+func TestHandler_UpdateBMP_RawBody(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerServicer, receivedImage []byte)
+
+	tests := []struct {
+		testName             string
+		contentType          string
+		mockBehavior         mockBehavior
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			testName:    "OK",
+			contentType: "image/bmp",
+			mockBehavior: func(service *mock_services.MockChartographerServicer, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), "0", 0, 0, 1, 1, readerWith(receivedImage)).Return(nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: ``,
+		},
+		{
+			testName:    "Octet stream",
+			contentType: "application/octet-stream",
+			mockBehavior: func(service *mock_services.MockChartographerServicer, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), "0", 0, 0, 1, 1, readerWith(receivedImage)).Return(nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: ``,
+		},
+		{
+			testName:    "Size mismatch",
+			contentType: "image/bmp",
+			mockBehavior: func(service *mock_services.MockChartographerServicer, receivedImage []byte) {
+				service.EXPECT().UpdateBMP(gomock.Any(), "0", 0, 0, 1, 1, readerWith(receivedImage)).Return(&models.SizeMismatchError{ExpectedWidth: 1, ExpectedHeight: 1, ActualWidth: 2, ActualHeight: 3})
+			},
+			expectedStatusCode:   400,
+			expectedResponseBody: `{"error":"Fragment is 2x3 but width and height are 1x1"}`,
+		},
+		{
+			testName:             "Unsupported media type",
+			contentType:          "text/plain",
+			mockBehavior:         func(service *mock_services.MockChartographerServicer, receivedImage []byte) {},
+			expectedStatusCode:   415,
+			expectedResponseBody: ``,
+		},
+		{
+			testName:             "Without media type",
+			contentType:          "",
+			mockBehavior:         func(service *mock_services.MockChartographerServicer, receivedImage []byte) {},
+			expectedStatusCode:   415,
+			expectedResponseBody: ``,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			arrayToWrite := []byte{0, 1, 2, 3, 4, 5}
+			mockChartService := mock_services.NewMockChartographerServicer(c)
+			testCase.mockBehavior(mockChartService, arrayToWrite)
+			service := &services.Service{ChartographerServicer: mockChartService}
+			controller := &Controller{ChartographerController: NewChartController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/chartas/:id/", controller.UpdateBMP)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/chartas/0/?x=0&y=0&width=1&height=1", bytes.NewReader(arrayToWrite))
+			request.Header.Set("Content-Type", testCase.contentType)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.expectedResponseBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHandler_UpdateBMPBatch(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment)
+
+	arrayToWrite := []byte{0, 1, 2, 3, 4, 5}
+
+	tests := []struct {
+		testName           string
+		id                 string
+		manifest           string
+		parts              []string
+		fragments          []models.Fragment
+		mockBehavior       mockBehavior
+		expectedStatusCode int
+	}{
+		{
+			testName: "OK",
+			id:       "0",
+			manifest: `[{"part":"first","x":0,"y":0,"width":1,"height":1},{"part":"second","x":1,"y":1,"width":1,"height":1}]`,
+			parts:    []string{"first", "second"},
+			fragments: []models.Fragment{
+				{Part: "first", XPosition: 0, YPosition: 0, Width: 1, Height: 1, Data: arrayToWrite},
+				{Part: "second", XPosition: 1, YPosition: 1, Width: 1, Height: 1, Data: arrayToWrite},
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment) {
+				service.EXPECT().UpdateBMPBatch(gomock.Any(), id, fragments).Return(nil)
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			testName: "Wrong id",
+			id:       "42",
+			manifest: `[{"part":"first","x":0,"y":0,"width":1,"height":1}]`,
+			parts:    []string{"first"},
+			fragments: []models.Fragment{
+				{Part: "first", XPosition: 0, YPosition: 0, Width: 1, Height: 1, Data: arrayToWrite},
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment) {
+				service.EXPECT().UpdateBMPBatch(gomock.Any(), id, fragments).Return(&models.IdError{ID: id})
+			},
+			expectedStatusCode: 404,
+		},
+		{
+			testName: "Wrong fragment params",
+			id:       "0",
+			manifest: `[{"part":"first","x":0,"y":0,"width":-1,"height":1}]`,
+			parts:    []string{"first"},
+			fragments: []models.Fragment{
+				{Part: "first", XPosition: 0, YPosition: 0, Width: -1, Height: 1, Data: arrayToWrite},
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment) {
+				service.EXPECT().UpdateBMPBatch(gomock.Any(), id, fragments).Return(&models.ParamsError{})
+			},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Missing part",
+			id:                 "0",
+			manifest:           `[{"part":"first","x":0,"y":0,"width":1,"height":1},{"part":"second","x":1,"y":1,"width":1,"height":1}]`,
+			parts:              []string{"first"},
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Invalid manifest",
+			id:                 "0",
+			manifest:           `helloWorld`,
+			parts:              []string{"first"},
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Missing manifest",
+			id:                 "0",
+			parts:              []string{"first"},
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Invalid ID",
+			id:                 "notInteger",
+			manifest:           `[{"part":"first","x":0,"y":0,"width":1,"height":1}]`,
+			parts:              []string{"first"},
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string, fragments []models.Fragment) {},
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			buffer := bytes.NewBuffer(nil)
+			writer := multipart.NewWriter(buffer)
+			if testCase.manifest != "" {
+				err := writer.WriteField("manifest", testCase.manifest)
+				assert.NoError(t, err)
+			}
+			for _, part := range testCase.parts {
+				fw, err := writer.CreateFormFile(part, part)
+				assert.NoError(t, err)
+				_, err = fw.Write(arrayToWrite)
+				assert.NoError(t, err)
+			}
+			err := writer.Close()
+			assert.NoError(t, err)
+
+			mockChartService := mock_services.NewMockChartographerServicer(c)
+			testCase.mockBehavior(mockChartService, testCase.id, testCase.fragments)
+			service := &services.Service{ChartographerServicer: mockChartService}
+			controller := &Controller{ChartographerController: NewChartController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/chartas/:id/batch", controller.UpdateBMPBatch)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/chartas/"+testCase.id+"/batch", buffer)
+			request.Header.Set("Content-Type", writer.FormDataContentType())
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+		})
+	}
+}
+
+func TestHandler_UpdateBMPBatch_TooLarge(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	buffer := bytes.NewBuffer(nil)
+	writer := multipart.NewWriter(buffer)
+	assert.NoError(t, writer.WriteField("manifest", `[{"x":0,"y":0,"width":1,"height":1,"part":"first"}]`))
+	fw, err := writer.CreateFormFile("first", "first")
+	assert.NoError(t, err)
+	_, err = fw.Write(make([]byte, 4096))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	service := &services.Service{ChartographerServicer: mock_services.NewMockChartographerServicer(c)}
+	controller := &Controller{ChartographerController: NewChartController(service)}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// The limit is crossed before the first part is found, so the error
+	// comes wrapped by the multipart reader.
+	router.POST("/chartas/:id/batch", middlewares.BodyLimit(32), controller.UpdateBMPBatch)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/chartas/0/batch", ioutil.NopCloser(buffer))
+	request.ContentLength = -1
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
 type TestResponseRecorder struct {
 	*httptest.ResponseRecorder
 	closeChannel chan bool
@@ -603,11 +890,11 @@ func CreateTestResponseRecorder() *TestResponseRecorder {
 }
 
 func TestHandler_GetPartBMP(t *testing.T) {
-	type mockBehavior func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int)
+	type mockBehavior func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int)
 
 	tests := []struct {
 		testName           string
-		id                 int
+		id                 string
 		xPosition          int
 		yPosition          int
 		width              int
@@ -618,7 +905,7 @@ func TestHandler_GetPartBMP(t *testing.T) {
 	}{
 		{
 			testName:  "OK",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -630,36 +917,36 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
 				upLeft := image.Point{}
 				lowRight := image.Point{X: width, Y: height}
 				image := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(image, nil)
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(image, nil)
 			},
 			expectedStatusCode: 200,
 		},
 		{
 			testName:  "Wrong ID",
-			id:        -1,
+			id:        "42",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
 			height:    124,
 			params: map[string]string{
-				"id":     "-1",
+				"id":     "42",
 				"x":      "0",
 				"y":      "0",
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(nil, &models.IdError{ID: -1})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(nil, &models.IdError{ID: "42"})
 			},
 			expectedStatusCode: 404,
 		},
 		{
 			testName:  "ID is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -671,12 +958,13 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+			},
 			expectedStatusCode: 400,
 		},
 		{
 			testName:  "Negative width and positive height",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     -10,
@@ -688,14 +976,14 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "-10",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(nil, &models.ParamsError{})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(nil, &models.ParamsError{})
 			},
 			expectedStatusCode: 400,
 		},
 		{
 			testName:  "Positive width and negative height",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -707,14 +995,14 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "-10",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(nil, &models.ParamsError{})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(nil, &models.ParamsError{})
 			},
 			expectedStatusCode: 400,
 		},
 		{
 			testName:  "Negative x and y",
-			id:        0,
+			id:        "0",
 			xPosition: -1,
 			yPosition: -1,
 			width:     124,
@@ -726,17 +1014,17 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
 				upLeft := image.Point{}
 				lowRight := image.Point{X: width, Y: height}
 				image := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(image, nil)
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(image, nil)
 			},
 			expectedStatusCode: 200,
 		},
 		{
 			testName:  "Negative x and positive y",
-			id:        0,
+			id:        "0",
 			xPosition: -1,
 			yPosition: 1,
 			width:     124,
@@ -748,17 +1036,17 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
 				upLeft := image.Point{}
 				lowRight := image.Point{X: width, Y: height}
 				image := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(image, nil)
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(image, nil)
 			},
 			expectedStatusCode: 200,
 		},
 		{
 			testName:  "Positive x and negative y",
-			id:        0,
+			id:        "0",
 			xPosition: 1,
 			yPosition: -1,
 			width:     124,
@@ -770,17 +1058,17 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
 				upLeft := image.Point{}
 				lowRight := image.Point{X: width, Y: height}
 				image := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(image, nil)
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(image, nil)
 			},
 			expectedStatusCode: 200,
 		},
 		{
 			testName:  "Positive x and y",
-			id:        0,
+			id:        "0",
 			xPosition: 1,
 			yPosition: 1,
 			width:     124,
@@ -792,17 +1080,17 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
 				upLeft := image.Point{}
 				lowRight := image.Point{X: width, Y: height}
 				image := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(image, nil)
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(image, nil)
 			},
 			expectedStatusCode: 200,
 		},
 		{
 			testName:  "Zero x and y",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -814,17 +1102,17 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
 				upLeft := image.Point{}
 				lowRight := image.Point{X: width, Y: height}
 				image := image.NewRGBA(image.Rectangle{Min: upLeft, Max: lowRight})
-				service.EXPECT().GetPartBMP(id, xPosition, yPosition, width, height).Return(image, nil)
+				service.EXPECT().GetPartBMP(gomock.Any(), id, xPosition, yPosition, width, height).Return(image, nil)
 			},
 			expectedStatusCode: 200,
 		},
 		{
 			testName:  "Width is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     0,
@@ -836,12 +1124,13 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "notInteger",
 				"height": "124",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+			},
 			expectedStatusCode: 400,
 		},
 		{
 			testName:  "Height is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -853,12 +1142,13 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "notInteger",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+			},
 			expectedStatusCode: 400,
 		},
 		{
 			testName:  "x is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -870,12 +1160,13 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+			},
 			expectedStatusCode: 400,
 		},
 		{
 			testName:  "y is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -887,12 +1178,13 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "124",
 				"height": "124",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+			},
 			expectedStatusCode: 400,
 		},
 		{
 			testName:  "Width and height is not a integer",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     1,
@@ -904,7 +1196,8 @@ func TestHandler_GetPartBMP(t *testing.T) {
 				"width":  "helloWorld",
 				"height": "helloWorld",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id, xPosition, yPosition, width, height int) {},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, xPosition, yPosition, width, height int) {
+			},
 			expectedStatusCode: 400,
 		},
 	}
@@ -934,54 +1227,232 @@ func TestHandler_GetPartBMP(t *testing.T) {
 	}
 }
 
+func TestHandler_GetPartsBMP(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerServicer, id string, regions []models.Region)
+
+	tests := []struct {
+		testName           string
+		id                 string
+		body               string
+		regions            []models.Region
+		mockBehavior       mockBehavior
+		expectedStatusCode int
+		expectedPartsCount int
+		expectedTruncated  bool
+	}{
+		{
+			testName: "OK",
+			id:       "0",
+			body:     `[{"x":0,"y":0,"width":1,"height":1},{"x":1,"y":1,"width":2,"height":2}]`,
+			regions: []models.Region{
+				{XPosition: 0, YPosition: 0, Width: 1, Height: 1},
+				{XPosition: 1, YPosition: 1, Width: 2, Height: 2},
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, regions []models.Region) {
+				service.EXPECT().GetPartsBMP(gomock.Any(), id, regions, gomock.Any()).DoAndReturn(
+					func(ctx context.Context, id string, regions []models.Region, write func(int, image.Image) error) error {
+						for ind, region := range regions {
+							if err := write(ind, image.NewRGBA(image.Rect(0, 0, region.Width, region.Height))); err != nil {
+								return err
+							}
+						}
+						return nil
+					})
+			},
+			expectedStatusCode: 200,
+			expectedPartsCount: 2,
+		},
+		{
+			testName: "Failure after the first part",
+			id:       "0",
+			body:     `[{"x":0,"y":0,"width":1,"height":1},{"x":1,"y":1,"width":2,"height":2}]`,
+			regions: []models.Region{
+				{XPosition: 0, YPosition: 0, Width: 1, Height: 1},
+				{XPosition: 1, YPosition: 1, Width: 2, Height: 2},
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, regions []models.Region) {
+				service.EXPECT().GetPartsBMP(gomock.Any(), id, regions, gomock.Any()).DoAndReturn(
+					func(ctx context.Context, id string, regions []models.Region, write func(int, image.Image) error) error {
+						if err := write(0, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+							return err
+						}
+						return errors.New("disk failed")
+					})
+			},
+			expectedStatusCode: 200,
+			expectedPartsCount: 1,
+			expectedTruncated:  true,
+		},
+		{
+			testName: "Wrong id",
+			id:       "42",
+			body:     `[{"x":0,"y":0,"width":1,"height":1}]`,
+			regions: []models.Region{
+				{XPosition: 0, YPosition: 0, Width: 1, Height: 1},
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, regions []models.Region) {
+				service.EXPECT().GetPartsBMP(gomock.Any(), id, regions, gomock.Any()).Return(&models.IdError{ID: id})
+			},
+			expectedStatusCode: 404,
+		},
+		{
+			testName: "Too big width",
+			id:       "0",
+			body:     `[{"x":0,"y":0,"width":5001,"height":1}]`,
+			regions: []models.Region{
+				{XPosition: 0, YPosition: 0, Width: 5001, Height: 1},
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string, regions []models.Region) {
+				service.EXPECT().GetPartsBMP(gomock.Any(), id, regions, gomock.Any()).Return(&models.ParamsError{})
+			},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Invalid body",
+			id:                 "0",
+			body:               `helloWorld`,
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string, regions []models.Region) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Invalid ID",
+			id:                 "notInteger",
+			body:               `[{"x":0,"y":0,"width":1,"height":1}]`,
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string, regions []models.Region) {},
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockChartService := mock_services.NewMockChartographerServicer(c)
+			testCase.mockBehavior(mockChartService, testCase.id, testCase.regions)
+			service := &services.Service{ChartographerServicer: mockChartService}
+			controller := &Controller{ChartographerController: NewChartController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/chartas/:id/regions", controller.GetPartsBMP)
+
+			recorder := CreateTestResponseRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/chartas/"+testCase.id+"/regions", strings.NewReader(testCase.body))
+			request.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			if testCase.expectedStatusCode != http.StatusOK {
+				return
+			}
+
+			mediaType, params, err := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+			assert.NoError(t, err)
+			assert.Equal(t, "multipart/mixed", mediaType)
+			reader := multipart.NewReader(recorder.Body, params["boundary"])
+			partsCount := 0
+			for {
+				part, err := reader.NextPart()
+				if err == io.EOF {
+					assert.False(t, testCase.expectedTruncated)
+					break
+				}
+				if testCase.expectedTruncated && err != nil {
+					break
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, "image/bmp", part.Header.Get("Content-Type"))
+				receivedImage, err := bmp.Decode(part)
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.regions[partsCount].Width, receivedImage.Bounds().Dx())
+				assert.Equal(t, testCase.regions[partsCount].Height, receivedImage.Bounds().Dy())
+				partsCount++
+			}
+			assert.Equal(t, testCase.expectedPartsCount, partsCount)
+		})
+	}
+}
+
 func TestHandler_DeleteBMP(t *testing.T) {
-	type mockBehavior func(service *mock_services.MockChartographerServicer, id int)
+	type mockBehavior func(service *mock_services.MockChartographerServicer, id string)
 
 	tests := []struct {
 		testName           string
-		id                 int
+		id                 string
 		params             map[string]string
 		mockBehavior       mockBehavior
 		expectedStatusCode int
 	}{
 		{
 			testName: "OK",
-			id:       0,
+			id:       "0",
 			params: map[string]string{
 				"id": "0",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id int) {
-				service.EXPECT().DeleteBMP(id).Return(nil)
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string) {
+				service.EXPECT().DeleteBMP(gomock.Any(), id).Return(nil)
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			testName: "UUID in upper case",
+			id:       "0190c6a4-3b1e-7c2d-8e4f-5a6b7c8d9e0f",
+			params: map[string]string{
+				"id": "0190C6A4-3B1E-7C2D-8E4F-5A6B7C8D9E0F",
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string) {
+				service.EXPECT().DeleteBMP(gomock.Any(), id).Return(nil)
 			},
 			expectedStatusCode: 200,
 		},
 		{
 			testName: "Wrong id",
-			id:       -1,
+			id:       "42",
 			params: map[string]string{
-				"id": "-1",
+				"id": "42",
 			},
-			mockBehavior: func(service *mock_services.MockChartographerServicer, id int) {
-				service.EXPECT().DeleteBMP(id).Return(&models.IdError{ID: -1})
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string) {
+				service.EXPECT().DeleteBMP(gomock.Any(), id).Return(&models.IdError{ID: "42"})
 			},
 			expectedStatusCode: 404,
 		},
 		{
-			testName: "ID is not a integer",
-			id:       0,
+			testName: "Integer id with leading zeros",
+			id:       "0",
+			params: map[string]string{
+				"id": "007",
+			},
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName: "Permission denied",
+			id:       "0",
+			params: map[string]string{
+				"id": "0",
+			},
+			mockBehavior: func(service *mock_services.MockChartographerServicer, id string) {
+				service.EXPECT().DeleteBMP(gomock.Any(), id).Return(&models.PermissionError{ID: id, Permission: models.PermissionDelete})
+			},
+			expectedStatusCode: 403,
+		},
+		{
+			testName: "Invalid ID",
+			id:       "0",
 			params: map[string]string{
 				"id": "notInteger",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id int) {},
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string) {},
 			expectedStatusCode: 400,
 		},
 		{
 			testName: "Empty ID",
-			id:       0,
+			id:       "0",
 			params: map[string]string{
 				"id": "",
 			},
-			mockBehavior:       func(service *mock_services.MockChartographerServicer, id int) {},
+			mockBehavior:       func(service *mock_services.MockChartographerServicer, id string) {},
 			expectedStatusCode: 400,
 		},
 	}
@@ -1010,3 +1481,61 @@ func TestHandler_DeleteBMP(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_ListBMP(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerServicer)
+
+	tests := []struct {
+		testName             string
+		mockBehavior         mockBehavior
+		expectedStatusCode   int
+		expectedResponseBody string
+	}{
+		{
+			testName: "OK",
+			mockBehavior: func(service *mock_services.MockChartographerServicer) {
+				service.EXPECT().ListBMP(gomock.Any()).Return([]models.ImageInfo{{ID: "0", Width: 10, Height: 20, Owner: "alice"}}, nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: `[{"id":"0","width":10,"height":20,"owner":"alice"}]`,
+		},
+		{
+			testName: "Empty",
+			mockBehavior: func(service *mock_services.MockChartographerServicer) {
+				service.EXPECT().ListBMP(gomock.Any()).Return([]models.ImageInfo{}, nil)
+			},
+			expectedStatusCode:   200,
+			expectedResponseBody: `[]`,
+		},
+		{
+			testName: "Failed",
+			mockBehavior: func(service *mock_services.MockChartographerServicer) {
+				service.EXPECT().ListBMP(gomock.Any()).Return(nil, fmt.Errorf("disk failure"))
+			},
+			expectedStatusCode: 500,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockChartService := mock_services.NewMockChartographerServicer(c)
+			testCase.mockBehavior(mockChartService)
+			service := &services.Service{ChartographerServicer: mockChartService}
+			controller := &Controller{ChartographerController: NewChartController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/chartas/", controller.ListBMP)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/chartas/", nil)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.expectedResponseBody, recorder.Body.String())
+		})
+	}
+}
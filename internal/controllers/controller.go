@@ -8,14 +8,57 @@ import (
 type ChartographerController interface {
 	CreateBMP(context *gin.Context)
 	UpdateBMP(context *gin.Context)
+	UpdateBMPBatch(context *gin.Context)
 	GetPartBMP(context *gin.Context)
+	GetPartsBMP(context *gin.Context)
+	ListBMP(context *gin.Context)
 	DeleteBMP(context *gin.Context)
 }
 
+type ChartographerUploadController interface {
+	CreateUpload(context *gin.Context)
+	GetUploadOffset(context *gin.Context)
+	WriteUploadChunk(context *gin.Context)
+	DeleteUpload(context *gin.Context)
+}
+
+type ChartographerAccessController interface {
+	GetACL(context *gin.Context)
+	GrantAccess(context *gin.Context)
+	RevokeAccess(context *gin.Context)
+}
+
+type ChartographerQuotaController interface {
+	GetQuota(context *gin.Context)
+}
+
+type ChartographerProjectController interface {
+	ListProjects(context *gin.Context)
+	CreateProject(context *gin.Context)
+}
+
+type ChartographerAdminController interface {
+	GetCacheStats(context *gin.Context)
+	VerifyStorage(context *gin.Context)
+	Reconcile(context *gin.Context)
+	QueryAudit(context *gin.Context)
+}
+
 type Controller struct {
 	ChartographerController
+	ChartographerUploadController
+	ChartographerAccessController
+	ChartographerQuotaController
+	ChartographerProjectController
+	ChartographerAdminController
 }
 
 func NewController(service *services.Service) *Controller {
-	return &Controller{ChartographerController: NewChartController(service.ChartographerServicer)}
+	return &Controller{
+		ChartographerController:        NewChartController(service.ChartographerServicer),
+		ChartographerUploadController:  NewUploadController(service.ChartographerUploader),
+		ChartographerAccessController:  NewAccessController(service.ChartographerAccessManager),
+		ChartographerQuotaController:   NewQuotaController(service.ChartographerQuotaReporter),
+		ChartographerProjectController: NewProjectController(service.ChartographerProjectManager),
+		ChartographerAdminController:   NewAdminController(service.ChartographerAdministrator)}
 }
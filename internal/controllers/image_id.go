@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/utils"
+	"strings"
+)
+
+// parseImageID reads the id of an image from the path. UUIDs are accepted
+// in any case; integer ids of images created in the compatibility mode
+// are accepted as they are.
+func parseImageID(param string) (string, error) {
+	id := strings.ToLower(param)
+	if !utils.IsValidID(id) {
+		return "", &models.ParamsError{}
+	}
+
+	return id, nil
+}
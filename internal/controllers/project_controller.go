@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"net/http"
+)
+
+type ProjectController struct {
+	projectService services.ChartographerProjectManager
+}
+
+func NewProjectController(projectService services.ChartographerProjectManager) *ProjectController {
+	return &ProjectController{projectService: projectService}
+}
+
+func (projectController *ProjectController) ListProjects(context *gin.Context) {
+	projects, err := projectController.projectService.ListProjects(context.Request.Context())
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, projects)
+}
+
+func (projectController *ProjectController) CreateProject(context *gin.Context) {
+	err := projectController.projectService.CreateProject(context.Request.Context(), context.Param("project"))
+	if err != nil {
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		case *models.ProjectExistsError:
+			context.AbortWithError(http.StatusConflict, err)
+			return
+		case *models.ProjectLimitError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusInsufficientStorage, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	context.Status(http.StatusCreated)
+}
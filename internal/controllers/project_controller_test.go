@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/pmokeev/chartographer/internal/services/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_ListProjects(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	mockProjectService := mock_services.NewMockChartographerProjectManager(c)
+	mockProjectService.EXPECT().ListProjects(gomock.Any()).Return([]string{"dig-a", "dig-b"}, nil)
+	service := &services.Service{ChartographerProjectManager: mockProjectService}
+	controller := &Controller{ChartographerProjectController: NewProjectController(service)}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/projects", controller.ListProjects)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/projects", nil)
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, `["dig-a","dig-b"]`, recorder.Body.String())
+}
+
+func TestHandler_CreateProject(t *testing.T) {
+	tests := []struct {
+		testName       string
+		project        string
+		err            error
+		expectedStatus int
+	}{
+		{
+			testName:       "Created",
+			project:        "dig-a",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			testName:       "Invalid name",
+			project:        "Dig",
+			err:            &models.ParamsError{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			testName:       "Exists",
+			project:        "dig-a",
+			err:            &models.ProjectExistsError{Name: "dig-a"},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			testName:       "Too many projects",
+			project:        "dig-b",
+			err:            &models.ProjectLimitError{Limit: 1},
+			expectedStatus: http.StatusInsufficientStorage,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockProjectService := mock_services.NewMockChartographerProjectManager(c)
+			mockProjectService.EXPECT().CreateProject(gomock.Any(), test.project).Return(test.err)
+			service := &services.Service{ChartographerProjectManager: mockProjectService}
+			controller := &Controller{ChartographerProjectController: NewProjectController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/projects/:project", controller.CreateProject)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/projects/"+test.project, nil)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, test.expectedStatus, recorder.Code)
+		})
+	}
+}
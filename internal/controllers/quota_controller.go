@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/services"
+	"net/http"
+)
+
+type QuotaController struct {
+	quotaService services.ChartographerQuotaReporter
+}
+
+func NewQuotaController(quotaService services.ChartographerQuotaReporter) *QuotaController {
+	return &QuotaController{quotaService: quotaService}
+}
+
+func (quotaController *QuotaController) GetQuota(context *gin.Context) {
+	context.JSON(http.StatusOK, quotaController.quotaService.GetQuota(context.Request.Context()))
+}
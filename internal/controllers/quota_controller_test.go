@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/pmokeev/chartographer/internal/services/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_GetQuota(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	mockQuotaService := mock_services.NewMockChartographerQuotaReporter(c)
+	mockQuotaService.EXPECT().GetQuota(gomock.Any()).Return(models.QuotaReport{
+		Tenant: "lab",
+		Usage:  models.QuotaUsage{Images: 1, Pixels: 100, Bytes: 454},
+		Limits: models.Quota{MaxImages: 10},
+	})
+	service := &services.Service{ChartographerQuotaReporter: mockQuotaService}
+	controller := &Controller{ChartographerQuotaController: NewQuotaController(service)}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/quota", controller.GetQuota)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/quota", nil)
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, `{"tenant":"lab","usage":{"images":1,"pixels":100,"bytes":454},"limits":{"max_images":10,"max_pixels":0,"max_bytes":0}}`, recorder.Body.String())
+}
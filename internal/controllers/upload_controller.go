@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"net/http"
+	"strconv"
+)
+
+type UploadController struct {
+	uploadService services.ChartographerUploader
+}
+
+func NewUploadController(uploadService services.ChartographerUploader) *UploadController {
+	return &UploadController{uploadService: uploadService}
+}
+
+func (uploadController *UploadController) CreateUpload(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	xPosition, xPositionOk := context.GetQuery("x")
+	yPosition, yPositionOk := context.GetQuery("y")
+	width, widthOk := context.GetQuery("width")
+	height, heightOk := context.GetQuery("height")
+	size, sizeOk := context.GetQuery("size")
+	checksum, checksumOk := context.GetQuery("checksum")
+	if !widthOk || !heightOk || !xPositionOk || !yPositionOk || !sizeOk || !checksumOk {
+		context.AbortWithError(http.StatusBadRequest, &models.ParamsError{})
+		return
+	}
+	widthInt, err := strconv.Atoi(width)
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	heightInt, err := strconv.Atoi(height)
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	xPositionInt, err := strconv.Atoi(xPosition)
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	yPositionInt, err := strconv.Atoi(yPosition)
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	sizeInt, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	uploadID, err := uploadController.uploadService.CreateUpload(context.Request.Context(), imageID, xPositionInt, yPositionInt, widthInt, heightInt, sizeInt, checksum)
+	if err != nil {
+		var limitErr *models.SizeLimitError
+		if errors.As(err, &limitErr) {
+			context.AbortWithError(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		switch err.(type) {
+		case *models.ParamsError:
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		case *models.IdError:
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		case *models.QuotaError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusInsufficientStorage, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	context.Header("Location", context.Request.URL.Path+uploadID)
+	context.JSON(http.StatusCreated, map[string]string{
+		"id": uploadID,
+	})
+}
+
+func (uploadController *UploadController) GetUploadOffset(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	offset, size, err := uploadController.uploadService.GetUploadOffset(context.Request.Context(), imageID, context.Param("upload"))
+	if err != nil {
+		switch err.(type) {
+		case *models.UploadIdError:
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	context.Header("Cache-Control", "no-store")
+	context.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	context.Header("Upload-Length", strconv.FormatInt(size, 10))
+	context.AbortWithStatus(http.StatusOK)
+}
+
+func (uploadController *UploadController) WriteUploadChunk(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	offset, err := strconv.ParseInt(context.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	offset, completed, err := uploadController.uploadService.WriteUploadChunk(context.Request.Context(), imageID, context.Param("upload"), offset, context.Request.Body)
+	context.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil {
+		var limitErr *models.SizeLimitError
+		if errors.As(err, &limitErr) {
+			context.AbortWithError(http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		switch err.(type) {
+		case *models.ParamsError, *models.ChecksumError:
+			context.AbortWithError(http.StatusBadRequest, err)
+			return
+		case *models.IdError, *models.UploadIdError:
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		case *models.OffsetError:
+			context.AbortWithError(http.StatusConflict, err)
+			return
+		case *models.SizeMismatchError:
+			context.Error(err)
+			context.AbortWithStatusJSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if completed {
+		context.AbortWithStatus(http.StatusOK)
+		return
+	}
+	context.AbortWithStatus(http.StatusNoContent)
+}
+
+func (uploadController *UploadController) DeleteUpload(context *gin.Context) {
+	imageID, err := parseImageID(context.Param("id"))
+	if err != nil {
+		context.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	if err := uploadController.uploadService.DeleteUpload(context.Request.Context(), imageID, context.Param("upload")); err != nil {
+		switch err.(type) {
+		case *models.UploadIdError:
+			context.AbortWithError(http.StatusNotFound, err)
+			return
+		case *models.PermissionError:
+			context.AbortWithError(http.StatusForbidden, err)
+			return
+		default:
+			context.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	context.AbortWithStatus(http.StatusOK)
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/pmokeev/chartographer/internal/services/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_CreateUpload(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerUploader)
+
+	tests := []struct {
+		testName             string
+		target               string
+		mockBehavior         mockBehavior
+		expectedStatusCode   int
+		expectedLocation     string
+		expectedResponseBody string
+	}{
+		{
+			testName: "OK",
+			target:   "/chartas/0/uploads/?x=1&y=2&width=3&height=4&size=5&checksum=abc",
+			mockBehavior: func(service *mock_services.MockChartographerUploader) {
+				service.EXPECT().CreateUpload(gomock.Any(), "0", 1, 2, 3, 4, int64(5), "abc").Return("upload", nil)
+			},
+			expectedStatusCode:   201,
+			expectedLocation:     "/chartas/0/uploads/upload",
+			expectedResponseBody: `{"id":"upload"}`,
+		},
+		{
+			testName: "Wrong id",
+			target:   "/chartas/1/uploads/?x=1&y=2&width=3&height=4&size=5&checksum=abc",
+			mockBehavior: func(service *mock_services.MockChartographerUploader) {
+				service.EXPECT().CreateUpload(gomock.Any(), "1", 1, 2, 3, 4, int64(5), "abc").Return("", &models.IdError{ID: "1"})
+			},
+			expectedStatusCode: 404,
+		},
+		{
+			testName: "Wrong params",
+			target:   "/chartas/0/uploads/?x=1&y=2&width=3&height=4&size=0&checksum=abc",
+			mockBehavior: func(service *mock_services.MockChartographerUploader) {
+				service.EXPECT().CreateUpload(gomock.Any(), "0", 1, 2, 3, 4, int64(0), "abc").Return("", &models.ParamsError{})
+			},
+			expectedStatusCode: 400,
+		},
+		{
+			testName: "Size above limit",
+			target:   "/chartas/0/uploads/?x=1&y=2&width=3&height=4&size=5&checksum=abc",
+			mockBehavior: func(service *mock_services.MockChartographerUploader) {
+				service.EXPECT().CreateUpload(gomock.Any(), "0", 1, 2, 3, 4, int64(5), "abc").Return("", &models.SizeLimitError{Limit: 4})
+			},
+			expectedStatusCode: 413,
+		},
+		{
+			testName: "Quota exceeded",
+			target:   "/chartas/0/uploads/?x=1&y=2&width=3&height=4&size=5&checksum=abc",
+			mockBehavior: func(service *mock_services.MockChartographerUploader) {
+				service.EXPECT().CreateUpload(gomock.Any(), "0", 1, 2, 3, 4, int64(5), "abc").Return("", &models.QuotaError{Tenant: "lab", Resource: "bytes", Limit: 4})
+			},
+			expectedStatusCode:   507,
+			expectedResponseBody: `{"error":"Tenant lab would exceed its quota of 4 bytes"}`,
+		},
+		{
+			testName: "Permission denied",
+			target:   "/chartas/0/uploads/?x=1&y=2&width=3&height=4&size=5&checksum=abc",
+			mockBehavior: func(service *mock_services.MockChartographerUploader) {
+				service.EXPECT().CreateUpload(gomock.Any(), "0", 1, 2, 3, 4, int64(5), "abc").Return("", &models.PermissionError{ID: "0", Permission: models.PermissionWrite})
+			},
+			expectedStatusCode: 403,
+		},
+		{
+			testName:           "Without checksum",
+			target:             "/chartas/0/uploads/?x=1&y=2&width=3&height=4&size=5",
+			mockBehavior:       func(service *mock_services.MockChartographerUploader) {},
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Size is not a integer",
+			target:             "/chartas/0/uploads/?x=1&y=2&width=3&height=4&size=helloWorld&checksum=abc",
+			mockBehavior:       func(service *mock_services.MockChartographerUploader) {},
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			mockUploadService := mock_services.NewMockChartographerUploader(c)
+			testCase.mockBehavior(mockUploadService)
+			service := &services.Service{ChartographerUploader: mockUploadService}
+			controller := &Controller{ChartographerUploadController: NewUploadController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/chartas/:id/uploads/", controller.CreateUpload)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, testCase.target, nil)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.expectedLocation, recorder.Header().Get("Location"))
+			assert.Equal(t, testCase.expectedResponseBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHandler_WriteUploadChunk(t *testing.T) {
+	type mockBehavior func(service *mock_services.MockChartographerUploader, chunk []byte)
+
+	tests := []struct {
+		testName           string
+		target             string
+		offset             string
+		mockBehavior       mockBehavior
+		expectedStatusCode int
+		expectedOffset     string
+	}{
+		{
+			testName: "Chunk written",
+			target:   "/chartas/0/uploads/upload",
+			offset:   "0",
+			mockBehavior: func(service *mock_services.MockChartographerUploader, chunk []byte) {
+				service.EXPECT().WriteUploadChunk(gomock.Any(), "0", "upload", int64(0), gomock.Any()).Return(int64(len(chunk)), false, nil)
+			},
+			expectedStatusCode: 204,
+			expectedOffset:     "6",
+		},
+		{
+			testName: "Upload completed",
+			target:   "/chartas/0/uploads/upload",
+			offset:   "6",
+			mockBehavior: func(service *mock_services.MockChartographerUploader, chunk []byte) {
+				service.EXPECT().WriteUploadChunk(gomock.Any(), "0", "upload", int64(6), gomock.Any()).Return(int64(12), true, nil)
+			},
+			expectedStatusCode: 200,
+			expectedOffset:     "12",
+		},
+		{
+			testName: "Wrong offset",
+			target:   "/chartas/0/uploads/upload",
+			offset:   "3",
+			mockBehavior: func(service *mock_services.MockChartographerUploader, chunk []byte) {
+				service.EXPECT().WriteUploadChunk(gomock.Any(), "0", "upload", int64(3), gomock.Any()).Return(int64(6), false, &models.OffsetError{Expected: 6, Actual: 3})
+			},
+			expectedStatusCode: 409,
+			expectedOffset:     "6",
+		},
+		{
+			testName: "Wrong checksum",
+			target:   "/chartas/0/uploads/upload",
+			offset:   "6",
+			mockBehavior: func(service *mock_services.MockChartographerUploader, chunk []byte) {
+				service.EXPECT().WriteUploadChunk(gomock.Any(), "0", "upload", int64(6), gomock.Any()).Return(int64(12), false, &models.ChecksumError{})
+			},
+			expectedStatusCode: 400,
+			expectedOffset:     "12",
+		},
+		{
+			testName: "Wrong upload id",
+			target:   "/chartas/0/uploads/unknown",
+			offset:   "0",
+			mockBehavior: func(service *mock_services.MockChartographerUploader, chunk []byte) {
+				service.EXPECT().WriteUploadChunk(gomock.Any(), "0", "unknown", int64(0), gomock.Any()).Return(int64(0), false, &models.UploadIdError{ID: "unknown"})
+			},
+			expectedStatusCode: 404,
+			expectedOffset:     "0",
+		},
+		{
+			testName:           "Offset is not a integer",
+			target:             "/chartas/0/uploads/upload",
+			offset:             "helloWorld",
+			mockBehavior:       func(service *mock_services.MockChartographerUploader, chunk []byte) {},
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			chunk := []byte{0, 1, 2, 3, 4, 5}
+			mockUploadService := mock_services.NewMockChartographerUploader(c)
+			testCase.mockBehavior(mockUploadService, chunk)
+			service := &services.Service{ChartographerUploader: mockUploadService}
+			controller := &Controller{ChartographerUploadController: NewUploadController(service)}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.PATCH("/chartas/:id/uploads/:upload", controller.WriteUploadChunk)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPatch, testCase.target, bytes.NewReader(chunk))
+			request.Header.Set("Upload-Offset", testCase.offset)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.expectedOffset, recorder.Header().Get("Upload-Offset"))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Formats of log lines.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+type loggerKey struct{}
+
+// New returns a logger writing lines of the format to stderr, skipping
+// lines below the level, one of debug, info, warn and error.
+func New(level, format string) (*zap.Logger, error) {
+	var config zap.Config
+	switch format {
+	case FormatJSON:
+		config = zap.NewProductionConfig()
+		config.EncoderConfig.TimeKey = "time"
+		config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	case FormatConsole:
+		config = zap.NewDevelopmentConfig()
+		config.Development = false
+	default:
+		return nil, fmt.Errorf("unknown log format %s", format)
+	}
+
+	atomicLevel, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("unknown log level %s", level)
+	}
+	config.Level = atomicLevel
+	config.Sampling = nil
+	config.DisableStacktrace = true
+
+	return config.Build()
+}
+
+// WithLogger makes the services called with ctx log through logger, which
+// carries the fields of the request.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the request, or the global logger
+// outside of requests.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+
+	return zap.L()
+}
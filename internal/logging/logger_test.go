@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		testName      string
+		level         string
+		format        string
+		expectedLevel zapcore.Level
+		expectedError bool
+	}{
+		{
+			testName:      "JSON",
+			level:         "info",
+			format:        FormatJSON,
+			expectedLevel: zapcore.InfoLevel,
+		},
+		{
+			testName:      "Console",
+			level:         "debug",
+			format:        FormatConsole,
+			expectedLevel: zapcore.DebugLevel,
+		},
+		{
+			testName:      "Unknown level",
+			level:         "verbose",
+			format:        FormatJSON,
+			expectedError: true,
+		},
+		{
+			testName:      "Unknown format",
+			level:         "info",
+			format:        "xml",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			logger, err := New(test.level, test.format)
+			if test.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, logger.Core().Enabled(test.expectedLevel))
+			assert.False(t, logger.Core().Enabled(test.expectedLevel-1))
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, zap.L(), FromContext(context.Background()))
+
+	logger := zap.NewExample()
+	assert.Equal(t, logger, FromContext(WithLogger(context.Background(), logger)))
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const namespace = "chartographer"
+
+// Kinds of decoded and encoded BMPs.
+const (
+	KindCanvas   = "canvas"
+	KindFragment = "fragment"
+)
+
+// Modes of image locks.
+const (
+	ModeRead  = "read"
+	ModeWrite = "write"
+)
+
+// durationBuckets span a millisecond to half a minute, as decoding a
+// canvas takes from next to nothing to many seconds for the largest ones.
+var durationBuckets = prometheus.ExponentialBuckets(0.001, 2, 16)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latencies of HTTP requests by method, route and status.",
+		Buckets:   durationBuckets,
+	}, []string{"method", "route", "status"})
+
+	DecodeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bmp_decode_duration_seconds",
+		Help:      "Time spent decoding canvases and fragments.",
+		Buckets:   durationBuckets,
+	}, []string{"kind"})
+	EncodeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bmp_encode_duration_seconds",
+		Help:      "Time spent encoding canvases.",
+		Buckets:   durationBuckets,
+	}, []string{"kind"})
+	LockWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_lock_wait_seconds",
+		Help:      "Time spent waiting for the lock of an image by lock mode.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"mode"})
+
+	CanvasesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "canvases_created_total",
+		Help:      "Canvases created.",
+	})
+	CanvasesDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "canvases_deleted_total",
+		Help:      "Canvases deleted.",
+	})
+	WorkersBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_busy",
+		Help:      "Worker goroutines processing pixels right now.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(HTTPRequests, HTTPRequestDuration, DecodeDuration, EncodeDuration, LockWait, CanvasesCreated, CanvasesDeleted, WorkersBusy)
+}
+
+// ObserveSince records the time elapsed since start in seconds.
+func ObserveSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
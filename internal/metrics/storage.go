@@ -0,0 +1,40 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Usage is what the stored canvases take up. Bytes include staged uploads.
+type Usage struct {
+	Canvases int64
+	Pixels   int64
+	Bytes    int64
+}
+
+// StorageCollector reports the usage of the storage on every scrape, so the
+// gauges are never out of step with the service.
+type StorageCollector struct {
+	usage    func() Usage
+	canvases *prometheus.Desc
+	pixels   *prometheus.Desc
+	bytes    *prometheus.Desc
+}
+
+func NewStorageCollector(usage func() Usage) *StorageCollector {
+	return &StorageCollector{
+		usage:    usage,
+		canvases: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "canvases"), "Stored canvases.", nil, nil),
+		pixels:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "stored_pixels"), "Pixels of the stored canvases.", nil, nil),
+		bytes:    prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "stored_bytes"), "Bytes the stored canvases and staged uploads take on disk.", nil, nil)}
+}
+
+func (collector *StorageCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- collector.canvases
+	descs <- collector.pixels
+	descs <- collector.bytes
+}
+
+func (collector *StorageCollector) Collect(collected chan<- prometheus.Metric) {
+	usage := collector.usage()
+	collected <- prometheus.MustNewConstMetric(collector.canvases, prometheus.GaugeValue, float64(usage.Canvases))
+	collected <- prometheus.MustNewConstMetric(collector.pixels, prometheus.GaugeValue, float64(usage.Pixels))
+	collected <- prometheus.MustNewConstMetric(collector.bytes, prometheus.GaugeValue, float64(usage.Bytes))
+}
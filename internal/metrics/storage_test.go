@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestStorageCollector(t *testing.T) {
+	usage := Usage{Canvases: 2, Pixels: 300, Bytes: 1254}
+	collector := NewStorageCollector(func() Usage {
+		return usage
+	})
+
+	expected := `
+# HELP chartographer_canvases Stored canvases.
+# TYPE chartographer_canvases gauge
+chartographer_canvases 2
+# HELP chartographer_stored_bytes Bytes the stored canvases and staged uploads take on disk.
+# TYPE chartographer_stored_bytes gauge
+chartographer_stored_bytes 1254
+# HELP chartographer_stored_pixels Pixels of the stored canvases.
+# TYPE chartographer_stored_pixels gauge
+chartographer_stored_pixels 300
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+
+	usage.Canvases = 1
+	expected = `
+# HELP chartographer_canvases Stored canvases.
+# TYPE chartographer_canvases gauge
+chartographer_canvases 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "chartographer_canvases"))
+}
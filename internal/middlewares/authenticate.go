@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"net/http"
+	"strings"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	bearerPrefix = "Bearer "
+)
+
+// Authenticate resolves the bearer token or the API key of the request to
+// its principal. Requests without valid credentials are rejected with 401.
+func Authenticate(authenticator auth.Authenticator) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		credentials := context.GetHeader(APIKeyHeader)
+		authorization := context.GetHeader("Authorization")
+		if credentials == "" && len(authorization) > len(bearerPrefix) && strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+			credentials = authorization[len(bearerPrefix):]
+		}
+		if credentials == "" {
+			context.Header("WWW-Authenticate", `Bearer realm="chartographer"`)
+			context.AbortWithError(http.StatusUnauthorized, errors.New("no credentials"))
+			return
+		}
+
+		principal, err := authenticator.Authenticate(credentials)
+		if err != nil {
+			context.Header("WWW-Authenticate", `Bearer realm="chartographer", error="invalid_token"`)
+			context.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+
+		context.Request = context.Request.WithContext(auth.WithPrincipal(context.Request.Context(), principal))
+		context.Next()
+	}
+}
+
+// RequireRole rejects requests of principals without the role with 403.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		principal, _ := auth.PrincipalFromContext(context.Request.Context())
+		if !principal.HasRole(role) {
+			context.AbortWithError(http.StatusForbidden, fmt.Errorf("principal %q lacks role %s", principal.Name, role))
+			return
+		}
+
+		context.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		testName           string
+		headers            map[string]string
+		expectedStatusCode int
+		expectedPrincipal  string
+	}{
+		{
+			testName:           "API key",
+			headers:            map[string]string{APIKeyHeader: "secret"},
+			expectedStatusCode: 200,
+			expectedPrincipal:  "alice/lab",
+		},
+		{
+			testName:           "Bearer token",
+			headers:            map[string]string{"Authorization": "bearer secret"},
+			expectedStatusCode: 200,
+			expectedPrincipal:  "alice/lab",
+		},
+		{
+			testName:           "Tenant header is ignored",
+			headers:            map[string]string{APIKeyHeader: "secret", TenantHeader: "other"},
+			expectedStatusCode: 200,
+			expectedPrincipal:  "alice/lab",
+		},
+		{
+			testName:           "Key without tenant",
+			headers:            map[string]string{APIKeyHeader: "shared", TenantHeader: "other"},
+			expectedStatusCode: 200,
+			expectedPrincipal:  "bob/" + auth.DefaultTenant,
+		},
+		{
+			testName:           "Without credentials",
+			expectedStatusCode: 401,
+		},
+		{
+			testName:           "Basic credentials",
+			headers:            map[string]string{"Authorization": "Basic c2VjcmV0"},
+			expectedStatusCode: 401,
+		},
+		{
+			testName:           "Wrong key",
+			headers:            map[string]string{APIKeyHeader: "guess"},
+			expectedStatusCode: 401,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			authenticator := auth.NewAPIKeys(map[string]auth.Principal{"secret": {Name: "alice", Tenant: "lab"}, "shared": {Name: "bob"}})
+			router.GET("/", Authenticate(authenticator), Tenant(), func(context *gin.Context) {
+				principal, _ := auth.PrincipalFromContext(context.Request.Context())
+				context.String(http.StatusOK, principal.Name+"/"+principal.Tenant)
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, test.expectedStatusCode, recorder.Code)
+			if test.expectedStatusCode == 200 {
+				assert.Equal(t, test.expectedPrincipal, recorder.Body.String())
+			} else {
+				assert.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authenticator := auth.NewAPIKeys(map[string]auth.Principal{
+		"admin-key": {Name: "alice", Roles: []string{auth.RoleAdmin}},
+		"user-key":  {Name: "bob"},
+	})
+	router.GET("/", Authenticate(authenticator), RequireRole(auth.RoleAdmin), func(context *gin.Context) {
+		context.Status(http.StatusOK)
+	})
+
+	for key, expectedStatusCode := range map[string]int{"admin-key": 200, "user-key": 403} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(APIKeyHeader, key)
+		router.ServeHTTP(recorder, request)
+
+		assert.Equal(t, expectedStatusCode, recorder.Code, key)
+	}
+}
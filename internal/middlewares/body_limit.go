@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/models"
+	"io"
+	"net/http"
+)
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (body *limitedBody) Read(buffer []byte) (int, error) {
+	if body.remaining <= 0 {
+		var probe [1]byte
+		if n, _ := body.ReadCloser.Read(probe[:]); n > 0 {
+			return 0, &models.SizeLimitError{Limit: body.limit}
+		}
+		return 0, io.EOF
+	}
+	if int64(len(buffer)) > body.remaining {
+		buffer = buffer[:body.remaining]
+	}
+	n, err := body.ReadCloser.Read(buffer)
+	body.remaining -= int64(n)
+
+	return n, err
+}
+
+// BodyLimit rejects requests whose body is larger than maxBytes. Requests
+// announcing a larger Content-Length are rejected before anything is read,
+// the others fail with models.SizeLimitError once the limit is crossed.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if maxBytes <= 0 {
+			context.Next()
+			return
+		}
+		if context.Request.ContentLength > maxBytes {
+			context.AbortWithError(http.StatusRequestEntityTooLarge, &models.SizeLimitError{Limit: maxBytes})
+			return
+		}
+
+		context.Request.Body = &limitedBody{ReadCloser: context.Request.Body, remaining: maxBytes, limit: maxBytes}
+		context.Next()
+	}
+}
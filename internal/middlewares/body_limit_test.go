@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	tests := []struct {
+		testName           string
+		maxBytes           int64
+		body               []byte
+		hideContentLength  bool
+		expectedStatusCode int
+	}{
+		{
+			testName:           "OK",
+			maxBytes:           6,
+			body:               []byte{0, 1, 2, 3, 4, 5},
+			expectedStatusCode: 200,
+		},
+		{
+			testName:           "Without limit",
+			maxBytes:           0,
+			body:               []byte{0, 1, 2, 3, 4, 5},
+			expectedStatusCode: 200,
+		},
+		{
+			testName:           "Too big Content-Length",
+			maxBytes:           5,
+			body:               []byte{0, 1, 2, 3, 4, 5},
+			expectedStatusCode: 413,
+		},
+		{
+			testName:           "Too big chunked body",
+			maxBytes:           5,
+			body:               []byte{0, 1, 2, 3, 4, 5},
+			hideContentLength:  true,
+			expectedStatusCode: 413,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.testName, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/", BodyLimit(testCase.maxBytes), func(context *gin.Context) {
+				body, err := ioutil.ReadAll(context.Request.Body)
+				if _, ok := err.(*models.SizeLimitError); ok {
+					context.AbortWithStatus(http.StatusRequestEntityTooLarge)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.body, body)
+				context.AbortWithStatus(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(testCase.body))
+			if testCase.hideContentLength {
+				request.ContentLength = -1
+			}
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, testCase.expectedStatusCode, recorder.Code)
+		})
+	}
+}
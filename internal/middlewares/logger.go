@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/logging"
+	"github.com/pmokeev/chartographer/internal/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"time"
+)
+
+// Logger passes a logger carrying the request id to the services and logs
+// every request once it is served. Client errors are logged as warnings
+// and server errors as errors, both with the errors the handlers attached.
+// It has to follow RequestID.
+func Logger() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		id := requestid.FromContext(context.Request.Context())
+		logger := zap.L().With(zap.String("request_id", id))
+		context.Request = context.Request.WithContext(logging.WithLogger(context.Request.Context(), logger))
+		context.Next()
+
+		status := context.Writer.Status()
+		fields := []zap.Field{
+			zap.String("method", context.Request.Method),
+			zap.String("route", context.FullPath()),
+			zap.String("path", context.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", context.ClientIP()),
+		}
+		if principal, ok := auth.PrincipalFromContext(context.Request.Context()); ok {
+			fields = append(fields, zap.String("principal", principal.Name))
+		}
+		if errs := context.Errors.Errors(); len(errs) > 0 {
+			fields = append(fields, zap.Strings("errors", errs))
+		}
+
+		level := zapcore.InfoLevel
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = zapcore.ErrorLevel
+		case status >= http.StatusBadRequest:
+			level = zapcore.WarnLevel
+		}
+		if entry := logger.Check(level, "Request served"); entry != nil {
+			entry.Write(fields...)
+		}
+	}
+}
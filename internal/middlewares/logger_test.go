@@ -0,0 +1,92 @@
+package middlewares
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/logging"
+	"github.com/pmokeev/chartographer/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	tests := []struct {
+		testName        string
+		path            string
+		expectedLevel   zapcore.Level
+		expectedStatus  int
+		expectedErrors  []interface{}
+		expectedMessage string
+	}{
+		{
+			testName:       "OK",
+			path:           "/chartas/1/",
+			expectedLevel:  zapcore.InfoLevel,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			testName:       "Client error",
+			path:           "/chartas/bad/",
+			expectedLevel:  zapcore.WarnLevel,
+			expectedStatus: http.StatusBadRequest,
+			expectedErrors: []interface{}{"invalid id"},
+		},
+		{
+			testName:        "Server error",
+			path:            "/chartas/broken/",
+			expectedLevel:   zapcore.ErrorLevel,
+			expectedStatus:  http.StatusInternalServerError,
+			expectedErrors:  []interface{}{"disk failed"},
+			expectedMessage: "Reading canvas",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			defer zap.ReplaceGlobals(zap.New(core))()
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(RequestID(), Logger())
+			router.GET("/chartas/:id/", func(context *gin.Context) {
+				switch context.Param("id") {
+				case "bad":
+					context.AbortWithError(http.StatusBadRequest, errors.New("invalid id"))
+				case "broken":
+					logging.FromContext(context.Request.Context()).Debug("Reading canvas")
+					context.AbortWithError(http.StatusInternalServerError, errors.New("disk failed"))
+				default:
+					context.Status(http.StatusOK)
+				}
+			})
+
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+			request.Header.Set(requestid.Header, "abc-123")
+			router.ServeHTTP(httptest.NewRecorder(), request)
+
+			entries := logs.AllUntimed()
+			if test.expectedMessage != "" {
+				assert.Equal(t, test.expectedMessage, entries[0].Message)
+				assert.Equal(t, "abc-123", entries[0].ContextMap()["request_id"])
+				entries = entries[1:]
+			}
+			assert.Len(t, entries, 1)
+			fields := entries[0].ContextMap()
+			assert.Equal(t, test.expectedLevel, entries[0].Level)
+			assert.Equal(t, "abc-123", fields["request_id"])
+			assert.Equal(t, "/chartas/:id/", fields["route"])
+			assert.Equal(t, int64(test.expectedStatus), fields["status"])
+			if test.expectedErrors != nil {
+				assert.Equal(t, test.expectedErrors, fields["errors"])
+			} else {
+				assert.NotContains(t, fields, "errors")
+			}
+		})
+	}
+}
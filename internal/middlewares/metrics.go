@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/metrics"
+	"strconv"
+	"time"
+)
+
+// Metrics counts requests and measures their latencies per route and
+// status. Requests matching no route are counted together, so clients
+// can not make up new series.
+func Metrics() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		context.Next()
+
+		method, route := context.Request.Method, context.FullPath()
+		if route == "" {
+			method, route = "", "unmatched"
+		}
+		status := strconv.Itoa(context.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(method, route, status).Inc()
+		metrics.ObserveSince(metrics.HTTPRequestDuration.WithLabelValues(method, route, status), start)
+	}
+}
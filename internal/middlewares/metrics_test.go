@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/chartas/:id/", func(context *gin.Context) {
+		if context.Param("id") == "missing" {
+			context.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		context.Status(http.StatusOK)
+	})
+
+	okRequests := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/chartas/:id/", "200")
+	notFoundRequests := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/chartas/:id/", "404")
+	unmatchedRequests := metrics.HTTPRequests.WithLabelValues("", "unmatched", "404")
+	okBefore, notFoundBefore, unmatchedBefore := testutil.ToFloat64(okRequests), testutil.ToFloat64(notFoundRequests), testutil.ToFloat64(unmatchedRequests)
+
+	for _, path := range []string{"/chartas/1/", "/chartas/2/", "/chartas/missing/", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, okBefore+2, testutil.ToFloat64(okRequests))
+	assert.Equal(t, notFoundBefore+1, testutil.ToFloat64(notFoundRequests))
+	assert.Equal(t, unmatchedBefore+1, testutil.ToFloat64(unmatchedRequests))
+}
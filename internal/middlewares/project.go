@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/services"
+	"net/http"
+)
+
+// Project makes the services work on the project named by the project
+// parameter of the route.
+func Project() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		project := context.Param("project")
+		if !services.IsValidProject(project) {
+			context.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid project %q", project))
+			return
+		}
+
+		context.Request = context.Request.WithContext(services.WithProject(context.Request.Context(), project))
+		context.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	tests := []struct {
+		testName           string
+		target             string
+		expectedStatusCode int
+		expectedProject    string
+	}{
+		{
+			testName:           "OK",
+			target:             "/projects/dig-a/chartas/",
+			expectedStatusCode: 200,
+			expectedProject:    "dig-a",
+		},
+		{
+			testName:           "Upper case project",
+			target:             "/projects/Dig/chartas/",
+			expectedStatusCode: 400,
+		},
+		{
+			testName:           "Invalid project",
+			target:             "/projects/dig.a/chartas/",
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/projects/:project/chartas/", Project(), func(context *gin.Context) {
+				context.String(http.StatusOK, services.ProjectFromContext(context.Request.Context()))
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+			assert.Equal(t, test.expectedStatusCode, recorder.Code)
+			if test.expectedStatusCode == 200 {
+				assert.Equal(t, test.expectedProject, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit rejects requests of clients that have used up their token
+// bucket with 429 and a Retry-After header. It has to run after
+// Authenticate, so authenticated clients are limited by principal.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if ok, wait := limiter.Allow(clientKey(context)); !ok {
+			abortTooManyRequests(context, wait, errors.New("rate limit exceeded"))
+			return
+		}
+
+		context.Next()
+	}
+}
+
+// LimitInFlight rejects requests of clients that already have the maximum
+// of operations in flight with 429 and a Retry-After header. It guards the
+// routes that decode or rewrite whole canvases.
+func LimitInFlight(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		client := clientKey(context)
+		if !limiter.Acquire(client) {
+			abortTooManyRequests(context, time.Second, errors.New("too many operations in flight"))
+			return
+		}
+		defer limiter.Release(client)
+
+		context.Next()
+	}
+}
+
+// clientKey tells clients apart by their principal and anonymous clients
+// by their IP address.
+func clientKey(context *gin.Context) string {
+	if principal, ok := auth.PrincipalFromContext(context.Request.Context()); ok && principal.Name != "" {
+		return "principal:" + principal.Name
+	}
+
+	return "ip:" + context.ClientIP()
+}
+
+func abortTooManyRequests(context *gin.Context, wait time.Duration, err error) {
+	seconds := int(math.Max(1, math.Ceil(wait.Seconds())))
+	context.Header("Retry-After", strconv.Itoa(seconds))
+	context.AbortWithError(http.StatusTooManyRequests, err)
+}
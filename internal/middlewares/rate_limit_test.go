@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	authenticator := auth.NewAPIKeys(map[string]auth.Principal{"alice-key": {Name: "alice"}, "bob-key": {Name: "bob"}})
+	router.GET("/", Authenticate(authenticator), RateLimit(ratelimit.NewLimiter(ratelimit.Options{Rate: 0.5, Burst: 2})), func(context *gin.Context) {
+		context.Status(http.StatusOK)
+	})
+
+	get := func(key string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(APIKeyHeader, key)
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, get("alice-key").Code)
+	assert.Equal(t, http.StatusOK, get("alice-key").Code)
+	recorder := get("alice-key")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get("bob-key").Code)
+}
+
+func TestRateLimit_ByIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", RateLimit(ratelimit.NewLimiter(ratelimit.Options{Rate: 1})), func(context *gin.Context) {
+		context.Status(http.StatusOK)
+	})
+
+	get := func(remoteAddr string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = remoteAddr
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, get("10.0.0.1:5678"))
+	assert.Equal(t, http.StatusOK, get("10.0.0.2:1234"))
+}
+
+func TestLimitInFlight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limiter := ratelimit.NewLimiter(ratelimit.Options{MaxInFlight: 1})
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	router.GET("/slow", LimitInFlight(limiter), func(context *gin.Context) {
+		close(started)
+		<-finish
+		context.Status(http.StatusOK)
+	})
+	router.GET("/fast", LimitInFlight(limiter), func(context *gin.Context) {
+		context.Status(http.StatusOK)
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	slowDone := make(chan int)
+	go func() {
+		slowDone <- get("/slow").Code
+	}()
+	<-started
+	recorder := get("/fast")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+
+	close(finish)
+	assert.Equal(t, http.StatusOK, <-slowDone)
+	assert.Equal(t, http.StatusOK, get("/fast").Code)
+}
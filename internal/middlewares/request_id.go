@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/requestid"
+)
+
+// RequestID keeps the X-Request-ID of the request or makes up a new one,
+// passes it to the services and returns it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		id := context.GetHeader(requestid.Header)
+		if !requestid.IsValid(id) {
+			id = requestid.New()
+		}
+		context.Header(requestid.Header, id)
+
+		context.Request = context.Request.WithContext(requestid.WithRequestID(context.Request.Context(), id))
+		context.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		testName   string
+		header     string
+		expectedID string
+	}{
+		{
+			testName:   "ID of the client",
+			header:     "abc-123",
+			expectedID: "abc-123",
+		},
+		{
+			testName: "Without ID",
+		},
+		{
+			testName: "Invalid ID",
+			header:   "abc\"123",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/", RequestID(), func(context *gin.Context) {
+				context.String(http.StatusOK, requestid.FromContext(context.Request.Context()))
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set(requestid.Header, test.header)
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, recorder.Header().Get(requestid.Header), recorder.Body.String())
+			if test.expectedID != "" {
+				assert.Equal(t, test.expectedID, recorder.Body.String())
+			} else {
+				assert.Len(t, recorder.Body.String(), 32)
+			}
+		})
+	}
+}
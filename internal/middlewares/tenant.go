@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"net/http"
+)
+
+const TenantHeader = "X-Tenant"
+
+// Tenant puts the tenant of the caller's credentials into the request
+// context, auth.DefaultTenant for credentials without one. Quotas are kept
+// per tenant, so a client can not name its tenant: while authentication is
+// off every request belongs to auth.DefaultTenant and requests with the
+// X-Tenant header are rejected with 400. Authenticated requests ignore it.
+func Tenant() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		principal, authenticated := auth.PrincipalFromContext(context.Request.Context())
+		if !authenticated && context.GetHeader(TenantHeader) != "" {
+			context.AbortWithError(http.StatusBadRequest, fmt.Errorf("header %s needs authentication", TenantHeader))
+			return
+		}
+		if principal.Tenant != "" {
+			context.Next()
+			return
+		}
+
+		principal.Tenant = auth.DefaultTenant
+		context.Request = context.Request.WithContext(auth.WithPrincipal(context.Request.Context(), principal))
+		context.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenant(t *testing.T) {
+	tests := []struct {
+		testName           string
+		header             string
+		expectedStatusCode int
+		expectedTenant     string
+	}{
+		{
+			testName:           "Without header",
+			expectedStatusCode: 200,
+			expectedTenant:     auth.DefaultTenant,
+		},
+		{
+			testName:           "Tenant header without authentication",
+			header:             "lab-1",
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/", Tenant(), func(context *gin.Context) {
+				context.String(http.StatusOK, auth.TenantFromContext(context.Request.Context()))
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				request.Header.Set(TenantHeader, test.header)
+			}
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, test.expectedStatusCode, recorder.Code)
+			if test.expectedStatusCode == 200 {
+				assert.Equal(t, test.expectedTenant, recorder.Body.String())
+			}
+		})
+	}
+}
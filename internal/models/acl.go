@@ -0,0 +1,50 @@
+package models
+
+type Permission string
+
+const (
+	PermissionRead   Permission = "read"
+	PermissionWrite  Permission = "write"
+	PermissionDelete Permission = "delete"
+	// PermissionManage allows changing the grants of an image.
+	PermissionManage Permission = "manage"
+)
+
+func (permission Permission) IsValid() bool {
+	switch permission {
+	case PermissionRead, PermissionWrite, PermissionDelete, PermissionManage:
+		return true
+	}
+
+	return false
+}
+
+// ACL is the access list of an image. The owner has every permission,
+// other principals only those granted to them.
+type ACL struct {
+	Owner  string                  `json:"owner"`
+	Grants map[string][]Permission `json:"grants,omitempty"`
+}
+
+func (acl ACL) Allows(principal string, permission Permission) bool {
+	if principal == acl.Owner {
+		return true
+	}
+	for _, granted := range acl.Grants[principal] {
+		if granted == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Copy returns an ACL that shares no grants with acl.
+func (acl ACL) Copy() ACL {
+	grants := make(map[string][]Permission, len(acl.Grants))
+	for principal, permissions := range acl.Grants {
+		grants[principal] = append([]Permission(nil), permissions...)
+	}
+
+	return ACL{Owner: acl.Owner, Grants: grants}
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Actions of audit entries.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	AuditGrant  = "grant"
+	AuditRevoke = "revoke"
+)
+
+// Results of audit entries. Denied changes failed the access control,
+// failed changes any other check.
+const (
+	AuditOK     = "ok"
+	AuditDenied = "denied"
+	AuditFailed = "failed"
+)
+
+// AuditEntry records a change of a canvas or its access list. Fragments
+// are the changed rectangles, Grantee and Permissions the changed grant.
+type AuditEntry struct {
+	Time        time.Time    `json:"time"`
+	Action      string       `json:"action"`
+	Principal   string       `json:"principal"`
+	Tenant      string       `json:"tenant"`
+	Project     string       `json:"project,omitempty"`
+	CanvasID    string       `json:"canvas_id"`
+	Fragments   []Region     `json:"fragments,omitempty"`
+	Grantee     string       `json:"grantee,omitempty"`
+	Permissions []Permission `json:"permissions,omitempty"`
+	RequestID   string       `json:"request_id,omitempty"`
+	Result      string       `json:"result"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// AuditFilter selects audit entries of a project. Empty fields match any
+// entry, From is inclusive and To exclusive. At most Limit entries are
+// selected, newest first.
+type AuditFilter struct {
+	Project  string
+	CanvasID string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+func (filter AuditFilter) Matches(entry AuditEntry) bool {
+	return entry.Project == filter.Project &&
+		(filter.CanvasID == "" || entry.CanvasID == filter.CanvasID) &&
+		(filter.From.IsZero() || !entry.Time.Before(filter.From)) &&
+		(filter.To.IsZero() || entry.Time.Before(filter.To))
+}
@@ -0,0 +1,11 @@
+package models
+
+import "fmt"
+
+type CorruptImageError struct {
+	ID string
+}
+
+func (error *CorruptImageError) Error() string {
+	return fmt.Sprintf("Image with %v id does not match its checksum", error.ID)
+}
@@ -0,0 +1,10 @@
+package models
+
+type Fragment struct {
+	Part      string `json:"part"`
+	XPosition int    `json:"x"`
+	YPosition int    `json:"y"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Data      []byte `json:"-"`
+}
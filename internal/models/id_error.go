@@ -3,7 +3,7 @@ package models
 import "fmt"
 
 type IdError struct {
-	ID int
+	ID string
 }
 
 func (error *IdError) Error() string {
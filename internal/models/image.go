@@ -3,16 +3,19 @@ package models
 import "sync"
 
 type Image struct {
-	ID       int
+	ID       string
 	Width    int
 	Height   int
 	Filepath string
 	IsExist  bool
+	Tenant   string
+	FileSize int64
+	ACL      ACL
 
-	sync.Mutex
+	sync.RWMutex
 }
 
-func NewImage(id, width, height int, filepath string, isExist bool) *Image {
+func NewImage(id string, width, height int, filepath string, isExist bool) *Image {
 	return &Image{
 		ID:       id,
 		Width:    width,
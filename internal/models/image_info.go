@@ -0,0 +1,9 @@
+package models
+
+// ImageInfo describes a stored image in listings.
+type ImageInfo struct {
+	ID     string `json:"id"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Owner  string `json:"owner"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "fmt"
+
+type ImageLimitError struct {
+	Limit int
+}
+
+func (error *ImageLimitError) Error() string {
+	return fmt.Sprintf("Storage already holds the maximum of %v images", error.Limit)
+}
@@ -0,0 +1,7 @@
+package models
+
+// ImageMetadata is stored next to every image as {id}.json.
+type ImageMetadata struct {
+	Tenant string `json:"tenant"`
+	ACL
+}
@@ -0,0 +1,11 @@
+package models
+
+import "fmt"
+
+type MediaTypeError struct {
+	MediaType string
+}
+
+func (error *MediaTypeError) Error() string {
+	return fmt.Sprintf("Unsupported media type %v", error.MediaType)
+}
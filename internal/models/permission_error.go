@@ -0,0 +1,12 @@
+package models
+
+import "fmt"
+
+type PermissionError struct {
+	ID         string
+	Permission Permission
+}
+
+func (error *PermissionError) Error() string {
+	return fmt.Sprintf("Permission %v on image %v is denied", error.Permission, error.ID)
+}
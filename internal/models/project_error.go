@@ -0,0 +1,27 @@
+package models
+
+import "fmt"
+
+type ProjectError struct {
+	Name string
+}
+
+func (error *ProjectError) Error() string {
+	return fmt.Sprintf("Project %v does not exist", error.Name)
+}
+
+type ProjectExistsError struct {
+	Name string
+}
+
+func (error *ProjectExistsError) Error() string {
+	return fmt.Sprintf("Project %v already exists", error.Name)
+}
+
+type ProjectLimitError struct {
+	Limit int
+}
+
+func (error *ProjectLimitError) Error() string {
+	return fmt.Sprintf("Storage already holds the maximum of %v projects", error.Limit)
+}
@@ -0,0 +1,22 @@
+package models
+
+// Quota is the allowance of a tenant. A zero field means no limit.
+type Quota struct {
+	MaxImages int64 `json:"max_images"`
+	MaxPixels int64 `json:"max_pixels"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+// QuotaUsage counts images, their pixels and bytes on disk, including
+// staged fragment uploads.
+type QuotaUsage struct {
+	Images int64 `json:"images"`
+	Pixels int64 `json:"pixels"`
+	Bytes  int64 `json:"bytes"`
+}
+
+type QuotaReport struct {
+	Tenant string     `json:"tenant"`
+	Usage  QuotaUsage `json:"usage"`
+	Limits Quota      `json:"limits"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "fmt"
+
+type QuotaError struct {
+	Tenant   string
+	Resource string
+	Limit    int64
+}
+
+func (error *QuotaError) Error() string {
+	return fmt.Sprintf("Tenant %v would exceed its quota of %v %v", error.Tenant, error.Limit, error.Resource)
+}
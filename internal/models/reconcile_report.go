@@ -0,0 +1,8 @@
+package models
+
+// ReconcileReport lists what a reconciliation of the storage folder
+// cleaned up: files that belong to no image and images without a file.
+type ReconcileReport struct {
+	RemovedFiles  []string `json:"removed_files"`
+	DroppedImages []string `json:"dropped_images"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type Region struct {
+	XPosition int `json:"x"`
+	YPosition int `json:"y"`
+	Width     int `json:"width"`
+	Height    int `json:"height"`
+}
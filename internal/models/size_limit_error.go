@@ -0,0 +1,11 @@
+package models
+
+import "fmt"
+
+type SizeLimitError struct {
+	Limit int64
+}
+
+func (error *SizeLimitError) Error() string {
+	return fmt.Sprintf("Request body exceeds %v bytes", error.Limit)
+}
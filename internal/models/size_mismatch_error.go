@@ -0,0 +1,14 @@
+package models
+
+import "fmt"
+
+type SizeMismatchError struct {
+	ExpectedWidth  int
+	ExpectedHeight int
+	ActualWidth    int
+	ActualHeight   int
+}
+
+func (error *SizeMismatchError) Error() string {
+	return fmt.Sprintf("Fragment is %vx%v but width and height are %vx%v", error.ActualWidth, error.ActualHeight, error.ExpectedWidth, error.ExpectedHeight)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+type Upload struct {
+	ID        string
+	ImageID   string
+	XPosition int
+	YPosition int
+	Width     int
+	Height    int
+	Size      int64
+	Offset    int64
+	Checksum  string
+	Filepath  string
+	Tenant    string
+	Principal string
+	// LastWrite is when the upload was started or last written to.
+	LastWrite time.Time
+	// Removed is set once the upload is committed, deleted or expired.
+	Removed bool
+
+	sync.Mutex
+}
+
+func NewUpload(id, imageID string, xPosition, yPosition, width, height int, size int64, checksum, filepath string) *Upload {
+	return &Upload{
+		ID:        id,
+		ImageID:   imageID,
+		XPosition: xPosition,
+		YPosition: yPosition,
+		Width:     width,
+		Height:    height,
+		Size:      size,
+		Checksum:  checksum,
+		Filepath:  filepath}
+}
@@ -0,0 +1,29 @@
+package models
+
+import "fmt"
+
+type UploadIdError struct {
+	ID string
+}
+
+func (error *UploadIdError) Error() string {
+	return fmt.Sprintf("Upload with %v id does not exist ", error.ID)
+}
+
+type OffsetError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (error *OffsetError) Error() string {
+	return fmt.Sprintf("Upload offset %v does not match expected %v", error.Actual, error.Expected)
+}
+
+type ChecksumError struct {
+	Expected string
+	Actual   string
+}
+
+func (error *ChecksumError) Error() string {
+	return fmt.Sprintf("Upload checksum %v does not match expected %v", error.Actual, error.Expected)
+}
@@ -0,0 +1,13 @@
+package models
+
+// VerifyReport is the result of a scan of the storage folder. Corrupt
+// images do not match their checksums or can not be decoded, missing
+// images have no file and unverified images have no checksum yet.
+// Orphaned files belong to no image.
+type VerifyReport struct {
+	Checked    int      `json:"checked"`
+	Corrupt    []string `json:"corrupt"`
+	Missing    []string `json:"missing"`
+	Unverified []string `json:"unverified"`
+	Orphaned   []string `json:"orphaned"`
+}
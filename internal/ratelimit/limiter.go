@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets of idle clients are dropped.
+const sweepInterval = time.Minute
+
+// Options are the limits of every client. A zero Rate disables the rate
+// limit and a zero MaxInFlight the limit of operations in flight.
+type Options struct {
+	// Rate is the number of requests per second a client may make on
+	// average and Burst the number it may make at once. Burst defaults
+	// to Rate, but at least one request.
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps a token bucket and the number of operations in flight per
+// client. Clients are told apart by an opaque key, e.g. their API key.
+type Limiter struct {
+	options   Options
+	buckets   map[string]*bucket
+	inFlight  map[string]int
+	lastSweep time.Time
+	now       func() time.Time
+
+	sync.Mutex
+}
+
+func NewLimiter(options Options) *Limiter {
+	if options.Burst <= 0 {
+		options.Burst = int(math.Max(1, math.Ceil(options.Rate)))
+	}
+
+	return &Limiter{
+		options:   options,
+		buckets:   make(map[string]*bucket, 0),
+		inFlight:  make(map[string]int, 0),
+		lastSweep: time.Now(),
+		now:       time.Now}
+}
+
+// Allow takes a token from the bucket of the client. If the bucket is
+// empty it returns false and how long the client has to wait for a token.
+func (limiter *Limiter) Allow(client string) (bool, time.Duration) {
+	if limiter.options.Rate <= 0 {
+		return true, 0
+	}
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+	currentBucket, ok := limiter.buckets[client]
+	if !ok {
+		currentBucket = &bucket{tokens: float64(limiter.options.Burst), updated: now}
+		limiter.buckets[client] = currentBucket
+	}
+	currentBucket.tokens = limiter.refill(currentBucket, now)
+	currentBucket.updated = now
+	if currentBucket.tokens < 1 {
+		wait := time.Duration((1 - currentBucket.tokens) / limiter.options.Rate * float64(time.Second))
+		return false, wait
+	}
+	currentBucket.tokens--
+
+	return true, 0
+}
+
+// Acquire counts an operation of the client as in flight unless it already
+// has MaxInFlight of them. Every successful Acquire has to be followed by
+// Release.
+func (limiter *Limiter) Acquire(client string) bool {
+	if limiter.options.MaxInFlight <= 0 {
+		return true
+	}
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if limiter.inFlight[client] >= limiter.options.MaxInFlight {
+		return false
+	}
+	limiter.inFlight[client]++
+
+	return true
+}
+
+func (limiter *Limiter) Release(client string) {
+	if limiter.options.MaxInFlight <= 0 {
+		return
+	}
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if limiter.inFlight[client] <= 1 {
+		delete(limiter.inFlight, client)
+		return
+	}
+	limiter.inFlight[client]--
+}
+
+func (limiter *Limiter) refill(currentBucket *bucket, now time.Time) float64 {
+	tokens := currentBucket.tokens + now.Sub(currentBucket.updated).Seconds()*limiter.options.Rate
+	return math.Min(tokens, float64(limiter.options.Burst))
+}
+
+// sweep drops the buckets that have filled up again, as they behave the
+// same as new ones. The lock has to be held.
+func (limiter *Limiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+
+	for client, currentBucket := range limiter.buckets {
+		if limiter.refill(currentBucket, now) >= float64(limiter.options.Burst) {
+			delete(limiter.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(options Options) (*Limiter, *time.Time) {
+	limiter := NewLimiter(options)
+	now := time.Unix(1700000000, 0)
+	limiter.lastSweep = now
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	return limiter, &now
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	limiter, now := newTestLimiter(Options{Rate: 2, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("alice")
+		assert.True(t, ok)
+	}
+	ok, wait := limiter.Allow("alice")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	ok, _ = limiter.Allow("bob")
+	assert.True(t, ok)
+
+	*now = now.Add(250 * time.Millisecond)
+	ok, wait = limiter.Allow("alice")
+	assert.False(t, ok)
+	assert.Equal(t, 250*time.Millisecond, wait)
+
+	*now = now.Add(250 * time.Millisecond)
+	ok, _ = limiter.Allow("alice")
+	assert.True(t, ok)
+
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ = limiter.Allow("alice")
+		assert.True(t, ok)
+	}
+	ok, _ = limiter.Allow("alice")
+	assert.False(t, ok)
+}
+
+func TestLimiter_Allow_Disabled(t *testing.T) {
+	limiter, _ := newTestLimiter(Options{})
+
+	for i := 0; i < 100; i++ {
+		ok, _ := limiter.Allow("alice")
+		assert.True(t, ok)
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	limiter, now := newTestLimiter(Options{Rate: 1})
+
+	limiter.Allow("alice")
+	limiter.Allow("bob")
+	*now = now.Add(sweepInterval)
+	limiter.Allow("bob")
+	assert.Len(t, limiter.buckets, 1)
+	assert.Contains(t, limiter.buckets, "bob")
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	limiter, _ := newTestLimiter(Options{MaxInFlight: 2})
+
+	assert.True(t, limiter.Acquire("alice"))
+	assert.True(t, limiter.Acquire("alice"))
+	assert.False(t, limiter.Acquire("alice"))
+	assert.True(t, limiter.Acquire("bob"))
+
+	limiter.Release("alice")
+	assert.True(t, limiter.Acquire("alice"))
+	limiter.Release("alice")
+	limiter.Release("alice")
+	limiter.Release("bob")
+	assert.Empty(t, limiter.inFlight)
+}
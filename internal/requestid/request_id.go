@@ -0,0 +1,42 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// Header carries the id of a request to and from clients and proxies.
+const Header = "X-Request-ID"
+
+var pattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// New returns a random request id.
+func New() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid tells whether a request id sent by a client can be kept. It
+// must not be able to break a log line.
+func IsValid(id string) bool {
+	return pattern.MatchString(id)
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext returns the id of the request, which is empty outside of
+// requests.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
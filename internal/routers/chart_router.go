@@ -2,28 +2,98 @@ package routers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/auth"
 	"github.com/pmokeev/chartographer/internal/controllers"
+	"github.com/pmokeev/chartographer/internal/middlewares"
+	"github.com/pmokeev/chartographer/internal/ratelimit"
 	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// Options configure the middlewares of the router.
+type Options struct {
+	MaxUploadBytes int64
+	// Authenticator checks the credentials of every request. Without it
+	// authentication and access control are off.
+	Authenticator auth.Authenticator
+	// RateLimit bounds the requests of every client and its operations
+	// on whole canvases in flight.
+	RateLimit ratelimit.Options
+	// TrustedProxies are the addresses and CIDRs of the proxies whose
+	// X-Forwarded-For header names the client. Without them clients are
+	// told apart by the address of the connection, so they can not escape
+	// the rate limits with made up headers.
+	TrustedProxies []string
+}
+
 type ChartRouter struct {
 	controller *controllers.Controller
+	limiter    *ratelimit.Limiter
+	options    Options
 }
 
-func NewChartRouter(service *services.Service) *ChartRouter {
-	return &ChartRouter{controller: controllers.NewController(service)}
+func NewChartRouter(service *services.Service, options Options) *ChartRouter {
+	return &ChartRouter{
+		controller: controllers.NewController(service),
+		limiter:    ratelimit.NewLimiter(options.RateLimit),
+		options:    options}
 }
 
 func (chartRouter *ChartRouter) InitChartRouter() *gin.Engine {
 	router := gin.New()
+	if err := router.SetTrustedProxies(chartRouter.options.TrustedProxies); err != nil {
+		router.SetTrustedProxies(nil)
+	}
+	router.Use(middlewares.RequestID(), middlewares.Logger(), middlewares.Metrics())
+	adminOnly := []gin.HandlerFunc{}
+	if chartRouter.options.Authenticator != nil {
+		router.Use(middlewares.Authenticate(chartRouter.options.Authenticator))
+		adminOnly = append(adminOnly, middlewares.RequireRole(auth.RoleAdmin))
+	}
+	router.Use(middlewares.RateLimit(chartRouter.limiter), middlewares.Tenant())
+
+	chartRouter.initChartRoutes(router.Group("/chartas"))
+	router.GET("/quota", chartRouter.controller.GetQuota)
+	chartRouter.initAdminRoutes(router.Group("/admin", adminOnly...))
+	router.GET("/metrics", append(adminOnly, gin.WrapH(promhttp.Handler()))...)
 
-	chart := router.Group("/chartas")
+	router.GET("/projects", chartRouter.controller.ListProjects)
+	router.POST("/projects/:project", append(adminOnly, chartRouter.controller.CreateProject)...)
+	project := router.Group("/projects/:project", middlewares.Project())
 	{
-		chart.POST("/", chartRouter.controller.CreateBMP)
-		chart.POST("/:id/", chartRouter.controller.UpdateBMP)
-		chart.GET("/:id/", chartRouter.controller.GetPartBMP)
-		chart.DELETE("/:id/", chartRouter.controller.DeleteBMP)
+		chartRouter.initChartRoutes(project.Group("/chartas"))
+		project.GET("/quota", chartRouter.controller.GetQuota)
+		chartRouter.initAdminRoutes(project.Group("/admin", adminOnly...))
 	}
 
 	return router
 }
+
+func (chartRouter *ChartRouter) initChartRoutes(chart *gin.RouterGroup) {
+	bodyLimit := middlewares.BodyLimit(chartRouter.options.MaxUploadBytes)
+	heavy := middlewares.LimitInFlight(chartRouter.limiter)
+
+	chart.GET("/", chartRouter.controller.ListBMP)
+	chart.POST("/", heavy, chartRouter.controller.CreateBMP)
+	chart.POST("/:id/", heavy, bodyLimit, chartRouter.controller.UpdateBMP)
+	chart.POST("/:id/batch", heavy, bodyLimit, chartRouter.controller.UpdateBMPBatch)
+	chart.GET("/:id/", heavy, chartRouter.controller.GetPartBMP)
+	chart.POST("/:id/regions", heavy, chartRouter.controller.GetPartsBMP)
+	chart.DELETE("/:id/", chartRouter.controller.DeleteBMP)
+
+	chart.POST("/:id/uploads/", chartRouter.controller.CreateUpload)
+	chart.HEAD("/:id/uploads/:upload", chartRouter.controller.GetUploadOffset)
+	chart.PATCH("/:id/uploads/:upload", heavy, bodyLimit, chartRouter.controller.WriteUploadChunk)
+	chart.DELETE("/:id/uploads/:upload", chartRouter.controller.DeleteUpload)
+
+	chart.GET("/:id/acl", chartRouter.controller.GetACL)
+	chart.PUT("/:id/acl/:principal", chartRouter.controller.GrantAccess)
+	chart.DELETE("/:id/acl/:principal", chartRouter.controller.RevokeAccess)
+}
+
+func (chartRouter *ChartRouter) initAdminRoutes(admin *gin.RouterGroup) {
+	admin.GET("/cache", chartRouter.controller.GetCacheStats)
+	admin.GET("/verify", chartRouter.controller.VerifyStorage)
+	admin.POST("/fsck", chartRouter.controller.Reconcile)
+	admin.GET("/audit", chartRouter.controller.QueryAudit)
+}
@@ -0,0 +1,55 @@
+package routers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmokeev/chartographer/internal/ratelimit"
+	"github.com/pmokeev/chartographer/internal/services"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChartRouter_SpoofedForwardedFor(t *testing.T) {
+	tests := []struct {
+		testName       string
+		trustedProxies []string
+		expectedStatus int
+	}{
+		{
+			testName:       "No trusted proxies",
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			testName:       "Client is no trusted proxy",
+			trustedProxies: []string{"192.168.0.0/16"},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			testName:       "Client is a trusted proxy",
+			trustedProxies: []string{"10.0.0.1"},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := NewChartRouter(&services.Service{}, Options{
+				RateLimit:      ratelimit.Options{Rate: 1},
+				TrustedProxies: test.trustedProxies}).InitChartRouter()
+
+			get := func(forwardedFor string) int {
+				recorder := httptest.NewRecorder()
+				request := httptest.NewRequest(http.MethodGet, "/unknown", nil)
+				request.RemoteAddr = "10.0.0.1:1234"
+				request.Header.Set("X-Forwarded-For", forwardedFor)
+				router.ServeHTTP(recorder, request)
+				return recorder.Code
+			}
+
+			assert.Equal(t, http.StatusNotFound, get("203.0.113.1"))
+			assert.Equal(t, test.expectedStatus, get("203.0.113.2"))
+		})
+	}
+}
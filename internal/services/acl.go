@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/models"
+)
+
+// authorize checks that the caller holds the permission on the image.
+// Callers without a name are not authenticated, which only happens while
+// authentication is off, and may do anything, as may admins.
+func authorize(ctx context.Context, currentImage *models.Image, permission models.Permission) error {
+	principal, _ := auth.PrincipalFromContext(ctx)
+	if principal.Name == "" || principal.HasRole(auth.RoleAdmin) || currentImage.ACL.Allows(principal.Name, permission) {
+		return nil
+	}
+
+	return &models.PermissionError{ID: currentImage.ID, Permission: permission}
+}
+
+// ownerFromContext returns the owner of images created by the caller.
+func ownerFromContext(ctx context.Context) string {
+	principal, _ := auth.PrincipalFromContext(ctx)
+	return principal.Name
+}
+
+func (chartService *ChartService) GetACL(ctx context.Context, id string) (models.ACL, error) {
+	currentImage, ok := chartService.imageRegistry.Get(id)
+	if !ok {
+		return models.ACL{}, &models.IdError{ID: id}
+	}
+	rLockImage(currentImage)
+	defer currentImage.RUnlock()
+
+	if !currentImage.IsExist {
+		return models.ACL{}, &models.IdError{ID: id}
+	}
+	if err := authorize(ctx, currentImage, models.PermissionManage); err != nil {
+		return models.ACL{}, err
+	}
+
+	return currentImage.ACL.Copy(), nil
+}
+
+// GrantAccess replaces the permissions of the principal on the image.
+func (chartService *ChartService) GrantAccess(ctx context.Context, id string, principal string, permissions []models.Permission) error {
+	err := chartService.grantAccess(ctx, id, principal, permissions)
+	chartService.audit(ctx, models.AuditEntry{Action: models.AuditGrant, CanvasID: id, Grantee: principal, Permissions: permissions}, err)
+
+	return err
+}
+
+func (chartService *ChartService) grantAccess(ctx context.Context, id string, principal string, permissions []models.Permission) error {
+	if principal == "" || len(permissions) == 0 {
+		return &models.ParamsError{}
+	}
+	for _, permission := range permissions {
+		if !permission.IsValid() {
+			return &models.ParamsError{}
+		}
+	}
+
+	return chartService.changeACL(ctx, id, func(acl *models.ACL) {
+		acl.Grants[principal] = append([]models.Permission(nil), permissions...)
+	})
+}
+
+func (chartService *ChartService) RevokeAccess(ctx context.Context, id string, principal string) error {
+	err := chartService.changeACL(ctx, id, func(acl *models.ACL) {
+		delete(acl.Grants, principal)
+	})
+	chartService.audit(ctx, models.AuditEntry{Action: models.AuditRevoke, CanvasID: id, Grantee: principal}, err)
+
+	return err
+}
+
+// changeACL applies change to a copy of the access list of the image and
+// stores the result.
+func (chartService *ChartService) changeACL(ctx context.Context, id string, change func(acl *models.ACL)) error {
+	currentImage, ok := chartService.imageRegistry.Get(id)
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+	lockImage(currentImage)
+	defer currentImage.Unlock()
+
+	if !currentImage.IsExist {
+		return &models.IdError{ID: id}
+	}
+	if err := authorize(ctx, currentImage, models.PermissionManage); err != nil {
+		return err
+	}
+
+	acl := currentImage.ACL.Copy()
+	change(&acl)
+	if err := chartService.writeMetadata(id, models.ImageMetadata{Tenant: currentImage.Tenant, ACL: acl}); err != nil {
+		return err
+	}
+	currentImage.ACL = acl
+
+	return nil
+}
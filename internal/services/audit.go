@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/logging"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/requestid"
+	"go.uber.org/zap"
+	"time"
+)
+
+// audit completes the entry with the caller and the result of the change
+// and writes it to the audit trail. A failed write is logged instead of
+// failing the change, which has already happened.
+func (chartService *ChartService) audit(ctx context.Context, entry models.AuditEntry, err error) {
+	if chartService.options.AuditLog == nil {
+		return
+	}
+
+	entry.Time = time.Now().UTC()
+	entry.Principal = ownerFromContext(ctx)
+	entry.Tenant = auth.TenantFromContext(ctx)
+	entry.Project = chartService.project
+	entry.RequestID = requestid.FromContext(ctx)
+	entry.Result = models.AuditOK
+	if err != nil {
+		entry.Result = models.AuditFailed
+		entry.Error = err.Error()
+		if _, ok := err.(*models.PermissionError); ok {
+			entry.Result = models.AuditDenied
+		}
+	}
+
+	if err := chartService.options.AuditLog.Record(entry); err != nil {
+		logging.FromContext(ctx).Error("Writing audit entry failed", zap.String("canvas_id", entry.CanvasID), zap.Error(err))
+	}
+}
@@ -2,213 +2,824 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/metrics"
 	"github.com/pmokeev/chartographer/internal/models"
 	"github.com/pmokeev/chartographer/internal/utils"
+	"github.com/pmokeev/chartographer/internal/wal"
+	"github.com/pmokeev/chartographer/internal/workers"
+	"go.uber.org/zap"
 	"golang.org/x/image/bmp"
 	"image"
 	"image/color"
 	"image/draw"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strconv"
-	"sync"
+	"sort"
+	"strings"
+	"time"
 )
 
+var blackColor = color.RGBA{A: 0xFF}
+
+// fragmentSpoolMemory is the size of the largest fragment read ahead into
+// memory. Larger fragments are read ahead into a temporary file.
+const fragmentSpoolMemory = 8 << 20
+
 type ChartService struct {
-	imageMap            map[int]*models.Image
+	imageRegistry       *ImageRegistry
+	workerPool          *workers.Pool
+	canvasCache         *cache.CanvasCache
+	writeBack           *writeBackBuffer
+	quotas              *quotaTracker
+	options             Options
+	project             string
 	pathToStorageFolder string
-	idCounter           int
+	pathToWALFolder     string
 }
 
-func NewChartService(pathToStorageFolder string) *ChartService {
-	return &ChartService{
+func NewChartService(pathToStorageFolder string, workerPool *workers.Pool, canvasCache *cache.CanvasCache, options Options) *ChartService {
+	chartService := &ChartService{
 		pathToStorageFolder: pathToStorageFolder,
-		idCounter:           0,
-		imageMap:            make(map[int]*models.Image, 0)}
+		options:             options,
+		pathToWALFolder:     filepath.Join(pathToStorageFolder, "wal"),
+		imageRegistry:       NewImageRegistry(),
+		quotas:              newQuotaTracker(options.Quotas),
+		workerPool:          workerPool,
+		canvasCache:         canvasCache}
+	if options.WriteBack.enabled() && !options.ReadOnly {
+		chartService.writeBack = newWriteBackBuffer(options.WriteBack)
+		go chartService.writeBack.run(chartService.flushAll)
+	}
+
+	return chartService
 }
 
-func (chartService *ChartService) CreateBMP(width, height int) (int, error) {
-	if width <= 0 || width > 20000 || height <= 0 || height > 50000 {
-		return -1, &models.ParamsError{}
+// Recover loads the canvases left in the storage folder by a previous run,
+// writes the updates from their write-ahead logs into them and reconciles
+// the storage folder with them. In read-only mode only the canvases are
+// loaded.
+func (chartService *ChartService) Recover() error {
+	files, err := ioutil.ReadDir(chartService.pathToStorageFolder)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		id, ok := parseFileID(file.Name(), ".bmp")
+		if !ok || file.IsDir() {
+			continue
+		}
+		path := filepath.Join(chartService.pathToStorageFolder, file.Name())
+		imageFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		config, err := bmp.DecodeConfig(imageFile)
+		imageFile.Close()
+		if err != nil {
+			return err
+		}
+		metadata, ok, err := chartService.readMetadata(id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			metadata.Tenant = auth.DefaultTenant
+		}
+		currentImage := models.NewImage(id, config.Width, config.Height, path, true)
+		currentImage.Tenant = metadata.Tenant
+		currentImage.ACL = metadata.ACL
+		currentImage.FileSize = file.Size()
+		chartService.imageRegistry.Add(currentImage)
+		chartService.imageRegistry.ReserveID(id)
+		chartService.quotas.adjust(currentImage.Tenant, imageUsage(currentImage))
+	}
+	if chartService.options.ReadOnly {
+		return nil
+	}
+	for _, currentImage := range chartService.imageRegistry.Images() {
+		if err := chartService.settleChecksum(currentImage); err != nil {
+			return err
+		}
 	}
 
-	currentImage := models.NewImage(chartService.idCounter, width, height, filepath.Join(chartService.pathToStorageFolder, strconv.Itoa(chartService.idCounter)+".bmp"), true)
-	currentImage.Lock()
-	defer currentImage.Unlock()
+	logs, err := ioutil.ReadDir(chartService.pathToWALFolder)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, logFile := range logs {
+		id, ok := parseFileID(logFile.Name(), ".wal")
+		if !ok {
+			continue
+		}
+		currentImage, ok := chartService.imageRegistry.Get(id)
+		if !ok {
+			continue
+		}
+		img, err := chartService.readImage(currentImage)
+		if errors.Is(err, wal.ErrCorrupt) {
+			// The log is kept for inspection and the canvas fails to be
+			// read until it is repaired, rather than losing the updates.
+			zap.L().Error("Replaying write-ahead log failed", zap.String("canvas_id", id), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := chartService.writeImage(currentImage, img); err != nil {
+			return err
+		}
+		if err := os.Remove(chartService.walPath(id)); err != nil {
+			return err
+		}
+	}
 
-	chartService.imageMap[chartService.idCounter] = currentImage
-	chartService.idCounter++
+	_, err = chartService.Reconcile()
+	return err
+}
 
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
+// Close writes all buffered updates to the canvas files.
+func (chartService *ChartService) Close() {
+	if chartService.writeBack != nil {
+		chartService.writeBack.close()
+	}
+}
 
-	var wg sync.WaitGroup
-	goroutineCount := 10
-	chunkSize := width/goroutineCount + 1
-	for i := 0; i < goroutineCount; i++ {
-		wg.Add(1)
-
-		go func(image *image.RGBA, width, height, chunkSize, chunkNumber int) {
-			defer wg.Done()
-			for x := chunkSize * chunkNumber; x < utils.Min((chunkNumber+1)*chunkSize, width); x++ {
-				for y := 0; y < height; y++ {
-					image.Set(x, y, color.Black)
-				}
-			}
-		}(img, width, height, chunkSize, i)
+func (chartService *ChartService) CreateBMP(ctx context.Context, width, height int) (string, error) {
+	id, err := chartService.createBMP(ctx, width, height)
+	if err == nil {
+		metrics.CanvasesCreated.Inc()
+	}
+	chartService.audit(ctx, models.AuditEntry{Action: models.AuditCreate, CanvasID: id, Fragments: []models.Region{{Width: width, Height: height}}}, err)
+
+	return id, err
+}
+
+func (chartService *ChartService) createBMP(ctx context.Context, width, height int) (string, error) {
+	limits := chartService.options.Limits
+	if width <= 0 || exceeds(width, limits.MaxWidth) || height <= 0 || exceeds(height, limits.MaxHeight) {
+		return "", &models.ParamsError{}
 	}
-	wg.Wait()
 
-	file, err := os.Create(currentImage.Filepath)
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	id, err := chartService.newID()
 	if err != nil {
-		return 0, err
+		return "", err
+	}
+	currentImage := models.NewImage(id, width, height, filepath.Join(chartService.pathToStorageFolder, id+".bmp"), true)
+	currentImage.Tenant = auth.TenantFromContext(ctx)
+	currentImage.ACL = models.ACL{Owner: ownerFromContext(ctx)}
+	currentImage.FileSize = maxFileSize(width, height)
+	lockImage(currentImage)
+	defer currentImage.Unlock()
+
+	if err := chartService.quotas.reserve(currentImage.Tenant, imageUsage(currentImage)); err != nil {
+		chartService.imageRegistry.ReleaseID(id)
+		return "", err
+	}
+	if !chartService.imageRegistry.TryAdd(currentImage, limits.MaxImages) {
+		chartService.quotas.release(currentImage.Tenant, imageUsage(currentImage))
+		chartService.imageRegistry.ReleaseID(id)
+		return "", &models.ImageLimitError{Limit: limits.MaxImages}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	chartService.workerPool.RunRows(height, func(minY, maxY int) {
+		utils.FillRGBA(img, image.Rect(0, minY, width, maxY), chartService.options.FillColor)
+	})
+
+	err = chartService.writeImage(currentImage, img)
+	if err == nil {
+		err = chartService.writeMetadata(id, models.ImageMetadata{Tenant: currentImage.Tenant, ACL: currentImage.ACL})
 	}
-	if err := utils.WriteInFile(file, img); err != nil {
-		return 0, err
+	if err != nil {
+		chartService.forgetImage(currentImage)
+		chartService.imageRegistry.ReleaseID(id)
+		os.Remove(currentImage.Filepath)
+		os.Remove(chartService.checksumPath(id))
+		return "", err
 	}
+	chartService.canvasCache.Put(chartService.cacheKey(currentImage.ID), img)
 
 	return currentImage.ID, nil
 }
 
-func (chartService *ChartService) UpdateBMP(id, xPosition, yPosition, width, height int, receivedImage []byte) error {
+// newID returns the id of a new canvas: a UUIDv7, or the next integer in
+// the compatibility mode.
+func (chartService *ChartService) newID() (string, error) {
+	if chartService.options.IntegerIDs {
+		return chartService.imageRegistry.NextID(), nil
+	}
+
+	return utils.NewUUIDv7()
+}
+
+func (chartService *ChartService) UpdateBMP(ctx context.Context, id string, xPosition, yPosition, width, height int, receivedImage io.Reader) error {
+	err := chartService.updateBMP(ctx, id, xPosition, yPosition, width, height, receivedImage)
+	chartService.audit(ctx, models.AuditEntry{Action: models.AuditUpdate, CanvasID: id, Fragments: []models.Region{{XPosition: xPosition, YPosition: yPosition, Width: width, Height: height}}}, err)
+
+	return err
+}
+
+func (chartService *ChartService) updateBMP(ctx context.Context, id string, xPosition, yPosition, width, height int, receivedImage io.Reader) error {
 	if width <= 0 || height <= 0 {
 		return &models.ParamsError{}
 	}
 
-	currentImage, ok := chartService.imageMap[id]
+	currentImage, ok := chartService.imageRegistry.Get(id)
 	if !ok {
 		return &models.IdError{ID: id}
 	}
-	currentImage.Lock()
+	// The canvas is checked before the fragment is read, so a fragment
+	// that would be rejected is not spooled, and again once it is locked.
+	rLockImage(currentImage)
+	err := checkUpdate(ctx, currentImage, xPosition, yPosition)
+	currentImage.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	fragmentReader, err := utils.NewBMPReader(receivedImage)
+	if err != nil {
+		return err
+	}
+	if fragmentReader.Width != width || fragmentReader.Height != height {
+		return &models.SizeMismatchError{ExpectedWidth: width, ExpectedHeight: height, ActualWidth: fragmentReader.Width, ActualHeight: fragmentReader.Height}
+	}
+	defer fragmentReader.Close()
+	// The fragment is read ahead, so a slow client keeps neither the canvas
+	// locked nor a worker busy while it sends it.
+	if err := fragmentReader.Spool(fragmentSpoolMemory); err != nil {
+		return err
+	}
+
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	lockImage(currentImage)
 	defer currentImage.Unlock()
 
-	if !currentImage.IsExist {
-		return &models.IdError{ID: id}
+	if err := checkUpdate(ctx, currentImage, xPosition, yPosition); err != nil {
+		return err
+	}
+
+	changeableOriginalImage, err := chartService.readImage(currentImage)
+	if err != nil {
+		return err
+	}
+	decodeStart := time.Now()
+	err = drawFragmentRows(changeableOriginalImage, fragmentReader, xPosition, yPosition)
+	metrics.ObserveSince(metrics.DecodeDuration.WithLabelValues(metrics.KindFragment), decodeStart)
+	if err != nil {
+		chartService.canvasCache.Remove(chartService.cacheKey(currentImage.ID))
+		return err
 	}
 
+	return chartService.commitImage(currentImage, changeableOriginalImage, []image.Rectangle{image.Rect(xPosition, yPosition, xPosition+width, yPosition+height)})
+}
+
+// checkUpdate returns an error if the caller may not draw a fragment at
+// the position on the canvas. The lock of the canvas has to be held.
+func checkUpdate(ctx context.Context, currentImage *models.Image, xPosition, yPosition int) error {
+	if !currentImage.IsExist {
+		return &models.IdError{ID: currentImage.ID}
+	}
+	if err := authorize(ctx, currentImage, models.PermissionWrite); err != nil {
+		return err
+	}
 	if utils.Abs(xPosition) >= currentImage.Width || utils.Abs(yPosition) >= currentImage.Height {
 		return &models.ParamsError{}
 	}
 
-	originalImageFile, err := os.OpenFile(currentImage.Filepath, os.O_RDONLY, 0777)
+	return nil
+}
+
+func (chartService *ChartService) UpdateBMPBatch(ctx context.Context, id string, fragments []models.Fragment) error {
+	err := chartService.updateBMPBatch(ctx, id, fragments)
+	regions := make([]models.Region, len(fragments))
+	for ind, fragment := range fragments {
+		regions[ind] = models.Region{XPosition: fragment.XPosition, YPosition: fragment.YPosition, Width: fragment.Width, Height: fragment.Height}
+	}
+	chartService.audit(ctx, models.AuditEntry{Action: models.AuditUpdate, CanvasID: id, Fragments: regions}, err)
+
+	return err
+}
+
+func (chartService *ChartService) updateBMPBatch(ctx context.Context, id string, fragments []models.Fragment) error {
+	if len(fragments) == 0 {
+		return &models.ParamsError{}
+	}
+	for _, fragment := range fragments {
+		if fragment.Width <= 0 || fragment.Height <= 0 {
+			return &models.ParamsError{}
+		}
+	}
+
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	currentImage, ok := chartService.imageRegistry.Get(id)
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+	lockImage(currentImage)
+	defer currentImage.Unlock()
+
+	if !currentImage.IsExist {
+		return &models.IdError{ID: id}
+	}
+	if err := authorize(ctx, currentImage, models.PermissionWrite); err != nil {
+		return err
+	}
+
+	decodedFragments := make([]image.Image, len(fragments))
+	for ind, fragment := range fragments {
+		if utils.Abs(fragment.XPosition) >= currentImage.Width || utils.Abs(fragment.YPosition) >= currentImage.Height {
+			return &models.ParamsError{}
+		}
+
+		decodeStart := time.Now()
+		decodedFragment, err := bmp.Decode(bytes.NewReader(fragment.Data))
+		metrics.ObserveSince(metrics.DecodeDuration.WithLabelValues(metrics.KindFragment), decodeStart)
+		if err != nil {
+			return err
+		}
+		if decodedFragment.Bounds().Dx() != fragment.Width || decodedFragment.Bounds().Dy() != fragment.Height {
+			return &models.SizeMismatchError{ExpectedWidth: fragment.Width, ExpectedHeight: fragment.Height, ActualWidth: decodedFragment.Bounds().Dx(), ActualHeight: decodedFragment.Bounds().Dy()}
+		}
+		decodedFragments[ind] = decodedFragment
+	}
+
+	changeableOriginalImage, err := chartService.readImage(currentImage)
 	if err != nil {
 		return err
 	}
-	originalImage, err := bmp.Decode(originalImageFile)
+	changedRects := make([]image.Rectangle, len(fragments))
+	for ind, fragment := range fragments {
+		chartService.drawFragment(changeableOriginalImage, decodedFragments[ind], fragment.XPosition, fragment.YPosition, fragment.Width, fragment.Height)
+		changedRects[ind] = image.Rect(fragment.XPosition, fragment.YPosition, fragment.XPosition+fragment.Width, fragment.YPosition+fragment.Height)
+	}
+
+	return chartService.commitImage(currentImage, changeableOriginalImage, changedRects)
+}
+
+// readImage returns the decoded canvas, from the cache if possible, with
+// the updates from its write-ahead log applied. The returned image is
+// shared with the cache, so writers holding the exclusive lock update the
+// cached canvas in place.
+func (chartService *ChartService) readImage(currentImage *models.Image) (*image.RGBA, error) {
+	if cachedImage, ok := chartService.canvasCache.Get(chartService.cacheKey(currentImage.ID)); ok {
+		return cachedImage, nil
+	}
+
+	originalImageFile, err := os.OpenFile(currentImage.Filepath, os.O_RDONLY, 0777)
+	if err != nil {
+		return nil, err
+	}
+	defer originalImageFile.Close()
+
+	var reader io.Reader = originalImageFile
+	hash := sha256.New()
+	if chartService.options.VerifyOnRead {
+		reader = io.TeeReader(originalImageFile, hash)
+	}
+	decodeStart := time.Now()
+	originalImage, err := bmp.Decode(reader)
+	metrics.ObserveSince(metrics.DecodeDuration.WithLabelValues(metrics.KindCanvas), decodeStart)
 	if err != nil {
+		return nil, fmt.Errorf("decoding canvas %s: %w", currentImage.ID, err)
+	}
+	if chartService.options.VerifyOnRead {
+		if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+			return nil, err
+		}
+		expectedChecksums, ok, err := chartService.readChecksum(currentImage.ID)
+		if err != nil {
+			return nil, err
+		}
+		if ok && !containsChecksum(expectedChecksums, hex.EncodeToString(hash.Sum(nil))) {
+			return nil, &models.CorruptImageError{ID: currentImage.ID}
+		}
+	}
+
+	changeableOriginalImage, ok := originalImage.(*image.RGBA)
+	if !ok {
+		changeableOriginalImage = image.NewRGBA(originalImage.Bounds())
+		draw.Draw(changeableOriginalImage, originalImage.Bounds(), originalImage, image.Point{}, draw.Over)
+	}
+	if err := wal.Replay(chartService.walPath(currentImage.ID), func(record wal.Record) {
+		record.Apply(changeableOriginalImage)
+	}); err != nil {
+		return nil, err
+	}
+	chartService.canvasCache.Put(chartService.cacheKey(currentImage.ID), changeableOriginalImage)
+
+	return changeableOriginalImage, nil
+}
+
+// writeImage replaces the canvas file and its checksum. The checksum of
+// the new file is stored next to the old one before the file is renamed
+// into place, so a crash in between leaves a checksum matching the file.
+func (chartService *ChartService) writeImage(currentImage *models.Image, img image.Image) error {
+	previousChecksums, _, err := chartService.readChecksum(currentImage.ID)
+	hash := sha256.New()
+	if err == nil {
+		err = utils.WriteFileAtomic(currentImage.Filepath, func(writer io.Writer) error {
+			encodeStart := time.Now()
+			err := bmp.Encode(io.MultiWriter(writer, hash), img)
+			metrics.ObserveSince(metrics.EncodeDuration.WithLabelValues(metrics.KindCanvas), encodeStart)
+			if err != nil || len(previousChecksums) == 0 {
+				return err
+			}
+			return chartService.writeChecksum(currentImage.ID, append([]string{hex.EncodeToString(hash.Sum(nil))}, previousChecksums...)...)
+		})
+	}
+	if err == nil {
+		err = chartService.writeChecksum(currentImage.ID, hex.EncodeToString(hash.Sum(nil)))
+	}
+	if err != nil {
+		chartService.canvasCache.Remove(chartService.cacheKey(currentImage.ID))
 		return err
 	}
-	if err = originalImageFile.Close(); err != nil {
+
+	info, err := os.Stat(currentImage.Filepath)
+	if err != nil {
 		return err
 	}
+	chartService.quotas.adjust(currentImage.Tenant, models.QuotaUsage{Bytes: info.Size() - currentImage.FileSize})
+	currentImage.FileSize = info.Size()
+
+	return nil
+}
 
-	changeableOriginalImage := image.NewRGBA(originalImage.Bounds())
-	draw.Draw(changeableOriginalImage, originalImage.Bounds(), originalImage, image.Point{}, draw.Over)
+// commitImage makes the changed rectangles of the canvas durable, either
+// in the canvas file or, with write-back enabled, in its write-ahead log.
+func (chartService *ChartService) commitImage(currentImage *models.Image, img *image.RGBA, changedRects []image.Rectangle) error {
+	if chartService.writeBack == nil {
+		return chartService.writeImage(currentImage, img)
+	}
 
-	receivedImageDecoded, err := bmp.Decode(bytes.NewReader(receivedImage))
-	if err != nil {
+	records := make([]wal.Record, len(changedRects))
+	size := int64(0)
+	for ind, rect := range changedRects {
+		records[ind] = wal.NewRecord(img, rect)
+		size += int64(len(records[ind].Pix))
+	}
+	if err := os.MkdirAll(chartService.pathToWALFolder, 0777); err != nil {
+		chartService.canvasCache.Remove(chartService.cacheKey(currentImage.ID))
+		return err
+	}
+	if err := wal.Append(chartService.walPath(currentImage.ID), records); err != nil {
+		chartService.canvasCache.Remove(chartService.cacheKey(currentImage.ID))
 		return err
 	}
+	chartService.writeBack.markDirty(currentImage.ID, size)
+
+	return nil
+}
 
-	var wg sync.WaitGroup
-	goroutineCount := 10
-	chunkSize := width/goroutineCount + 1
-	for i := 0; i < goroutineCount; i++ {
-		wg.Add(1)
+func (chartService *ChartService) flushAll() {
+	for _, id := range chartService.writeBack.dirtyIDs() {
+		if err := chartService.flushImage(id); err != nil {
+			zap.L().Error("Flushing canvas failed", zap.String("canvas_id", id), zap.Error(err))
+		}
+	}
+}
 
-		go func(image *image.RGBA, width, height, chunkSize, chunkNumber, xPosition, yPosition int) {
-			defer wg.Done()
-			for x := chunkSize * chunkNumber; x < utils.Min((chunkNumber+1)*chunkSize, width); x++ {
-				for y := 0; y < height; y++ {
-					if x+xPosition >= 0 && x+xPosition < currentImage.Width && y+yPosition >= 0 && y+yPosition < currentImage.Height {
-						image.Set(x+xPosition, y+yPosition, receivedImageDecoded.At(x, y))
-					}
-				}
-			}
-		}(changeableOriginalImage, width, height, chunkSize, i, xPosition, yPosition)
+// flushImage writes the buffered updates of the canvas to its file and
+// drops its write-ahead log.
+func (chartService *ChartService) flushImage(id string) error {
+	currentImage, ok := chartService.imageRegistry.Get(id)
+	if !ok {
+		chartService.writeBack.markClean(id)
+		return nil
 	}
-	wg.Wait()
+	lockImage(currentImage)
+	defer currentImage.Unlock()
 
-	originalImageFile, err = os.OpenFile(currentImage.Filepath, os.O_WRONLY, 0777)
-	if err := utils.WriteInFile(originalImageFile, changeableOriginalImage); err != nil {
+	if !currentImage.IsExist || !chartService.writeBack.isDirty(id) {
+		return nil
+	}
+	img, err := chartService.readImage(currentImage)
+	if err != nil {
+		return err
+	}
+	if err := chartService.writeImage(currentImage, img); err != nil {
+		return err
+	}
+	if err := os.Remove(chartService.walPath(id)); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	chartService.writeBack.markClean(id)
 
 	return nil
 }
 
-func (chartService *ChartService) GetPartBMP(id, xPosition, yPosition, width, height int) (image.Image, error) {
-	if width <= 0 || height <= 0 || width > 5000 || height > 5000 {
+// cacheKey tells canvases of different projects apart in the shared cache.
+func (chartService *ChartService) cacheKey(id string) string {
+	return chartService.project + "/" + id
+}
+
+// lockImage locks the canvas for writing and records how long it waited.
+func lockImage(currentImage *models.Image) {
+	start := time.Now()
+	currentImage.Lock()
+	metrics.ObserveSince(metrics.LockWait.WithLabelValues(metrics.ModeWrite), start)
+}
+
+// rLockImage locks the canvas for reading and records how long it waited.
+func rLockImage(currentImage *models.Image) {
+	start := time.Now()
+	currentImage.RLock()
+	metrics.ObserveSince(metrics.LockWait.WithLabelValues(metrics.ModeRead), start)
+}
+
+func (chartService *ChartService) walPath(id string) string {
+	return filepath.Join(chartService.pathToWALFolder, id+".wal")
+}
+
+func (chartService *ChartService) drawFragment(img *image.RGBA, fragment image.Image, xPosition, yPosition, width, height int) {
+	position := image.Pt(xPosition, yPosition)
+
+	chartService.workerPool.RunRows(height, func(minY, maxY int) {
+		dstRect := image.Rect(0, minY, width, maxY).Intersect(fragment.Bounds()).Add(position).Intersect(img.Bounds())
+		utils.CopyToRGBA(img, dstRect, fragment, dstRect.Min.Sub(position))
+	})
+}
+
+func (chartService *ChartService) GetPartBMP(ctx context.Context, id string, xPosition, yPosition, width, height int) (image.Image, error) {
+	limits := chartService.options.Limits
+	if width <= 0 || height <= 0 || exceeds(width, limits.MaxPartWidth) || exceeds(height, limits.MaxPartHeight) {
 		return nil, &models.ParamsError{}
 	}
 
-	currentImage, ok := chartService.imageMap[id]
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	currentImage, ok := chartService.imageRegistry.Get(id)
 	if !ok {
 		return nil, &models.IdError{ID: id}
 	}
-	currentImage.Lock()
-	defer currentImage.Unlock()
+	rLockImage(currentImage)
+	defer currentImage.RUnlock()
 
 	if !currentImage.IsExist {
 		return nil, &models.IdError{ID: id}
 	}
+	if err := authorize(ctx, currentImage, models.PermissionRead); err != nil {
+		return nil, err
+	}
 
 	if utils.Abs(xPosition) >= currentImage.Width || utils.Abs(yPosition) >= currentImage.Height {
 		return nil, &models.ParamsError{}
 	}
 
-	originalImageFile, err := os.OpenFile(currentImage.Filepath, os.O_RDONLY, 0777)
+	originalImage, err := chartService.readImage(currentImage)
 	if err != nil {
 		return nil, err
 	}
-	originalImage, err := bmp.Decode(originalImageFile)
+
+	return chartService.cropImage(originalImage, xPosition, yPosition, width, height), nil
+}
+
+// GetPartsBMP crops the regions of the canvas and passes each to write.
+// All regions are cropped from the same version of the canvas before the
+// first is written, so a slow client keeps neither the canvas locked nor
+// a worker busy. The limits on regions bound the memory this takes.
+func (chartService *ChartService) GetPartsBMP(ctx context.Context, id string, regions []models.Region, write func(ind int, part image.Image) error) error {
+	parts, err := chartService.cropParts(ctx, id, regions)
 	if err != nil {
+		return err
+	}
+
+	for ind, part := range parts {
+		if err := write(ind, part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (chartService *ChartService) cropParts(ctx context.Context, id string, regions []models.Region) ([]*image.RGBA, error) {
+	limits := chartService.options.Limits
+	if len(regions) == 0 || exceeds(len(regions), limits.MaxRegions) {
+		return nil, &models.ParamsError{}
+	}
+	for _, region := range regions {
+		if region.Width <= 0 || region.Height <= 0 || exceeds(region.Width, limits.MaxPartWidth) || exceeds(region.Height, limits.MaxPartHeight) {
+			return nil, &models.ParamsError{}
+		}
+	}
+
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	currentImage, ok := chartService.imageRegistry.Get(id)
+	if !ok {
+		return nil, &models.IdError{ID: id}
+	}
+	rLockImage(currentImage)
+	defer currentImage.RUnlock()
+
+	if !currentImage.IsExist {
+		return nil, &models.IdError{ID: id}
+	}
+	if err := authorize(ctx, currentImage, models.PermissionRead); err != nil {
 		return nil, err
 	}
-	if err := originalImageFile.Close(); err != nil {
+
+	for _, region := range regions {
+		if utils.Abs(region.XPosition) >= currentImage.Width || utils.Abs(region.YPosition) >= currentImage.Height {
+			return nil, &models.ParamsError{}
+		}
+	}
+
+	originalImage, err := chartService.readImage(currentImage)
+	if err != nil {
 		return nil, err
 	}
 
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	parts := make([]*image.RGBA, len(regions))
+	for ind, region := range regions {
+		parts[ind] = chartService.cropImage(originalImage, region.XPosition, region.YPosition, region.Width, region.Height)
+	}
 
-	var wg sync.WaitGroup
-	goroutineCount := 10
-	chunkSize := width/goroutineCount + 1
-	for i := 0; i < goroutineCount; i++ {
-		wg.Add(1)
-
-		go func(image *image.RGBA, width, height, chunkSize, chunkNumber, xPosition, yPosition int) {
-			defer wg.Done()
-			for x := chunkSize * chunkNumber; x < utils.Min((chunkNumber+1)*chunkSize, width); x++ {
-				for y := 0; y < height; y++ {
-					if x+xPosition >= 0 && x+xPosition < currentImage.Width && y+yPosition >= 0 && y+yPosition < currentImage.Height {
-						image.Set(x, y, originalImage.At(x+xPosition, y+yPosition))
-					} else {
-						image.Set(x, y, color.Black)
-					}
-				}
-			}
-		}(img, width, height, chunkSize, i, xPosition, yPosition)
+	return parts, nil
+}
+
+// ListBMP returns the images the caller may read, ordered by id.
+func (chartService *ChartService) ListBMP(ctx context.Context) ([]models.ImageInfo, error) {
+	images := chartService.imageRegistry.Images()
+	infos := make([]models.ImageInfo, 0, len(images))
+	for _, currentImage := range images {
+		rLockImage(currentImage)
+		if currentImage.IsExist && authorize(ctx, currentImage, models.PermissionRead) == nil {
+			infos = append(infos, models.ImageInfo{ID: currentImage.ID, Width: currentImage.Width, Height: currentImage.Height, Owner: currentImage.ACL.Owner})
+		}
+		currentImage.RUnlock()
 	}
-	wg.Wait()
+	sort.Slice(infos, func(i, j int) bool {
+		return utils.LessID(infos[i].ID, infos[j].ID)
+	})
 
-	return img, nil
+	return infos, nil
 }
 
-func (chartService *ChartService) DeleteBMP(id int) error {
-	currentImage, ok := chartService.imageMap[id]
+// ExportBMP encodes the whole canvas, which may be larger than GetPartBMP
+// allows, into writer.
+func (chartService *ChartService) ExportBMP(id string, writer io.Writer) error {
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	currentImage, ok := chartService.imageRegistry.Get(id)
 	if !ok {
 		return &models.IdError{ID: id}
 	}
-	currentImage.Lock()
+	rLockImage(currentImage)
+	defer currentImage.RUnlock()
+
+	if !currentImage.IsExist {
+		return &models.IdError{ID: id}
+	}
+
+	img, err := chartService.readImage(currentImage)
+	if err != nil {
+		return err
+	}
+
+	defer metrics.ObserveSince(metrics.EncodeDuration.WithLabelValues(metrics.KindCanvas), time.Now())
+	return bmp.Encode(writer, img)
+}
+
+func (chartService *ChartService) DeleteBMP(ctx context.Context, id string) error {
+	err := chartService.deleteBMP(ctx, id)
+	if err == nil {
+		metrics.CanvasesDeleted.Inc()
+	}
+	chartService.audit(ctx, models.AuditEntry{Action: models.AuditDelete, CanvasID: id}, err)
+
+	return err
+}
+
+func (chartService *ChartService) deleteBMP(ctx context.Context, id string) error {
+	currentImage, ok := chartService.imageRegistry.Get(id)
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+	lockImage(currentImage)
 	defer currentImage.Unlock()
 	if !currentImage.IsExist {
 		return &models.IdError{ID: id}
 	}
+	if err := authorize(ctx, currentImage, models.PermissionDelete); err != nil {
+		return err
+	}
 	if err := os.Remove(currentImage.Filepath); err != nil {
 		return err
 	}
-	delete(chartService.imageMap, id)
-	currentImage.IsExist = false
+	if err := os.Remove(chartService.walPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(chartService.checksumPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(chartService.metadataPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	chartService.forgetImage(currentImage)
 
 	return nil
 }
+
+// forgetImage drops the image from the registry, the cache and the usage
+// of its tenant. The exclusive lock of the image has to be held.
+func (chartService *ChartService) forgetImage(currentImage *models.Image) {
+	if chartService.writeBack != nil {
+		chartService.writeBack.markClean(currentImage.ID)
+	}
+	chartService.imageRegistry.Remove(currentImage.ID)
+	chartService.canvasCache.Remove(chartService.cacheKey(currentImage.ID))
+	chartService.quotas.release(currentImage.Tenant, imageUsage(currentImage))
+	currentImage.IsExist = false
+}
+
+func (chartService *ChartService) GetQuota(ctx context.Context) models.QuotaReport {
+	return chartService.quotas.report(auth.TenantFromContext(ctx))
+}
+
+func imageUsage(currentImage *models.Image) models.QuotaUsage {
+	return models.QuotaUsage{Images: 1, Pixels: int64(currentImage.Width) * int64(currentImage.Height), Bytes: currentImage.FileSize}
+}
+
+// drawFragmentRows writes the fragment into img row by row as it is
+// decoded, so the fragment is never held in memory as a whole.
+func drawFragmentRows(img *image.RGBA, fragmentReader *utils.BMPReader, xPosition, yPosition int) error {
+	bounds := img.Bounds()
+	row := make([]byte, 4*fragmentReader.Width)
+	minX := utils.Max(0, -xPosition)
+	maxX := utils.Min(fragmentReader.Width, bounds.Dx()-xPosition)
+
+	for {
+		y, err := fragmentReader.ReadRow(row)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if y+yPosition < 0 || y+yPosition >= bounds.Dy() {
+			continue
+		}
+
+		if minX >= maxX {
+			continue
+		}
+		offset := img.PixOffset(minX+xPosition, y+yPosition)
+		utils.PremultiplyRow(img.Pix[offset:offset+4*(maxX-minX)], row[4*minX:4*maxX])
+	}
+}
+
+func (chartService *ChartService) cropImage(originalImage image.Image, xPosition, yPosition, width, height int) *image.RGBA {
+	position := image.Pt(xPosition, yPosition)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	chartService.workerPool.RunRows(height, func(minY, maxY int) {
+		utils.FillRGBA(img, image.Rect(0, minY, width, maxY), blackColor)
+		srcRect := image.Rect(0, minY, width, maxY).Add(position).Intersect(originalImage.Bounds())
+		utils.CopyToRGBA(img, srcRect.Sub(position), originalImage, srcRect.Min)
+	})
+
+	return img
+}
+
+func (chartService *ChartService) GetCacheStats() models.CacheStats {
+	return chartService.canvasCache.Stats()
+}
+
+// parseFileID returns the canvas id of a storage file named <id><extension>.
+func parseFileID(name, extension string) (string, bool) {
+	if !strings.HasSuffix(name, extension) {
+		return "", false
+	}
+	id := strings.TrimSuffix(name, extension)
+
+	return id, utils.IsValidID(id)
+}
+
+// sortIDs orders ids by creation.
+func sortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		return utils.LessID(ids[i], ids[j])
+	})
+}
@@ -1,17 +1,43 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/models"
 	"github.com/pmokeev/chartographer/internal/utils"
+	"github.com/pmokeev/chartographer/internal/wal"
+	"github.com/pmokeev/chartographer/internal/workers"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/image/bmp"
 	"image"
+	"image/color"
+	"image/draw"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+var testWorkerPool = workers.NewPool(0, 0)
+
+// integerIDOptions returns the default options in the compatibility mode,
+// so new canvases get the ids the files in testData are named after.
+func integerIDOptions() Options {
+	options := DefaultOptions()
+	options.IntegerIDs = true
+
+	return options
+}
+
 func isEqualImages(actualImage, expectedImage image.Image) bool {
 	actualBounds := actualImage.Bounds()
 	expectedBounds := expectedImage.Bounds()
@@ -35,78 +61,78 @@ func TestChartService_CreateBMP(t *testing.T) {
 		testName   string
 		width      int
 		height     int
-		expectedID int
+		expectedID string
 	}{
 		{
 			testName:   "0_id_640x426",
 			width:      640,
 			height:     426,
-			expectedID: 0,
+			expectedID: "0",
 		},
 		{
 			testName:   "1_id_1x1",
 			width:      1,
 			height:     1,
-			expectedID: 1,
+			expectedID: "1",
 		},
 		{
 			testName:   "2_id_10x10",
 			width:      10,
 			height:     10,
-			expectedID: 2,
+			expectedID: "2",
 		},
 		{
 			testName:   "3_id_12x12",
 			width:      12,
 			height:     12,
-			expectedID: 3,
+			expectedID: "3",
 		},
 		{
 			testName:   "4_id_13x13",
 			width:      13,
 			height:     13,
-			expectedID: 4,
+			expectedID: "4",
 		},
 		{
 			testName:   "Invalid width",
 			width:      -1,
 			height:     1,
-			expectedID: -1,
+			expectedID: "",
 		},
 		{
 			testName:   "Invalid height",
 			width:      1,
 			height:     -1,
-			expectedID: -1,
+			expectedID: "",
 		},
 		{
 			testName:   "Invalid width and height",
 			width:      1,
 			height:     -1,
-			expectedID: -1,
+			expectedID: "",
 		},
 		{
 			testName:   "Too big height",
 			width:      1,
 			height:     50001,
-			expectedID: -1,
+			expectedID: "",
 		},
 		{
 			testName:   "Too big width",
 			width:      20001,
 			height:     1,
-			expectedID: -1,
+			expectedID: "",
 		},
 	}
 
 	pathToStorageFolder := "../utils/testData/createBMP/"
-	currentService := NewService(pathToStorageFolder)
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
 
 	for ind, test := range tests {
 		t.Run(test.testName, func(t *testing.T) {
-			actualId, err := currentService.CreateBMP(test.width, test.height)
+			actualId, err := currentService.CreateBMP(context.Background(), test.width, test.height)
 			if err != nil {
-				assert.Equal(t, -1, actualId)
+				assert.Equal(t, "", actualId)
 				assert.True(t, test.width <= 0 || test.width > 20000 || test.height <= 0 || test.height > 50000)
 				return
 			}
@@ -130,6 +156,10 @@ func TestChartService_CreateBMP(t *testing.T) {
 
 			err = os.Remove(pathToStorageFolder + "/" + strconv.Itoa(ind) + ".bmp")
 			assert.NoError(t, err)
+			err = os.Remove(pathToStorageFolder + "/" + strconv.Itoa(ind) + ".sha256")
+			assert.NoError(t, err)
+			err = os.Remove(pathToStorageFolder + "/" + strconv.Itoa(ind) + ".json")
+			assert.NoError(t, err)
 		})
 	}
 }
@@ -137,7 +167,7 @@ func TestChartService_CreateBMP(t *testing.T) {
 func TestChartService_UpdateBMP(t *testing.T) {
 	tests := []struct {
 		testName  string
-		id        int
+		id        string
 		xPosition int
 		yPosition int
 		width     int
@@ -145,7 +175,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 	}{
 		{
 			testName:  "Zero x and y",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 			width:     124,
@@ -153,7 +183,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Positive x and y",
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: 62,
 			width:     124,
@@ -161,7 +191,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Positive x and zero y",
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: 0,
 			width:     124,
@@ -169,7 +199,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Positive y and zero x",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 62,
 			width:     124,
@@ -177,7 +207,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Negative x and y",
-			id:        0,
+			id:        "0",
 			xPosition: -62,
 			yPosition: -62,
 			width:     124,
@@ -185,7 +215,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Negative x and zero y",
-			id:        0,
+			id:        "0",
 			xPosition: -62,
 			yPosition: 0,
 			width:     124,
@@ -193,7 +223,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Negative y and zero x",
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: -62,
 			width:     124,
@@ -201,7 +231,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Negative x and positive y",
-			id:        0,
+			id:        "0",
 			xPosition: -62,
 			yPosition: 62,
 			width:     124,
@@ -209,7 +239,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Negative y and positive x",
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: -62,
 			width:     124,
@@ -217,7 +247,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Less negative x and y",
-			id:        0,
+			id:        "0",
 			xPosition: -125,
 			yPosition: -125,
 			width:     124,
@@ -225,7 +255,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "More positive x and y",
-			id:        0,
+			id:        "0",
 			xPosition: 125,
 			yPosition: 125,
 			width:     124,
@@ -233,7 +263,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "More positive x",
-			id:        0,
+			id:        "0",
 			xPosition: 125,
 			yPosition: 62,
 			width:     124,
@@ -241,7 +271,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Wrong ID",
-			id:        -1,
+			id:        "-1",
 			xPosition: 62,
 			yPosition: 62,
 			width:     124,
@@ -249,7 +279,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Wrong width",
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: 62,
 			width:     -1,
@@ -257,7 +287,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 		},
 		{
 			testName:  "Wrong height",
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: 62,
 			width:     124,
@@ -271,15 +301,17 @@ func TestChartService_UpdateBMP(t *testing.T) {
 
 	for ind, test := range tests {
 		t.Run(test.testName, func(t *testing.T) {
-			currentService := NewService(pathToStorageFolder)
+			currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
 
-			_, err := currentService.CreateBMP(124, 124)
+			_, err := currentService.CreateBMP(context.Background(), 124, 124)
 			assert.NoError(t, err)
-			defer os.Remove(pathToStorageFolder + "/" + strconv.Itoa(test.id) + ".bmp")
+			defer os.Remove(pathToStorageFolder + "/" + test.id + ".bmp")
+			defer os.Remove(pathToStorageFolder + "/" + test.id + ".sha256")
+			defer os.Remove(pathToStorageFolder + "/" + test.id + ".json")
 
-			err = currentService.UpdateBMP(test.id, test.xPosition, test.yPosition, test.width, test.height, data)
+			err = currentService.UpdateBMP(context.Background(), test.id, test.xPosition, test.yPosition, test.width, test.height, bytes.NewReader(data))
 			if err != nil {
-				assert.True(t, test.width <= 0 || test.height <= 0 || test.id < 0 || utils.Abs(test.xPosition) >= test.width || utils.Abs(test.yPosition) >= test.height)
+				assert.True(t, test.width <= 0 || test.height <= 0 || test.id == "-1" || utils.Abs(test.xPosition) >= test.width || utils.Abs(test.yPosition) >= test.height)
 				return
 			}
 
@@ -290,7 +322,7 @@ func TestChartService_UpdateBMP(t *testing.T) {
 			err = expectedFile.Close()
 			assert.NoError(t, err)
 
-			actualFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, strconv.Itoa(test.id)+".bmp"), os.O_RDONLY, 0777)
+			actualFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, test.id+".bmp"), os.O_RDONLY, 0777)
 			assert.NoError(t, err)
 			actualImage, err := bmp.Decode(actualFile)
 			assert.NoError(t, err)
@@ -307,13 +339,15 @@ func TestChartService_UpdateBMP_Overlapping(t *testing.T) {
 	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
 	assert.NoError(t, err)
 
-	currentService := NewService(pathToStorageFolder)
-	_, err = currentService.CreateBMP(124, 124)
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err = currentService.CreateBMP(context.Background(), 124, 124)
 	assert.NoError(t, err)
-	defer os.Remove(pathToStorageFolder + "/" + strconv.Itoa(0) + ".bmp")
-	err = currentService.UpdateBMP(0, 0, 0, 124, 124, data)
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+	err = currentService.UpdateBMP(context.Background(), "0", 0, 0, 124, 124, bytes.NewReader(data))
 	assert.NoError(t, err)
-	err = currentService.UpdateBMP(0, 62, 62, 124, 124, data)
+	err = currentService.UpdateBMP(context.Background(), "0", 62, 62, 124, 124, bytes.NewReader(data))
 	assert.NoError(t, err)
 
 	expectedFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, "correct9.bmp"), os.O_RDONLY, 0777)
@@ -323,7 +357,7 @@ func TestChartService_UpdateBMP_Overlapping(t *testing.T) {
 	err = expectedFile.Close()
 	assert.NoError(t, err)
 
-	actualFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, strconv.Itoa(0)+".bmp"), os.O_RDONLY, 0777)
+	actualFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, "0"+".bmp"), os.O_RDONLY, 0777)
 	assert.NoError(t, err)
 	actualImage, err := bmp.Decode(actualFile)
 	assert.NoError(t, err)
@@ -333,12 +367,151 @@ func TestChartService_UpdateBMP_Overlapping(t *testing.T) {
 	assert.True(t, isEqualImages(actualImage, expectedImage))
 }
 
+func TestChartService_UpdateBMP_Truncated(t *testing.T) {
+	pathToStorageFolder := "../utils/testData/updateBMP/"
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err = currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+
+	err = currentService.UpdateBMP(context.Background(), "0", 0, 0, 124, 124, bytes.NewReader(data[:len(data)/2]))
+	assert.Error(t, err)
+
+	actualImage, err := currentService.GetPartBMP(context.Background(), "0", 0, 0, 124, 124)
+	assert.NoError(t, err)
+	blackImage := image.NewRGBA(image.Rect(0, 0, 124, 124))
+	draw.Draw(blackImage, blackImage.Bounds(), image.Black, image.Point{}, draw.Src)
+	assert.True(t, isEqualImages(actualImage, blackImage))
+}
+
+func TestChartService_UpdateBMP_SizeMismatch(t *testing.T) {
+	pathToStorageFolder := "../utils/testData/updateBMP/"
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err = currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+
+	err = currentService.UpdateBMP(context.Background(), "0", 0, 0, 100, 124, bytes.NewReader(data))
+	assert.Equal(t, &models.SizeMismatchError{ExpectedWidth: 100, ExpectedHeight: 124, ActualWidth: 124, ActualHeight: 124}, err)
+
+	err = currentService.UpdateBMPBatch(context.Background(), "0", []models.Fragment{
+		{XPosition: 0, YPosition: 0, Width: 124, Height: 100, Data: data},
+	})
+	assert.Equal(t, &models.SizeMismatchError{ExpectedWidth: 124, ExpectedHeight: 100, ActualWidth: 124, ActualHeight: 124}, err)
+}
+
+func TestChartService_UpdateBMPBatch(t *testing.T) {
+	pathToStorageFolder := "../utils/testData/updateBMP/"
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err = currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+	err = currentService.UpdateBMPBatch(context.Background(), "0", []models.Fragment{
+		{XPosition: 0, YPosition: 0, Width: 124, Height: 124, Data: data},
+		{XPosition: 62, YPosition: 62, Width: 124, Height: 124, Data: data},
+	})
+	assert.NoError(t, err)
+
+	expectedFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, "correct9.bmp"), os.O_RDONLY, 0777)
+	assert.NoError(t, err)
+	expectedImage, err := bmp.Decode(expectedFile)
+	assert.NoError(t, err)
+	err = expectedFile.Close()
+	assert.NoError(t, err)
+
+	actualFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, "0"+".bmp"), os.O_RDONLY, 0777)
+	assert.NoError(t, err)
+	actualImage, err := bmp.Decode(actualFile)
+	assert.NoError(t, err)
+	err = actualFile.Close()
+	assert.NoError(t, err)
+
+	assert.True(t, isEqualImages(actualImage, expectedImage))
+}
+
+func TestChartService_UpdateBMPBatch_Atomic(t *testing.T) {
+	tests := []struct {
+		testName  string
+		fragments []models.Fragment
+	}{
+		{
+			testName:  "Empty batch",
+			fragments: []models.Fragment{},
+		},
+		{
+			testName: "Broken fragment",
+			fragments: []models.Fragment{
+				{XPosition: 0, YPosition: 0, Width: 124, Height: 124},
+				{XPosition: 0, YPosition: 0, Width: 124, Height: 124, Data: []byte{0, 1, 2, 3, 4, 5}},
+			},
+		},
+		{
+			testName: "Fragment out of image",
+			fragments: []models.Fragment{
+				{XPosition: 0, YPosition: 0, Width: 124, Height: 124},
+				{XPosition: 124, YPosition: 0, Width: 124, Height: 124},
+			},
+		},
+		{
+			testName: "Wrong fragment width",
+			fragments: []models.Fragment{
+				{XPosition: 0, YPosition: 0, Width: 124, Height: 124},
+				{XPosition: 0, YPosition: 0, Width: -1, Height: 124},
+			},
+		},
+	}
+
+	pathToStorageFolder := "../utils/testData/updateBMP/"
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+			_, err := currentService.CreateBMP(context.Background(), 124, 124)
+			assert.NoError(t, err)
+			defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+			defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+			defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+
+			for ind := range test.fragments {
+				if test.fragments[ind].Data == nil {
+					test.fragments[ind].Data = data
+				}
+			}
+			err = currentService.UpdateBMPBatch(context.Background(), "0", test.fragments)
+			assert.Error(t, err)
+
+			actualImage, err := currentService.GetPartBMP(context.Background(), "0", 0, 0, 124, 124)
+			assert.NoError(t, err)
+			blackImage := image.NewRGBA(image.Rect(0, 0, 124, 124))
+			draw.Draw(blackImage, blackImage.Bounds(), image.Black, image.Point{}, draw.Src)
+			assert.True(t, isEqualImages(actualImage, blackImage))
+		})
+	}
+}
+
 func TestChartService_GetPartBMP(t *testing.T) {
 	tests := []struct {
 		testName  string
 		width     int
 		height    int
-		id        int
+		id        string
 		xPosition int
 		yPosition int
 	}{
@@ -346,7 +519,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Zero x and y",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 0,
 		},
@@ -354,7 +527,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Positive x and y",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: 62,
 		},
@@ -362,7 +535,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Positive x and zero y",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: 0,
 		},
@@ -370,7 +543,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Positive y and zero x",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: 62,
 		},
@@ -378,7 +551,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Negative x and y",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: -62,
 			yPosition: -62,
 		},
@@ -386,7 +559,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Negative x and zero y",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: -62,
 			yPosition: 0,
 		},
@@ -394,7 +567,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Negative y and zero x",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 0,
 			yPosition: -62,
 		},
@@ -402,7 +575,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Negative x and positive y",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: -62,
 			yPosition: 62,
 		},
@@ -410,7 +583,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Negative y and positive x",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 62,
 			yPosition: -62,
 		},
@@ -418,7 +591,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Less x and y then width and height",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: -125,
 			yPosition: -125,
 		},
@@ -426,7 +599,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "More x and y then width and height",
 			width:     124,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 125,
 			yPosition: 125,
 		},
@@ -434,7 +607,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Invalid id",
 			width:     124,
 			height:    124,
-			id:        -1,
+			id:        "-1",
 			xPosition: 125,
 			yPosition: 125,
 		},
@@ -442,7 +615,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Width less than zero ",
 			width:     -1,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 125,
 			yPosition: 125,
 		},
@@ -450,7 +623,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Height less than zero ",
 			width:     124,
 			height:    -1,
-			id:        0,
+			id:        "0",
 			xPosition: 125,
 			yPosition: 125,
 		},
@@ -458,7 +631,7 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Width is greater than 5000",
 			width:     5001,
 			height:    124,
-			id:        0,
+			id:        "0",
 			xPosition: 125,
 			yPosition: 125,
 		},
@@ -466,27 +639,27 @@ func TestChartService_GetPartBMP(t *testing.T) {
 			testName:  "Height is greater than 5000",
 			width:     124,
 			height:    5001,
-			id:        0,
+			id:        "0",
 			xPosition: 125,
 			yPosition: 125,
 		},
 	}
 
 	pathToStorageFolder := "../utils/testData/getPartBMP/"
-	currentService := NewService(pathToStorageFolder)
-	_, err := currentService.CreateBMP(124, 124)
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err := currentService.CreateBMP(context.Background(), 124, 124)
 	assert.NoError(t, err)
 
 	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
 	assert.NoError(t, err)
-	err = currentService.UpdateBMP(0, 0, 0, 124, 124, data)
+	err = currentService.UpdateBMP(context.Background(), "0", 0, 0, 124, 124, bytes.NewReader(data))
 	assert.NoError(t, err)
 
 	for ind, test := range tests {
 		t.Run(test.testName, func(t *testing.T) {
-			actualImage, err := currentService.GetPartBMP(test.id, test.xPosition, test.yPosition, test.width, test.height)
+			actualImage, err := currentService.GetPartBMP(context.Background(), test.id, test.xPosition, test.yPosition, test.width, test.height)
 			if err != nil {
-				assert.True(t, test.width <= 0 || test.height <= 0 || test.id < 0 || test.width > 5000 || test.height > 5000 || utils.Abs(test.xPosition) >= test.width || utils.Abs(test.yPosition) >= test.height)
+				assert.True(t, test.width <= 0 || test.height <= 0 || test.id == "-1" || test.width > 5000 || test.height > 5000 || utils.Abs(test.xPosition) >= test.width || utils.Abs(test.yPosition) >= test.height)
 				return
 			}
 			assert.NoError(t, err)
@@ -502,52 +675,730 @@ func TestChartService_GetPartBMP(t *testing.T) {
 		})
 	}
 
-	err = currentService.DeleteBMP(0)
+	err = currentService.DeleteBMP(context.Background(), "0")
+	assert.NoError(t, err)
+}
+
+func TestChartService_GetPartsBMP(t *testing.T) {
+	pathToStorageFolder := "../utils/testData/getPartBMP/"
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err := currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	defer currentService.DeleteBMP(context.Background(), "0")
+
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+	err = currentService.UpdateBMP(context.Background(), "0", 0, 0, 124, 124, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	regions := []models.Region{
+		{XPosition: 0, YPosition: 0, Width: 124, Height: 124},
+		{XPosition: 62, YPosition: 62, Width: 124, Height: 124},
+		{XPosition: 62, YPosition: 0, Width: 124, Height: 124},
+		{XPosition: 0, YPosition: 62, Width: 124, Height: 124},
+	}
+	actualImages, err := getParts(currentService, context.Background(), "0", regions)
+	assert.NoError(t, err)
+	assert.Equal(t, len(regions), len(actualImages))
+
+	for ind, actualImage := range actualImages {
+		expectedFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, "correct"+strconv.Itoa(ind)+".bmp"), os.O_RDONLY, 0777)
+		assert.NoError(t, err)
+		expectedImage, err := bmp.Decode(expectedFile)
+		assert.NoError(t, err)
+		err = expectedFile.Close()
+		assert.NoError(t, err)
+
+		assert.True(t, isEqualImages(actualImage, expectedImage))
+	}
+
+	_, err = getParts(currentService, context.Background(), "0", []models.Region{})
+	assert.Error(t, err)
+	_, err = getParts(currentService, context.Background(), "0", append(regions, models.Region{XPosition: 0, YPosition: 0, Width: 5001, Height: 1}))
+	assert.Error(t, err)
+	_, err = getParts(currentService, context.Background(), "0", append(regions, models.Region{XPosition: 125, YPosition: 0, Width: 1, Height: 1}))
+	assert.Error(t, err)
+	_, err = getParts(currentService, context.Background(), "-1", regions)
+	assert.Error(t, err)
+	_, err = getParts(currentService, context.Background(), "0", make([]models.Region, 101))
+	assert.IsType(t, &models.ParamsError{}, err)
+
+	writeErr := errors.New("client went away")
+	written := 0
+	err = currentService.GetPartsBMP(context.Background(), "0", regions, func(ind int, part image.Image) error {
+		written++
+		return writeErr
+	})
+	assert.Equal(t, writeErr, err)
+	assert.Equal(t, 1, written)
+
+	err = currentService.GetPartsBMP(context.Background(), "0", regions, func(ind int, part image.Image) error {
+		if ind > 0 {
+			return nil
+		}
+		deleteDone := make(chan error, 1)
+		go func() {
+			deleteDone <- currentService.DeleteBMP(context.Background(), "0")
+		}()
+		select {
+		case err := <-deleteDone:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("canvas stays locked while parts are written")
+			return nil
+		}
+	})
 	assert.NoError(t, err)
 }
 
+// getParts collects the parts GetPartsBMP writes.
+func getParts(currentService ChartographerServicer, ctx context.Context, id string, regions []models.Region) ([]image.Image, error) {
+	parts := make([]image.Image, 0, len(regions))
+	err := currentService.GetPartsBMP(ctx, id, regions, func(ind int, part image.Image) error {
+		parts = append(parts, part)
+		return nil
+	})
+
+	return parts, err
+}
+
 func TestChartService_DeleteBMP(t *testing.T) {
 	tests := []struct {
 		testName string
 		width    int
 		height   int
-		id       int
+		id       string
 	}{
 		{
 			testName: "OK",
 			width:    124,
 			height:   124,
-			id:       0,
+			id:       "0",
 		},
 		{
 			testName: "OK",
 			width:    10,
 			height:   10,
-			id:       1,
+			id:       "1",
 		},
 		{
 			testName: "Invalid ID",
 			width:    10,
 			height:   10,
-			id:       -1,
+			id:       "-1",
 		},
 	}
 
 	pathToStorageFolder := "../utils/testData/common/"
-	currentService := NewService(pathToStorageFolder)
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
 
 	for _, test := range tests {
 		t.Run(test.testName, func(t *testing.T) {
-			_, err := currentService.CreateBMP(test.width, test.height)
+			_, err := currentService.CreateBMP(context.Background(), test.width, test.height)
 			assert.NoError(t, err)
 
-			err = currentService.DeleteBMP(test.id)
+			err = currentService.DeleteBMP(context.Background(), test.id)
 			if err != nil {
-				assert.True(t, test.id < 0)
-				_ = currentService.DeleteBMP(2)
+				assert.True(t, test.id == "-1")
+				_ = currentService.DeleteBMP(context.Background(), "2")
 				return
 			}
 			assert.NoError(t, err)
 		})
 	}
 }
+
+func TestChartService_Concurrent(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+
+	fragment := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(fragment, fragment.Bounds(), image.White, image.Point{}, draw.Src)
+	buffer := bytes.NewBuffer(nil)
+	assert.NoError(t, bmp.Encode(buffer, fragment))
+	data := buffer.Bytes()
+
+	sharedID, err := currentService.CreateBMP(context.Background(), 32, 32)
+	assert.NoError(t, err)
+
+	goroutineCount := 16
+	iterationsCount := 10
+	ids := make(chan string, goroutineCount*iterationsCount)
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutineCount; i++ {
+		wg.Add(1)
+
+		go func(goroutineNumber int) {
+			defer wg.Done()
+			for j := 0; j < iterationsCount; j++ {
+				id, err := currentService.CreateBMP(context.Background(), 16, 16)
+				assert.NoError(t, err)
+				ids <- id
+
+				assert.NoError(t, currentService.UpdateBMP(context.Background(), id, 4, 4, 8, 8, bytes.NewReader(data)))
+				assert.NoError(t, currentService.UpdateBMP(context.Background(), sharedID, goroutineNumber, j, 8, 8, bytes.NewReader(data)))
+
+				part, err := currentService.GetPartBMP(context.Background(), id, 0, 0, 16, 16)
+				assert.NoError(t, err)
+				assert.Equal(t, color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}, part.At(4, 4))
+				_, err = currentService.GetPartBMP(context.Background(), sharedID, 0, 0, 32, 32)
+				assert.NoError(t, err)
+
+				assert.NoError(t, currentService.DeleteBMP(context.Background(), id))
+				_, err = currentService.GetPartBMP(context.Background(), id, 0, 0, 16, 16)
+				assert.IsType(t, &models.IdError{}, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	seenIDs := make(map[string]bool, 0)
+	for id := range ids {
+		assert.NotEqual(t, sharedID, id)
+		assert.False(t, seenIDs[id])
+		seenIDs[id] = true
+	}
+
+	assert.NoError(t, currentService.DeleteBMP(context.Background(), sharedID))
+}
+
+func TestChartService_SharedReadLock(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	id, err := currentService.CreateBMP(context.Background(), 16, 16)
+	assert.NoError(t, err)
+
+	currentImage, ok := currentService.imageRegistry.Get(id)
+	assert.True(t, ok)
+	currentImage.RLock()
+
+	readDone := make(chan error, 1)
+	go func() {
+		_, err := currentService.GetPartBMP(context.Background(), id, 0, 0, 16, 16)
+		readDone <- err
+	}()
+	select {
+	case err := <-readDone:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read is blocked by another reader")
+	}
+
+	deleteDone := make(chan error, 1)
+	go func() {
+		deleteDone <- currentService.DeleteBMP(context.Background(), id)
+	}()
+	select {
+	case <-deleteDone:
+		t.Fatal("delete is not blocked by a reader")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	currentImage.RUnlock()
+	assert.NoError(t, <-deleteDone)
+}
+
+func TestChartService_UpdateBMP_SlowClient(t *testing.T) {
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	pathToStorageFolder := t.TempDir()
+	currentService := NewChartService(pathToStorageFolder, workers.NewPool(0, 1), cache.NewCanvasCache(0), DefaultOptions())
+	id, err := currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+
+	bodyReader, bodyWriter := io.Pipe()
+	updateDone := make(chan error, 1)
+	go func() {
+		updateDone <- currentService.UpdateBMP(context.Background(), id, 0, 0, 124, 124, bodyReader)
+	}()
+	_, err = bodyWriter.Write(data[:len(data)/2])
+	assert.NoError(t, err)
+
+	readDone := make(chan error, 1)
+	go func() {
+		_, err := currentService.GetPartBMP(context.Background(), id, 0, 0, 124, 124)
+		readDone <- err
+	}()
+	select {
+	case err := <-readDone:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read is blocked by a fragment that is still being sent")
+	}
+
+	_, err = bodyWriter.Write(data[len(data)/2:])
+	assert.NoError(t, err)
+	assert.NoError(t, bodyWriter.Close())
+	assert.NoError(t, <-updateDone)
+
+	actualImage, err := currentService.GetPartBMP(context.Background(), id, 0, 0, 124, 124)
+	assert.NoError(t, err)
+	expectedImage, err := bmp.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.True(t, isEqualImages(actualImage, expectedImage))
+}
+
+func TestChartService_Cache(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(1<<20), DefaultOptions())
+	id, err := currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, currentService.GetCacheStats().Entries)
+
+	err = currentService.UpdateBMP(context.Background(), id, 0, 0, 124, 124, bytes.NewReader(data))
+	assert.NoError(t, err)
+	cachedPart, err := currentService.GetPartBMP(context.Background(), id, 0, 0, 124, 124)
+	assert.NoError(t, err)
+
+	stats := currentService.GetCacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(0), stats.Misses)
+
+	uncachedService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	uncachedService.imageRegistry = currentService.imageRegistry
+	storedPart, err := uncachedService.GetPartBMP(context.Background(), id, 0, 0, 124, 124)
+	assert.NoError(t, err)
+	assert.True(t, isEqualImages(storedPart, cachedPart))
+
+	assert.NoError(t, currentService.DeleteBMP(context.Background(), id))
+	assert.Equal(t, 0, currentService.GetCacheStats().Entries)
+	assert.Equal(t, int64(0), currentService.GetCacheStats().UsedBytes)
+}
+
+func TestChartService_WriteBack_Recover(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	options := integerIDOptions()
+	options.WriteBack = WriteBackOptions{FlushInterval: time.Hour}
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+	id, err := currentService.CreateBMP(context.Background(), 200, 200)
+	assert.NoError(t, err)
+	err = currentService.UpdateBMP(context.Background(), id, 50, 50, 124, 124, bytes.NewReader(data))
+	assert.NoError(t, err)
+	expectedPart, err := currentService.GetPartBMP(context.Background(), id, 0, 0, 200, 200)
+	assert.NoError(t, err)
+
+	blankService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	blankService.imageRegistry = currentService.imageRegistry
+	assert.NoError(t, os.Rename(currentService.walPath(id), currentService.walPath(id)+".hidden"))
+	storedPart, err := blankService.GetPartBMP(context.Background(), id, 0, 0, 200, 200)
+	assert.NoError(t, err)
+	assert.False(t, isEqualImages(storedPart, expectedPart))
+	assert.NoError(t, os.Rename(currentService.walPath(id)+".hidden", currentService.walPath(id)))
+
+	readOnlyOptions := integerIDOptions()
+	readOnlyOptions.ReadOnly = true
+	readOnlyService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), readOnlyOptions)
+	assert.NoError(t, readOnlyService.Recover())
+	_, err = os.Stat(readOnlyService.walPath(id))
+	assert.NoError(t, err)
+	readOnlyPart, err := readOnlyService.GetPartBMP(context.Background(), id, 0, 0, 200, 200)
+	assert.NoError(t, err)
+	assert.True(t, isEqualImages(readOnlyPart, expectedPart))
+
+	recoveredService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	assert.NoError(t, recoveredService.Recover())
+	_, err = os.Stat(recoveredService.walPath(id))
+	assert.True(t, os.IsNotExist(err))
+	recoveredPart, err := recoveredService.GetPartBMP(context.Background(), id, 0, 0, 200, 200)
+	assert.NoError(t, err)
+	assert.True(t, isEqualImages(recoveredPart, expectedPart))
+
+	newID, err := recoveredService.CreateBMP(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", newID)
+}
+
+func TestChartService_WriteBack_RecoverCorruptLog(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	options := integerIDOptions()
+	options.WriteBack = WriteBackOptions{FlushInterval: time.Hour}
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+	id, err := currentService.CreateBMP(context.Background(), 200, 200)
+	assert.NoError(t, err)
+	for ind := 0; ind < 2; ind++ {
+		err = currentService.UpdateBMP(context.Background(), id, 50, 50, 124, 124, bytes.NewReader(data))
+		assert.NoError(t, err)
+	}
+	log, err := ioutil.ReadFile(currentService.walPath(id))
+	assert.NoError(t, err)
+	log[10] ^= 0xFF
+	assert.NoError(t, ioutil.WriteFile(currentService.walPath(id), log, 0777))
+
+	recoveredService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	assert.NoError(t, recoveredService.Recover())
+	_, err = os.Stat(recoveredService.walPath(id))
+	assert.NoError(t, err)
+	_, err = recoveredService.GetPartBMP(context.Background(), id, 0, 0, 200, 200)
+	assert.True(t, errors.Is(err, wal.ErrCorrupt))
+}
+
+func TestChartService_WriteBack_Flush(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	options.WriteBack = WriteBackOptions{MaxDirtyBytes: 1}
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+	id, err := currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	err = currentService.UpdateBMP(context.Background(), id, 0, 0, 124, 124, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return !currentService.writeBack.isDirty(id)
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = os.Stat(currentService.walPath(id))
+	assert.True(t, os.IsNotExist(err))
+
+	err = currentService.UpdateBMP(context.Background(), id, 62, 62, 124, 124, bytes.NewReader(data))
+	assert.NoError(t, err)
+	currentService.Close()
+	_, err = os.Stat(currentService.walPath(id))
+	assert.True(t, os.IsNotExist(err))
+
+	expectedFile, err := os.Open(filepath.Join("../utils/testData/updateBMP", "correct9.bmp"))
+	assert.NoError(t, err)
+	expectedImage, err := bmp.Decode(expectedFile)
+	assert.NoError(t, err)
+	assert.NoError(t, expectedFile.Close())
+	storedFile, err := os.Open(filepath.Join(pathToStorageFolder, id+".bmp"))
+	assert.NoError(t, err)
+	storedImage, err := bmp.Decode(storedFile)
+	assert.NoError(t, err)
+	assert.NoError(t, storedFile.Close())
+	assert.True(t, isEqualImages(storedImage, expectedImage))
+}
+
+func TestChartService_Recover_TempFiles(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	id, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+
+	tempPath := filepath.Join(pathToStorageFolder, id+".bmp.123"+utils.TempFileSuffix)
+	assert.NoError(t, ioutil.WriteFile(tempPath, []byte("BM"), 0777))
+
+	recoveredService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	assert.NoError(t, recoveredService.Recover())
+	_, err = os.Stat(tempPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = recoveredService.GetPartBMP(context.Background(), id, 0, 0, 10, 10)
+	assert.NoError(t, err)
+}
+
+func TestChartService_VerifyStorage(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	ids := make([]string, 4)
+	for ind := range ids {
+		id, err := currentService.CreateBMP(context.Background(), 10, 10)
+		assert.NoError(t, err)
+		ids[ind] = id
+	}
+
+	report, err := currentService.VerifyStorage()
+	assert.NoError(t, err)
+	assert.Equal(t, models.VerifyReport{Checked: 4, Corrupt: []string{}, Missing: []string{}, Unverified: []string{}, Orphaned: []string{}}, report)
+
+	corruptPath := filepath.Join(pathToStorageFolder, ids[1]+".bmp")
+	data, err := ioutil.ReadFile(corruptPath)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xFF
+	assert.NoError(t, ioutil.WriteFile(corruptPath, data, 0777))
+	assert.NoError(t, os.Remove(filepath.Join(pathToStorageFolder, ids[2]+".bmp")))
+	assert.NoError(t, os.Remove(currentService.checksumPath(ids[3])))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(pathToStorageFolder, "100.bmp"), data, 0777))
+
+	report, err = currentService.VerifyStorage()
+	assert.NoError(t, err)
+	assert.Equal(t, models.VerifyReport{Checked: 4, Corrupt: []string{ids[1]}, Missing: []string{ids[2]}, Unverified: []string{ids[3]}, Orphaned: []string{"100.bmp"}}, report)
+}
+
+func TestChartService_Recover_InterruptedChecksum(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	ids := make([]string, 2)
+	for ind := range ids {
+		id, err := currentService.CreateBMP(context.Background(), 10, 10)
+		assert.NoError(t, err)
+		ids[ind] = id
+	}
+	otherChecksum := strings.Repeat("ab", 32)
+	checksums := make([]string, len(ids))
+	for ind, id := range ids {
+		checksum, err := fileChecksum(filepath.Join(pathToStorageFolder, id+".bmp"))
+		assert.NoError(t, err)
+		checksums[ind] = checksum
+	}
+	// The first canvas was cut off before its new file was renamed into
+	// place, the second one before its checksum was settled.
+	assert.NoError(t, currentService.writeChecksum(ids[0], otherChecksum, checksums[0]))
+	assert.NoError(t, currentService.writeChecksum(ids[1], checksums[1], otherChecksum))
+
+	report, err := currentService.VerifyStorage()
+	assert.NoError(t, err)
+	assert.Empty(t, report.Corrupt)
+
+	recoveredService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	assert.NoError(t, recoveredService.Recover())
+	for ind, id := range ids {
+		storedChecksums, ok, err := recoveredService.readChecksum(id)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []string{checksums[ind]}, storedChecksums)
+	}
+}
+
+func TestChartService_WriteImage_ChecksumFirst(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(1<<20), DefaultOptions())
+	id, err := currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	_, err = currentService.GetPartBMP(context.Background(), id, 0, 0, 124, 124)
+	assert.NoError(t, err)
+	previousChecksums, _, err := currentService.readChecksum(id)
+	assert.NoError(t, err)
+
+	// The canvas is read from the cache and a folder in place of its file
+	// makes the rename fail.
+	path := filepath.Join(pathToStorageFolder, id+".bmp")
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, os.MkdirAll(filepath.Join(path, "blocker"), 0777))
+	err = currentService.UpdateBMP(context.Background(), id, 0, 0, 124, 124, bytes.NewReader(data))
+	assert.Error(t, err)
+
+	checksums, _, err := currentService.readChecksum(id)
+	assert.NoError(t, err)
+	assert.Len(t, checksums, 2)
+	assert.Equal(t, previousChecksums[0], checksums[1])
+}
+
+func TestChartService_VerifyOnRead(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	options := DefaultOptions()
+	options.VerifyOnRead = true
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+	id, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+	_, err = currentService.GetPartBMP(context.Background(), id, 0, 0, 10, 10)
+	assert.NoError(t, err)
+
+	path := filepath.Join(pathToStorageFolder, id+".bmp")
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xFF
+	assert.NoError(t, ioutil.WriteFile(path, data, 0777))
+
+	_, err = currentService.GetPartBMP(context.Background(), id, 0, 0, 10, 10)
+	assert.Equal(t, &models.CorruptImageError{ID: id}, err)
+
+	assert.NoError(t, os.Remove(currentService.checksumPath(id)))
+	_, err = currentService.GetPartBMP(context.Background(), id, 0, 0, 10, 10)
+	assert.NoError(t, err)
+}
+
+func TestChartService_CreateBMP_Failed(t *testing.T) {
+	pathToStorageFolder := filepath.Join(t.TempDir(), "storage")
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+
+	_, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.Error(t, err)
+	assert.Equal(t, 0, currentService.imageRegistry.Len())
+
+	assert.NoError(t, os.Mkdir(pathToStorageFolder, 0777))
+	id, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "0", id)
+}
+
+func TestChartService_Reconcile(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	keptID, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+	lostID, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Remove(filepath.Join(pathToStorageFolder, lostID+".bmp")))
+	orphans := []string{"100.bmp", "100.sha256", keptID + ".bmp.1" + utils.TempFileSuffix, filepath.Join("wal", "100.wal")}
+	assert.NoError(t, os.Mkdir(filepath.Join(pathToStorageFolder, "wal"), 0777))
+	for _, orphan := range orphans {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(pathToStorageFolder, orphan), []byte("BM"), 0777))
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(pathToStorageFolder, "notes.txt"), []byte("notes"), 0777))
+
+	report, err := currentService.Reconcile()
+	assert.NoError(t, err)
+	expectedRemovedFiles := append([]string{lostID + ".json", lostID + ".sha256"}, orphans...)
+	sort.Strings(expectedRemovedFiles)
+	assert.Equal(t, models.ReconcileReport{RemovedFiles: expectedRemovedFiles, DroppedImages: []string{lostID}}, report)
+
+	_, err = currentService.GetPartBMP(context.Background(), lostID, 0, 0, 10, 10)
+	assert.IsType(t, &models.IdError{}, err)
+	_, err = currentService.GetPartBMP(context.Background(), keptID, 0, 0, 10, 10)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(pathToStorageFolder, "notes.txt"))
+	assert.NoError(t, err)
+
+	report, err = currentService.Reconcile()
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReconcileReport{RemovedFiles: []string{}, DroppedImages: []string{}}, report)
+}
+
+func TestChartService_Options(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	options := Options{
+		Limits:     Limits{MaxWidth: 30, MaxHeight: 20, MaxPartWidth: 10, MaxImages: 2},
+		FillColor:  color.RGBA{R: 0x80, A: 0x80},
+		IntegerIDs: true}
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+
+	_, err := currentService.CreateBMP(context.Background(), 31, 20)
+	assert.IsType(t, &models.ParamsError{}, err)
+	_, err = currentService.CreateBMP(context.Background(), 30, 21)
+	assert.IsType(t, &models.ParamsError{}, err)
+	id, err := currentService.CreateBMP(context.Background(), 30, 20)
+	assert.NoError(t, err)
+	_, err = currentService.CreateBMP(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	_, err = currentService.CreateBMP(context.Background(), 1, 1)
+	assert.Equal(t, &models.ImageLimitError{Limit: 2}, err)
+
+	_, err = currentService.GetPartBMP(context.Background(), id, 0, 0, 11, 1)
+	assert.IsType(t, &models.ParamsError{}, err)
+	_, err = getParts(currentService, context.Background(), id, []models.Region{{Width: 11, Height: 1}})
+	assert.IsType(t, &models.ParamsError{}, err)
+	part, err := currentService.GetPartBMP(context.Background(), id, 0, 0, 10, 6000)
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x80, A: 0x80}, part.At(5, 5))
+
+	assert.NoError(t, currentService.DeleteBMP(context.Background(), id))
+	newID, err := currentService.CreateBMP(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", newID)
+}
+
+func TestChartService_Quotas(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	options := DefaultOptions()
+	options.Quotas = QuotaOptions{
+		Default: models.Quota{MaxImages: 1},
+		Tenants: map[string]models.Quota{"lab": {MaxPixels: 150, MaxBytes: maxFileSize(10, 10) + maxFileSize(5, 5)}}}
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+	labContext := auth.WithPrincipal(context.Background(), auth.Principal{Tenant: "lab"})
+
+	_, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+	_, err = currentService.CreateBMP(context.Background(), 1, 1)
+	assert.Equal(t, &models.QuotaError{Tenant: auth.DefaultTenant, Resource: "images", Limit: 1}, err)
+
+	labID, err := currentService.CreateBMP(labContext, 10, 10)
+	assert.NoError(t, err)
+	_, err = currentService.CreateBMP(labContext, 10, 10)
+	assert.Equal(t, &models.QuotaError{Tenant: "lab", Resource: "pixels", Limit: 150}, err)
+	_, err = currentService.CreateBMP(labContext, 5, 5)
+	assert.NoError(t, err)
+
+	report := currentService.GetQuota(labContext)
+	assert.Equal(t, "lab", report.Tenant)
+	assert.Equal(t, int64(2), report.Usage.Images)
+	assert.Equal(t, int64(125), report.Usage.Pixels)
+	assert.Equal(t, options.Quotas.Tenants["lab"], report.Limits)
+	assert.Equal(t, int64(1), currentService.GetQuota(context.Background()).Usage.Images)
+
+	recoveredService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+	assert.NoError(t, recoveredService.Recover())
+	assert.Equal(t, report, recoveredService.GetQuota(labContext))
+
+	assert.NoError(t, recoveredService.DeleteBMP(labContext, labID))
+	assert.Equal(t, int64(25), recoveredService.GetQuota(labContext).Usage.Pixels)
+	_, err = recoveredService.CreateBMP(labContext, 10, 10)
+	assert.NoError(t, err)
+}
+
+func TestChartService_AccessControl(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	aliceContext := auth.WithPrincipal(context.Background(), auth.Principal{Name: "alice", Tenant: "lab"})
+	bobContext := auth.WithPrincipal(context.Background(), auth.Principal{Name: "bob", Tenant: "lab"})
+	adminContext := auth.WithPrincipal(context.Background(), auth.Principal{Name: "root", Roles: []string{auth.RoleAdmin}})
+
+	id, err := currentService.CreateBMP(aliceContext, 10, 10)
+	assert.NoError(t, err)
+	_, err = currentService.GetPartBMP(aliceContext, id, 0, 0, 10, 10)
+	assert.NoError(t, err)
+	_, err = currentService.GetPartBMP(bobContext, id, 0, 0, 10, 10)
+	assert.Equal(t, &models.PermissionError{ID: id, Permission: models.PermissionRead}, err)
+	_, err = currentService.GetACL(bobContext, id)
+	assert.Equal(t, &models.PermissionError{ID: id, Permission: models.PermissionManage}, err)
+
+	assert.IsType(t, &models.ParamsError{}, currentService.GrantAccess(aliceContext, id, "bob", []models.Permission{"own"}))
+	assert.NoError(t, currentService.GrantAccess(aliceContext, id, "bob", []models.Permission{models.PermissionRead}))
+	_, err = currentService.GetPartBMP(bobContext, id, 0, 0, 10, 10)
+	assert.NoError(t, err)
+	_, err = getParts(currentService, bobContext, id, []models.Region{{Width: 1, Height: 1}})
+	assert.NoError(t, err)
+	fragment := bytes.NewBuffer(nil)
+	assert.NoError(t, bmp.Encode(fragment, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+	err = currentService.UpdateBMP(bobContext, id, 0, 0, 1, 1, bytes.NewReader(fragment.Bytes()))
+	assert.Equal(t, &models.PermissionError{ID: id, Permission: models.PermissionWrite}, err)
+	assert.Equal(t, &models.PermissionError{ID: id, Permission: models.PermissionDelete}, currentService.DeleteBMP(bobContext, id))
+
+	recoveredService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	assert.NoError(t, recoveredService.Recover())
+	acl, err := recoveredService.GetACL(aliceContext, id)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ACL{Owner: "alice", Grants: map[string][]models.Permission{"bob": {models.PermissionRead}}}, acl)
+
+	assert.NoError(t, recoveredService.RevokeAccess(adminContext, id, "bob"))
+	_, err = recoveredService.GetPartBMP(bobContext, id, 0, 0, 10, 10)
+	assert.IsType(t, &models.PermissionError{}, err)
+	assert.NoError(t, recoveredService.UpdateBMP(context.Background(), id, 0, 0, 1, 1, bytes.NewReader(fragment.Bytes())))
+	assert.NoError(t, recoveredService.DeleteBMP(adminContext, id))
+}
+
+func TestChartService_IDs(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	legacyService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	legacyID, err := legacyService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "0", legacyID)
+
+	currentService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	assert.NoError(t, currentService.Recover())
+	id, err := currentService.CreateBMP(context.Background(), 20, 20)
+	assert.NoError(t, err)
+	assert.True(t, utils.IsValidID(id))
+	assert.False(t, utils.IsIntegerID(id))
+	_, err = os.Stat(filepath.Join(pathToStorageFolder, id+".bmp"))
+	assert.NoError(t, err)
+
+	_, err = currentService.GetPartBMP(context.Background(), legacyID, 0, 0, 10, 10)
+	assert.NoError(t, err)
+	images, err := currentService.ListBMP(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ImageInfo{{ID: legacyID, Width: 10, Height: 10}, {ID: id, Width: 20, Height: 20}}, images)
+
+	compatibleService := NewChartService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	assert.NoError(t, compatibleService.Recover())
+	newID, err := compatibleService.CreateBMP(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", newID)
+	_, err = compatibleService.GetPartBMP(context.Background(), id, 0, 0, 20, 20)
+	assert.NoError(t, err)
+}
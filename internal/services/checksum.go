@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/utils"
+	"golang.org/x/image/bmp"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumPath returns the path of the SHA-256 checksum of the canvas
+// file. It is written in the format of sha256sum, so the storage folder
+// can also be checked with "sha256sum -c *.sha256", except for canvases
+// cut off while being replaced, which have two checksums until the next
+// start.
+func (chartService *ChartService) checksumPath(id string) string {
+	return filepath.Join(chartService.pathToStorageFolder, id+".sha256")
+}
+
+// writeChecksum stores the checksums the canvas file may have. A canvas
+// being replaced has two, the one of the new file and the one of the file
+// it replaces, so either file matches if the replacement is cut off.
+func (chartService *ChartService) writeChecksum(id string, checksums ...string) error {
+	return utils.WriteFileAtomic(chartService.checksumPath(id), func(writer io.Writer) error {
+		for _, checksum := range checksums {
+			if _, err := fmt.Fprintf(writer, "%s  %s.bmp\n", checksum, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// readChecksum returns the stored checksums of the canvas file, any of
+// which it may match, and false if the canvas has none yet.
+func (chartService *ChartService) readChecksum(id string) ([]string, bool, error) {
+	data, err := ioutil.ReadFile(chartService.checksumPath(id))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	checksums := make([]string, 0, 1)
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) != 0 {
+			checksums = append(checksums, strings.ToLower(fields[0]))
+		}
+	}
+
+	return checksums, true, nil
+}
+
+// settleChecksum keeps only the checksum of the canvas file once a
+// replacement cut off by a crash left two. Canvases matching neither are
+// left to VerifyStorage.
+func (chartService *ChartService) settleChecksum(currentImage *models.Image) error {
+	checksums, _, err := chartService.readChecksum(currentImage.ID)
+	if err != nil || len(checksums) < 2 {
+		return err
+	}
+	actualChecksum, err := fileChecksum(currentImage.Filepath)
+	if err != nil {
+		return err
+	}
+	if !containsChecksum(checksums, actualChecksum) {
+		return nil
+	}
+
+	return chartService.writeChecksum(currentImage.ID, actualChecksum)
+}
+
+func containsChecksum(checksums []string, checksum string) bool {
+	for _, expectedChecksum := range checksums {
+		if expectedChecksum == checksum {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VerifyStorage checks every canvas file against its checksum and looks
+// for files in the storage folder that belong to no canvas.
+func (chartService *ChartService) VerifyStorage() (models.VerifyReport, error) {
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	report := models.VerifyReport{Corrupt: []string{}, Missing: []string{}, Unverified: []string{}, Orphaned: []string{}}
+	for _, currentImage := range chartService.imageRegistry.Images() {
+		if err := chartService.verifyImage(currentImage, &report); err != nil {
+			return models.VerifyReport{}, err
+		}
+	}
+
+	files, err := ioutil.ReadDir(chartService.pathToStorageFolder)
+	if err != nil {
+		return models.VerifyReport{}, err
+	}
+	for _, file := range files {
+		for _, extension := range []string{".bmp", ".sha256", ".json"} {
+			if id, ok := parseFileID(file.Name(), extension); ok && !file.IsDir() && !chartService.isRegistered(id) {
+				report.Orphaned = append(report.Orphaned, file.Name())
+			}
+		}
+	}
+	logs, err := ioutil.ReadDir(chartService.pathToWALFolder)
+	if err != nil && !os.IsNotExist(err) {
+		return models.VerifyReport{}, err
+	}
+	for _, logFile := range logs {
+		if id, ok := parseFileID(logFile.Name(), ".wal"); ok && !chartService.isRegistered(id) {
+			report.Orphaned = append(report.Orphaned, filepath.Join(filepath.Base(chartService.pathToWALFolder), logFile.Name()))
+		}
+	}
+
+	sortIDs(report.Corrupt)
+	sortIDs(report.Missing)
+	sortIDs(report.Unverified)
+	sort.Strings(report.Orphaned)
+
+	return report, nil
+}
+
+func (chartService *ChartService) verifyImage(currentImage *models.Image, report *models.VerifyReport) error {
+	rLockImage(currentImage)
+	defer currentImage.RUnlock()
+
+	if !currentImage.IsExist {
+		return nil
+	}
+	report.Checked++
+
+	actualChecksum, err := fileChecksum(currentImage.Filepath)
+	if os.IsNotExist(err) {
+		report.Missing = append(report.Missing, currentImage.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(currentImage.Filepath)
+	if err != nil {
+		return err
+	}
+	config, err := bmp.DecodeConfig(file)
+	file.Close()
+	if err != nil || config.Width != currentImage.Width || config.Height != currentImage.Height {
+		report.Corrupt = append(report.Corrupt, currentImage.ID)
+		return nil
+	}
+
+	expectedChecksums, ok, err := chartService.readChecksum(currentImage.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		report.Unverified = append(report.Unverified, currentImage.ID)
+	} else if !containsChecksum(expectedChecksums, actualChecksum) {
+		report.Corrupt = append(report.Corrupt, currentImage.ID)
+	}
+
+	return nil
+}
+
+func (chartService *ChartService) isRegistered(id string) bool {
+	_, ok := chartService.imageRegistry.Get(id)
+	return ok
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"github.com/pmokeev/chartographer/internal/models"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const registryShardCount = 32
+
+type registryShard struct {
+	images map[string]*models.Image
+
+	sync.RWMutex
+}
+
+// ImageRegistry is a concurrency-safe id to image map. Images are spread
+// over shards by id, so lookups of different images rarely contend.
+type ImageRegistry struct {
+	shards    [registryShardCount]*registryShard
+	idCounter int64
+	count     int64
+}
+
+func NewImageRegistry() *ImageRegistry {
+	registry := &ImageRegistry{idCounter: -1}
+	for ind := range registry.shards {
+		registry.shards[ind] = &registryShard{images: make(map[string]*models.Image, 0)}
+	}
+
+	return registry
+}
+
+// NextID allocates a new unique integer id for the compatibility mode.
+func (registry *ImageRegistry) NextID() string {
+	return strconv.FormatInt(atomic.AddInt64(&registry.idCounter, 1), 10)
+}
+
+// ReserveID makes sure NextID never allocates id or any smaller id. Ids
+// that are not integers are ignored.
+func (registry *ImageRegistry) ReserveID(id string) {
+	number, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return
+	}
+	for {
+		current := atomic.LoadInt64(&registry.idCounter)
+		if current >= number || atomic.CompareAndSwapInt64(&registry.idCounter, current, number) {
+			return
+		}
+	}
+}
+
+// ReleaseID gives id back to NextID if no id was allocated after it.
+func (registry *ImageRegistry) ReleaseID(id string) {
+	if number, err := strconv.ParseInt(id, 10, 64); err == nil {
+		atomic.CompareAndSwapInt64(&registry.idCounter, number, number-1)
+	}
+}
+
+func (registry *ImageRegistry) Get(id string) (*models.Image, bool) {
+	shard := registry.shard(id)
+	shard.RLock()
+	defer shard.RUnlock()
+
+	currentImage, ok := shard.images[id]
+	return currentImage, ok
+}
+
+func (registry *ImageRegistry) Add(currentImage *models.Image) {
+	registry.TryAdd(currentImage, 0)
+}
+
+// TryAdd adds the image unless the registry already holds maxImages
+// images. A non-positive maxImages means no limit.
+func (registry *ImageRegistry) TryAdd(currentImage *models.Image, maxImages int) bool {
+	shard := registry.shard(currentImage.ID)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if _, ok := shard.images[currentImage.ID]; !ok {
+		for {
+			count := atomic.LoadInt64(&registry.count)
+			if maxImages > 0 && count >= int64(maxImages) {
+				return false
+			}
+			if atomic.CompareAndSwapInt64(&registry.count, count, count+1) {
+				break
+			}
+		}
+	}
+	shard.images[currentImage.ID] = currentImage
+
+	return true
+}
+
+func (registry *ImageRegistry) Remove(id string) {
+	shard := registry.shard(id)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if _, ok := shard.images[id]; ok {
+		delete(shard.images, id)
+		atomic.AddInt64(&registry.count, -1)
+	}
+}
+
+// Images returns a snapshot of all registered images.
+func (registry *ImageRegistry) Images() []*models.Image {
+	images := make([]*models.Image, 0)
+	for _, shard := range registry.shards {
+		shard.RLock()
+		for _, currentImage := range shard.images {
+			images = append(images, currentImage)
+		}
+		shard.RUnlock()
+	}
+
+	return images
+}
+
+func (registry *ImageRegistry) Len() int {
+	return int(atomic.LoadInt64(&registry.count))
+}
+
+func (registry *ImageRegistry) shard(id string) *registryShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return registry.shards[hash.Sum32()%registryShardCount]
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestImageRegistry_Concurrent(t *testing.T) {
+	registry := NewImageRegistry()
+
+	goroutineCount := 16
+	imagesPerGoroutine := 200
+	ids := make(chan string, goroutineCount*imagesPerGoroutine)
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutineCount; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < imagesPerGoroutine; j++ {
+				id := registry.NextID()
+				registry.Add(models.NewImage(id, 1, 1, "", true))
+				currentImage, ok := registry.Get(id)
+				assert.True(t, ok)
+				assert.Equal(t, id, currentImage.ID)
+				if j%2 == 0 {
+					registry.Remove(id)
+					_, ok = registry.Get(id)
+					assert.False(t, ok)
+					continue
+				}
+				ids <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seenIDs := make(map[string]bool, 0)
+	for id := range ids {
+		assert.False(t, seenIDs[id])
+		seenIDs[id] = true
+	}
+	assert.Equal(t, goroutineCount*imagesPerGoroutine/2, registry.Len())
+	assert.Equal(t, strconv.Itoa(goroutineCount*imagesPerGoroutine), registry.NextID())
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"encoding/json"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func (chartService *ChartService) metadataPath(id string) string {
+	return filepath.Join(chartService.pathToStorageFolder, id+".json")
+}
+
+func (chartService *ChartService) writeMetadata(id string, metadata models.ImageMetadata) error {
+	return utils.WriteFileAtomic(chartService.metadataPath(id), func(writer io.Writer) error {
+		return json.NewEncoder(writer).Encode(metadata)
+	})
+}
+
+// readMetadata returns the metadata of the image and false if it has
+// none, e.g. because it was stored by an older version of the service.
+func (chartService *ChartService) readMetadata(id string) (models.ImageMetadata, bool, error) {
+	var metadata models.ImageMetadata
+	data, err := ioutil.ReadFile(chartService.metadataPath(id))
+	if os.IsNotExist(err) {
+		return metadata, false, nil
+	}
+	if err != nil {
+		return metadata, false, err
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return metadata, false, err
+	}
+
+	return metadata, true, nil
+}
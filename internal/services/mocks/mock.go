@@ -5,10 +5,13 @@
 package mock_services
 
 import (
+	context "context"
 	image "image"
+	io "io"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	models "github.com/pmokeev/chartographer/internal/models"
 )
 
 // MockChartographerServicer is a mock of ChartographerServicer interface.
@@ -35,59 +38,423 @@ func (m *MockChartographerServicer) EXPECT() *MockChartographerServicerMockRecor
 }
 
 // CreateBMP mocks base method.
-func (m *MockChartographerServicer) CreateBMP(width, height int) (int, error) {
+func (m *MockChartographerServicer) CreateBMP(ctx context.Context, width, height int) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateBMP", width, height)
-	ret0, _ := ret[0].(int)
+	ret := m.ctrl.Call(m, "CreateBMP", ctx, width, height)
+	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateBMP indicates an expected call of CreateBMP.
-func (mr *MockChartographerServicerMockRecorder) CreateBMP(width, height interface{}) *gomock.Call {
+func (mr *MockChartographerServicerMockRecorder) CreateBMP(ctx, width, height interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBMP", reflect.TypeOf((*MockChartographerServicer)(nil).CreateBMP), width, height)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBMP", reflect.TypeOf((*MockChartographerServicer)(nil).CreateBMP), ctx, width, height)
 }
 
 // DeleteBMP mocks base method.
-func (m *MockChartographerServicer) DeleteBMP(id int) error {
+func (m *MockChartographerServicer) DeleteBMP(ctx context.Context, id string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteBMP", id)
+	ret := m.ctrl.Call(m, "DeleteBMP", ctx, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteBMP indicates an expected call of DeleteBMP.
-func (mr *MockChartographerServicerMockRecorder) DeleteBMP(id interface{}) *gomock.Call {
+func (mr *MockChartographerServicerMockRecorder) DeleteBMP(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBMP", reflect.TypeOf((*MockChartographerServicer)(nil).DeleteBMP), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBMP", reflect.TypeOf((*MockChartographerServicer)(nil).DeleteBMP), ctx, id)
 }
 
 // GetPartBMP mocks base method.
-func (m *MockChartographerServicer) GetPartBMP(id, xPosition, yPosition, width, height int) (image.Image, error) {
+func (m *MockChartographerServicer) GetPartBMP(ctx context.Context, id string, xPosition, yPosition, width, height int) (image.Image, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPartBMP", id, xPosition, yPosition, width, height)
+	ret := m.ctrl.Call(m, "GetPartBMP", ctx, id, xPosition, yPosition, width, height)
 	ret0, _ := ret[0].(image.Image)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPartBMP indicates an expected call of GetPartBMP.
-func (mr *MockChartographerServicerMockRecorder) GetPartBMP(id, xPosition, yPosition, width, height interface{}) *gomock.Call {
+func (mr *MockChartographerServicerMockRecorder) GetPartBMP(ctx, id, xPosition, yPosition, width, height interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartBMP", reflect.TypeOf((*MockChartographerServicer)(nil).GetPartBMP), id, xPosition, yPosition, width, height)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartBMP", reflect.TypeOf((*MockChartographerServicer)(nil).GetPartBMP), ctx, id, xPosition, yPosition, width, height)
+}
+
+// GetPartsBMP mocks base method.
+func (m *MockChartographerServicer) GetPartsBMP(ctx context.Context, id string, regions []models.Region, write func(int, image.Image) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPartsBMP", ctx, id, regions, write)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetPartsBMP indicates an expected call of GetPartsBMP.
+func (mr *MockChartographerServicerMockRecorder) GetPartsBMP(ctx, id, regions, write interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartsBMP", reflect.TypeOf((*MockChartographerServicer)(nil).GetPartsBMP), ctx, id, regions, write)
+}
+
+// ListBMP mocks base method.
+func (m *MockChartographerServicer) ListBMP(ctx context.Context) ([]models.ImageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListBMP", ctx)
+	ret0, _ := ret[0].([]models.ImageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListBMP indicates an expected call of ListBMP.
+func (mr *MockChartographerServicerMockRecorder) ListBMP(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListBMP", reflect.TypeOf((*MockChartographerServicer)(nil).ListBMP), ctx)
 }
 
 // UpdateBMP mocks base method.
-func (m *MockChartographerServicer) UpdateBMP(id, xPosition, yPosition, width, height int, receivedImage []byte) error {
+func (m *MockChartographerServicer) UpdateBMP(ctx context.Context, id string, xPosition, yPosition, width, height int, receivedImage io.Reader) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateBMP", id, xPosition, yPosition, width, height, receivedImage)
+	ret := m.ctrl.Call(m, "UpdateBMP", ctx, id, xPosition, yPosition, width, height, receivedImage)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateBMP indicates an expected call of UpdateBMP.
-func (mr *MockChartographerServicerMockRecorder) UpdateBMP(id, xPosition, yPosition, width, height, receivedImage interface{}) *gomock.Call {
+func (mr *MockChartographerServicerMockRecorder) UpdateBMP(ctx, id, xPosition, yPosition, width, height, receivedImage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBMP", reflect.TypeOf((*MockChartographerServicer)(nil).UpdateBMP), ctx, id, xPosition, yPosition, width, height, receivedImage)
+}
+
+// UpdateBMPBatch mocks base method.
+func (m *MockChartographerServicer) UpdateBMPBatch(ctx context.Context, id string, fragments []models.Fragment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBMPBatch", ctx, id, fragments)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateBMPBatch indicates an expected call of UpdateBMPBatch.
+func (mr *MockChartographerServicerMockRecorder) UpdateBMPBatch(ctx, id, fragments interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBMPBatch", reflect.TypeOf((*MockChartographerServicer)(nil).UpdateBMPBatch), ctx, id, fragments)
+}
+
+// MockChartographerUploader is a mock of ChartographerUploader interface.
+type MockChartographerUploader struct {
+	ctrl     *gomock.Controller
+	recorder *MockChartographerUploaderMockRecorder
+}
+
+// MockChartographerUploaderMockRecorder is the mock recorder for MockChartographerUploader.
+type MockChartographerUploaderMockRecorder struct {
+	mock *MockChartographerUploader
+}
+
+// NewMockChartographerUploader creates a new mock instance.
+func NewMockChartographerUploader(ctrl *gomock.Controller) *MockChartographerUploader {
+	mock := &MockChartographerUploader{ctrl: ctrl}
+	mock.recorder = &MockChartographerUploaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChartographerUploader) EXPECT() *MockChartographerUploaderMockRecorder {
+	return m.recorder
+}
+
+// CreateUpload mocks base method.
+func (m *MockChartographerUploader) CreateUpload(ctx context.Context, id string, xPosition, yPosition, width, height int, size int64, checksum string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUpload", ctx, id, xPosition, yPosition, width, height, size, checksum)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUpload indicates an expected call of CreateUpload.
+func (mr *MockChartographerUploaderMockRecorder) CreateUpload(ctx, id, xPosition, yPosition, width, height, size, checksum interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUpload", reflect.TypeOf((*MockChartographerUploader)(nil).CreateUpload), ctx, id, xPosition, yPosition, width, height, size, checksum)
+}
+
+// DeleteUpload mocks base method.
+func (m *MockChartographerUploader) DeleteUpload(ctx context.Context, id, uploadID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUpload", ctx, id, uploadID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUpload indicates an expected call of DeleteUpload.
+func (mr *MockChartographerUploaderMockRecorder) DeleteUpload(ctx, id, uploadID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUpload", reflect.TypeOf((*MockChartographerUploader)(nil).DeleteUpload), ctx, id, uploadID)
+}
+
+// GetUploadOffset mocks base method.
+func (m *MockChartographerUploader) GetUploadOffset(ctx context.Context, id, uploadID string) (int64, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUploadOffset", ctx, id, uploadID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetUploadOffset indicates an expected call of GetUploadOffset.
+func (mr *MockChartographerUploaderMockRecorder) GetUploadOffset(ctx, id, uploadID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUploadOffset", reflect.TypeOf((*MockChartographerUploader)(nil).GetUploadOffset), ctx, id, uploadID)
+}
+
+// WriteUploadChunk mocks base method.
+func (m *MockChartographerUploader) WriteUploadChunk(ctx context.Context, id, uploadID string, offset int64, chunk io.Reader) (int64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteUploadChunk", ctx, id, uploadID, offset, chunk)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// WriteUploadChunk indicates an expected call of WriteUploadChunk.
+func (mr *MockChartographerUploaderMockRecorder) WriteUploadChunk(ctx, id, uploadID, offset, chunk interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteUploadChunk", reflect.TypeOf((*MockChartographerUploader)(nil).WriteUploadChunk), ctx, id, uploadID, offset, chunk)
+}
+
+// MockChartographerAccessManager is a mock of ChartographerAccessManager interface.
+type MockChartographerAccessManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockChartographerAccessManagerMockRecorder
+}
+
+// MockChartographerAccessManagerMockRecorder is the mock recorder for MockChartographerAccessManager.
+type MockChartographerAccessManagerMockRecorder struct {
+	mock *MockChartographerAccessManager
+}
+
+// NewMockChartographerAccessManager creates a new mock instance.
+func NewMockChartographerAccessManager(ctrl *gomock.Controller) *MockChartographerAccessManager {
+	mock := &MockChartographerAccessManager{ctrl: ctrl}
+	mock.recorder = &MockChartographerAccessManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChartographerAccessManager) EXPECT() *MockChartographerAccessManagerMockRecorder {
+	return m.recorder
+}
+
+// GetACL mocks base method.
+func (m *MockChartographerAccessManager) GetACL(ctx context.Context, id string) (models.ACL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetACL", ctx, id)
+	ret0, _ := ret[0].(models.ACL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetACL indicates an expected call of GetACL.
+func (mr *MockChartographerAccessManagerMockRecorder) GetACL(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetACL", reflect.TypeOf((*MockChartographerAccessManager)(nil).GetACL), ctx, id)
+}
+
+// GrantAccess mocks base method.
+func (m *MockChartographerAccessManager) GrantAccess(ctx context.Context, id, principal string, permissions []models.Permission) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantAccess", ctx, id, principal, permissions)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GrantAccess indicates an expected call of GrantAccess.
+func (mr *MockChartographerAccessManagerMockRecorder) GrantAccess(ctx, id, principal, permissions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantAccess", reflect.TypeOf((*MockChartographerAccessManager)(nil).GrantAccess), ctx, id, principal, permissions)
+}
+
+// RevokeAccess mocks base method.
+func (m *MockChartographerAccessManager) RevokeAccess(ctx context.Context, id, principal string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAccess", ctx, id, principal)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAccess indicates an expected call of RevokeAccess.
+func (mr *MockChartographerAccessManagerMockRecorder) RevokeAccess(ctx, id, principal interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAccess", reflect.TypeOf((*MockChartographerAccessManager)(nil).RevokeAccess), ctx, id, principal)
+}
+
+// MockChartographerQuotaReporter is a mock of ChartographerQuotaReporter interface.
+type MockChartographerQuotaReporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockChartographerQuotaReporterMockRecorder
+}
+
+// MockChartographerQuotaReporterMockRecorder is the mock recorder for MockChartographerQuotaReporter.
+type MockChartographerQuotaReporterMockRecorder struct {
+	mock *MockChartographerQuotaReporter
+}
+
+// NewMockChartographerQuotaReporter creates a new mock instance.
+func NewMockChartographerQuotaReporter(ctrl *gomock.Controller) *MockChartographerQuotaReporter {
+	mock := &MockChartographerQuotaReporter{ctrl: ctrl}
+	mock.recorder = &MockChartographerQuotaReporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChartographerQuotaReporter) EXPECT() *MockChartographerQuotaReporterMockRecorder {
+	return m.recorder
+}
+
+// GetQuota mocks base method.
+func (m *MockChartographerQuotaReporter) GetQuota(ctx context.Context) models.QuotaReport {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuota", ctx)
+	ret0, _ := ret[0].(models.QuotaReport)
+	return ret0
+}
+
+// GetQuota indicates an expected call of GetQuota.
+func (mr *MockChartographerQuotaReporterMockRecorder) GetQuota(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuota", reflect.TypeOf((*MockChartographerQuotaReporter)(nil).GetQuota), ctx)
+}
+
+// MockChartographerAdministrator is a mock of ChartographerAdministrator interface.
+type MockChartographerAdministrator struct {
+	ctrl     *gomock.Controller
+	recorder *MockChartographerAdministratorMockRecorder
+}
+
+// MockChartographerAdministratorMockRecorder is the mock recorder for MockChartographerAdministrator.
+type MockChartographerAdministratorMockRecorder struct {
+	mock *MockChartographerAdministrator
+}
+
+// NewMockChartographerAdministrator creates a new mock instance.
+func NewMockChartographerAdministrator(ctrl *gomock.Controller) *MockChartographerAdministrator {
+	mock := &MockChartographerAdministrator{ctrl: ctrl}
+	mock.recorder = &MockChartographerAdministratorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChartographerAdministrator) EXPECT() *MockChartographerAdministratorMockRecorder {
+	return m.recorder
+}
+
+// GetCacheStats mocks base method.
+func (m *MockChartographerAdministrator) GetCacheStats() models.CacheStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCacheStats")
+	ret0, _ := ret[0].(models.CacheStats)
+	return ret0
+}
+
+// GetCacheStats indicates an expected call of GetCacheStats.
+func (mr *MockChartographerAdministratorMockRecorder) GetCacheStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCacheStats", reflect.TypeOf((*MockChartographerAdministrator)(nil).GetCacheStats))
+}
+
+// QueryAudit mocks base method.
+func (m *MockChartographerAdministrator) QueryAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryAudit", ctx, filter)
+	ret0, _ := ret[0].([]models.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAudit indicates an expected call of QueryAudit.
+func (mr *MockChartographerAdministratorMockRecorder) QueryAudit(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryAudit", reflect.TypeOf((*MockChartographerAdministrator)(nil).QueryAudit), ctx, filter)
+}
+
+// Reconcile mocks base method.
+func (m *MockChartographerAdministrator) Reconcile(ctx context.Context) (models.ReconcileReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile", ctx)
+	ret0, _ := ret[0].(models.ReconcileReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockChartographerAdministratorMockRecorder) Reconcile(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockChartographerAdministrator)(nil).Reconcile), ctx)
+}
+
+// VerifyStorage mocks base method.
+func (m *MockChartographerAdministrator) VerifyStorage(ctx context.Context) (models.VerifyReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyStorage", ctx)
+	ret0, _ := ret[0].(models.VerifyReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyStorage indicates an expected call of VerifyStorage.
+func (mr *MockChartographerAdministratorMockRecorder) VerifyStorage(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyStorage", reflect.TypeOf((*MockChartographerAdministrator)(nil).VerifyStorage), ctx)
+}
+
+// MockChartographerProjectManager is a mock of ChartographerProjectManager interface.
+type MockChartographerProjectManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockChartographerProjectManagerMockRecorder
+}
+
+// MockChartographerProjectManagerMockRecorder is the mock recorder for MockChartographerProjectManager.
+type MockChartographerProjectManagerMockRecorder struct {
+	mock *MockChartographerProjectManager
+}
+
+// NewMockChartographerProjectManager creates a new mock instance.
+func NewMockChartographerProjectManager(ctrl *gomock.Controller) *MockChartographerProjectManager {
+	mock := &MockChartographerProjectManager{ctrl: ctrl}
+	mock.recorder = &MockChartographerProjectManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChartographerProjectManager) EXPECT() *MockChartographerProjectManagerMockRecorder {
+	return m.recorder
+}
+
+// CreateProject mocks base method.
+func (m *MockChartographerProjectManager) CreateProject(ctx context.Context, project string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateProject", ctx, project)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateProject indicates an expected call of CreateProject.
+func (mr *MockChartographerProjectManagerMockRecorder) CreateProject(ctx, project interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProject", reflect.TypeOf((*MockChartographerProjectManager)(nil).CreateProject), ctx, project)
+}
+
+// ListProjects mocks base method.
+func (m *MockChartographerProjectManager) ListProjects(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListProjects", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListProjects indicates an expected call of ListProjects.
+func (mr *MockChartographerProjectManagerMockRecorder) ListProjects(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBMP", reflect.TypeOf((*MockChartographerServicer)(nil).UpdateBMP), id, xPosition, yPosition, width, height, receivedImage)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListProjects", reflect.TypeOf((*MockChartographerProjectManager)(nil).ListProjects), ctx)
 }
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"github.com/pmokeev/chartographer/internal/audit"
+	"image/color"
+	"time"
+)
+
+// Limits bound the sizes the chart service accepts. A zero limit means
+// no limit.
+type Limits struct {
+	MaxWidth      int
+	MaxHeight     int
+	MaxPartWidth  int
+	MaxPartHeight int
+	MaxRegions    int
+	MaxImages     int
+	MaxProjects   int
+}
+
+// Options is the policy of the chart service.
+type Options struct {
+	Limits       Limits
+	FillColor    color.RGBA
+	WriteBack    WriteBackOptions
+	Uploads      UploadOptions
+	VerifyOnRead bool
+	Quotas       QuotaOptions
+	// IntegerIDs makes new canvases get sequential integer ids as before
+	// ids became UUIDs.
+	IntegerIDs bool
+	// AuditLog receives an entry for every change of a canvas or its
+	// access list. Nil disables the audit trail.
+	AuditLog *audit.Log
+	// ReadOnly makes Recover leave the storage folder as it is: write-ahead
+	// logs are replayed in memory only and nothing is reconciled. It is
+	// meant for commands that only read canvases.
+	ReadOnly bool
+}
+
+// DefaultOptions returns the policy the service had before it became
+// configurable: images up to 20000x50000, parts up to 5000x5000, black
+// new images and no write-back, and at most 100 regions per request and
+// 100 projects. Uploads expire a day after their last chunk.
+func DefaultOptions() Options {
+	return Options{
+		Limits: Limits{
+			MaxWidth:      20000,
+			MaxHeight:     50000,
+			MaxPartWidth:  5000,
+			MaxPartHeight: 5000,
+			MaxRegions:    100,
+			MaxProjects:   100},
+		Uploads:   UploadOptions{TTL: 24 * time.Hour},
+		FillColor: blackColor}
+}
+
+func exceeds(value, limit int) bool {
+	return limit > 0 && value > limit
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"context"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/workers"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+const projectsFolder = "projects"
+
+var projectPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+type projectKey struct{}
+
+// WithProject makes the services called with ctx work on the project.
+func WithProject(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, projectKey{}, project)
+}
+
+// ProjectFromContext returns the project of the request, which is empty
+// for requests outside of any project.
+func ProjectFromContext(ctx context.Context) string {
+	project, _ := ctx.Value(projectKey{}).(string)
+	return project
+}
+
+func IsValidProject(name string) bool {
+	return projectPattern.MatchString(name)
+}
+
+type projectServices struct {
+	chartService  *ChartService
+	uploadService *UploadService
+}
+
+// Projects keeps a chart service per project, so every project has its own
+// id space and storage folder under projects/{name}. Requests outside of
+// any project use the storage folder itself. Quotas are shared by all
+// projects, so tenants can not escape them by moving to a new project.
+// Projects are created by CreateProject and opened by Recover.
+type Projects struct {
+	pathToStorageFolder string
+	workerPool          *workers.Pool
+	canvasCache         *cache.CanvasCache
+	options             Options
+	quotas              *quotaTracker
+	root                projectServices
+	projects            map[string]projectServices
+
+	sync.Mutex
+}
+
+func NewProjects(pathToStorageFolder string, workerPool *workers.Pool, canvasCache *cache.CanvasCache, options Options) *Projects {
+	projects := &Projects{
+		pathToStorageFolder: pathToStorageFolder,
+		workerPool:          workerPool,
+		canvasCache:         canvasCache,
+		options:             options,
+		quotas:              newQuotaTracker(options.Quotas),
+		projects:            make(map[string]projectServices, 0)}
+	projects.root = projects.newServices(pathToStorageFolder, "")
+
+	return projects
+}
+
+func (projects *Projects) newServices(path, project string) projectServices {
+	chartService := NewChartService(path, projects.workerPool, projects.canvasCache, projects.options)
+	chartService.project = project
+	chartService.quotas = projects.quotas
+
+	return projectServices{chartService: chartService, uploadService: NewUploadService(chartService)}
+}
+
+// recover restores the canvases of the services and removes the staged
+// files of uploads cut off by a previous run.
+func (services projectServices) recover() error {
+	if err := services.chartService.Recover(); err != nil {
+		return err
+	}
+	if services.chartService.options.ReadOnly {
+		return nil
+	}
+	_, err := services.uploadService.removeOrphans()
+
+	return err
+}
+
+func (services projectServices) close() {
+	services.uploadService.Close()
+	services.chartService.Close()
+}
+
+// Recover restores the canvases stored outside of projects and in every
+// project by a previous run, so their usage counts against the quotas
+// from the start.
+func (projects *Projects) Recover() error {
+	if err := projects.root.recover(); err != nil {
+		return err
+	}
+	names, err := projects.ListProjects(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, _, err := projects.open(WithProject(context.Background(), name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// open returns the services of the project of the request. ok is false for
+// projects that do not exist.
+func (projects *Projects) open(ctx context.Context) (projectServices, bool, error) {
+	project := ProjectFromContext(ctx)
+	if project == "" {
+		return projects.root, true, nil
+	}
+	if !IsValidProject(project) {
+		return projectServices{}, false, &models.ParamsError{}
+	}
+
+	projects.Lock()
+	defer projects.Unlock()
+
+	if services, ok := projects.projects[project]; ok {
+		return services, true, nil
+	}
+	path := projects.projectPath(project)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return projectServices{}, false, nil
+	} else if err != nil {
+		return projectServices{}, false, err
+	}
+
+	services := projects.newServices(path, project)
+	if err := services.recover(); err != nil {
+		services.close()
+		return projectServices{}, false, err
+	}
+	projects.projects[project] = services
+
+	return services, true, nil
+}
+
+func (projects *Projects) projectPath(project string) string {
+	return filepath.Join(projects.pathToStorageFolder, projectsFolder, project)
+}
+
+// CreateProject creates an empty project, unless the storage already
+// holds the maximum of projects.
+func (projects *Projects) CreateProject(ctx context.Context, project string) error {
+	if !IsValidProject(project) {
+		return &models.ParamsError{}
+	}
+	projects.Lock()
+	defer projects.Unlock()
+
+	names, err := projects.ListProjects(ctx)
+	if err != nil {
+		return err
+	}
+	path := projects.projectPath(project)
+	if _, err := os.Stat(path); err == nil {
+		return &models.ProjectExistsError{Name: project}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if limit := projects.options.Limits.MaxProjects; limit > 0 && len(names) >= limit {
+		return &models.ProjectLimitError{Limit: limit}
+	}
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return err
+	}
+	services := projects.newServices(path, project)
+	if err := services.recover(); err != nil {
+		services.close()
+		os.RemoveAll(path)
+		return err
+	}
+	projects.projects[project] = services
+
+	return nil
+}
+
+// ListProjects returns the names of the projects in the storage folder.
+func (projects *Projects) ListProjects(ctx context.Context) ([]string, error) {
+	folders, err := ioutil.ReadDir(filepath.Join(projects.pathToStorageFolder, projectsFolder))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if folder.IsDir() && IsValidProject(folder.Name()) {
+			names = append(names, folder.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Usage returns the usage of the storage folder and of all projects. The
+// quota tracker is shared by all of them and Recover opens every project,
+// so it is complete from the start.
+func (projects *Projects) Usage() models.QuotaUsage {
+	return projects.quotas.total()
+}
+
+// Close writes the buffered updates of all open projects to disk.
+func (projects *Projects) Close() {
+	projects.Lock()
+	defer projects.Unlock()
+
+	projects.root.close()
+	for _, services := range projects.projects {
+		services.close()
+	}
+}
+
+func (projects *Projects) CreateBMP(ctx context.Context, width, height int) (string, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", &models.ProjectError{Name: ProjectFromContext(ctx)}
+	}
+
+	return services.chartService.CreateBMP(ctx, width, height)
+}
+
+func (projects *Projects) UpdateBMP(ctx context.Context, id string, xPosition, yPosition, width, height int, receivedImage io.Reader) error {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+
+	return services.chartService.UpdateBMP(ctx, id, xPosition, yPosition, width, height, receivedImage)
+}
+
+func (projects *Projects) UpdateBMPBatch(ctx context.Context, id string, fragments []models.Fragment) error {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+
+	return services.chartService.UpdateBMPBatch(ctx, id, fragments)
+}
+
+func (projects *Projects) GetPartBMP(ctx context.Context, id string, xPosition, yPosition, width, height int) (image.Image, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &models.IdError{ID: id}
+	}
+
+	return services.chartService.GetPartBMP(ctx, id, xPosition, yPosition, width, height)
+}
+
+func (projects *Projects) GetPartsBMP(ctx context.Context, id string, regions []models.Region, write func(ind int, part image.Image) error) error {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+
+	return services.chartService.GetPartsBMP(ctx, id, regions, write)
+}
+
+func (projects *Projects) ListBMP(ctx context.Context) ([]models.ImageInfo, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return []models.ImageInfo{}, nil
+	}
+
+	return services.chartService.ListBMP(ctx)
+}
+
+func (projects *Projects) DeleteBMP(ctx context.Context, id string) error {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+
+	return services.chartService.DeleteBMP(ctx, id)
+}
+
+func (projects *Projects) CreateUpload(ctx context.Context, id string, xPosition, yPosition, width, height int, size int64, checksum string) (string, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", &models.IdError{ID: id}
+	}
+
+	return services.uploadService.CreateUpload(ctx, id, xPosition, yPosition, width, height, size, checksum)
+}
+
+func (projects *Projects) GetUploadOffset(ctx context.Context, id string, uploadID string) (int64, int64, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return 0, 0, &models.UploadIdError{ID: uploadID}
+	}
+
+	return services.uploadService.GetUploadOffset(ctx, id, uploadID)
+}
+
+func (projects *Projects) WriteUploadChunk(ctx context.Context, id string, uploadID string, offset int64, chunk io.Reader) (int64, bool, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		return 0, false, &models.UploadIdError{ID: uploadID}
+	}
+
+	return services.uploadService.WriteUploadChunk(ctx, id, uploadID, offset, chunk)
+}
+
+func (projects *Projects) DeleteUpload(ctx context.Context, id string, uploadID string) error {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.UploadIdError{ID: uploadID}
+	}
+
+	return services.uploadService.DeleteUpload(ctx, id, uploadID)
+}
+
+func (projects *Projects) GetACL(ctx context.Context, id string) (models.ACL, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return models.ACL{}, err
+	}
+	if !ok {
+		return models.ACL{}, &models.IdError{ID: id}
+	}
+
+	return services.chartService.GetACL(ctx, id)
+}
+
+func (projects *Projects) GrantAccess(ctx context.Context, id string, principal string, permissions []models.Permission) error {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+
+	return services.chartService.GrantAccess(ctx, id, principal, permissions)
+}
+
+func (projects *Projects) RevokeAccess(ctx context.Context, id string, principal string) error {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.IdError{ID: id}
+	}
+
+	return services.chartService.RevokeAccess(ctx, id, principal)
+}
+
+// GetQuota reports the usage of the tenant in all projects.
+func (projects *Projects) GetQuota(ctx context.Context) models.QuotaReport {
+	return projects.quotas.report(auth.TenantFromContext(ctx))
+}
+
+// GetCacheStats reports the cache shared by all projects.
+func (projects *Projects) GetCacheStats() models.CacheStats {
+	return projects.canvasCache.Stats()
+}
+
+func (projects *Projects) VerifyStorage(ctx context.Context) (models.VerifyReport, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return models.VerifyReport{}, err
+	}
+	if !ok {
+		return models.VerifyReport{}, &models.ProjectError{Name: ProjectFromContext(ctx)}
+	}
+
+	return services.chartService.VerifyStorage()
+}
+
+func (projects *Projects) Reconcile(ctx context.Context) (models.ReconcileReport, error) {
+	services, ok, err := projects.open(ctx)
+	if err != nil {
+		return models.ReconcileReport{}, err
+	}
+	if !ok {
+		return models.ReconcileReport{}, &models.ProjectError{Name: ProjectFromContext(ctx)}
+	}
+
+	report, err := services.chartService.Reconcile()
+	if err != nil {
+		return models.ReconcileReport{}, err
+	}
+	removedUploads, err := services.uploadService.removeOrphans()
+	if err != nil {
+		return models.ReconcileReport{}, err
+	}
+	report.RemovedFiles = append(report.RemovedFiles, removedUploads...)
+	sort.Strings(report.RemovedFiles)
+
+	return report, nil
+}
+
+// QueryAudit returns the audit entries of the project of the request.
+func (projects *Projects) QueryAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	if projects.options.AuditLog == nil {
+		return []models.AuditEntry{}, nil
+	}
+	filter.Project = ProjectFromContext(ctx)
+	if filter.Project != "" && !IsValidProject(filter.Project) {
+		return nil, &models.ParamsError{}
+	}
+
+	return projects.options.AuditLog.Query(filter)
+}
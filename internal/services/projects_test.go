@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"github.com/pmokeev/chartographer/internal/audit"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProjects(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	options := integerIDOptions()
+	options.Quotas.Default = models.Quota{MaxImages: 4}
+	options.Limits.MaxProjects = 2
+	projects := NewProjects(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(1<<20), options)
+	firstContext := WithProject(context.Background(), "dig-a")
+	secondContext := WithProject(context.Background(), "dig-b")
+
+	_, err := projects.CreateBMP(firstContext, 20, 20)
+	assert.Equal(t, &models.ProjectError{Name: "dig-a"}, err)
+	_, err = os.Stat(filepath.Join(pathToStorageFolder, projectsFolder, "dig-a"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, projects.CreateProject(context.Background(), "dig-a"))
+	assert.NoError(t, projects.CreateProject(context.Background(), "dig-b"))
+	assert.Equal(t, &models.ProjectExistsError{Name: "dig-a"}, projects.CreateProject(context.Background(), "dig-a"))
+	assert.Equal(t, &models.ProjectLimitError{Limit: 2}, projects.CreateProject(context.Background(), "dig-c"))
+	assert.IsType(t, &models.ParamsError{}, projects.CreateProject(context.Background(), "../dig-c"))
+
+	rootID, err := projects.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+	firstID, err := projects.CreateBMP(firstContext, 20, 20)
+	assert.NoError(t, err)
+	secondID, err := projects.CreateBMP(secondContext, 30, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "0", "0"}, []string{rootID, firstID, secondID})
+	_, err = os.Stat(filepath.Join(pathToStorageFolder, projectsFolder, "dig-a", "0.bmp"))
+	assert.NoError(t, err)
+
+	part, err := projects.GetPartBMP(secondContext, secondID, 0, 0, 30, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, part.Bounds().Dx())
+	images, err := projects.ListBMP(firstContext)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ImageInfo{{ID: "0", Width: 20, Height: 20}}, images)
+
+	_, err = projects.CreateBMP(firstContext, 1, 1)
+	assert.NoError(t, err)
+	_, err = projects.CreateBMP(secondContext, 1, 1)
+	assert.IsType(t, &models.QuotaError{}, err)
+	assert.Equal(t, int64(4), projects.GetQuota(secondContext).Usage.Images)
+	usage := projects.Usage()
+	assert.Equal(t, int64(4), usage.Images)
+	assert.Equal(t, int64(100+400+1+900), usage.Pixels)
+
+	unknownContext := WithProject(context.Background(), "unknown")
+	_, err = projects.GetPartBMP(unknownContext, "0", 0, 0, 1, 1)
+	assert.Equal(t, &models.IdError{ID: "0"}, err)
+	images, err = projects.ListBMP(unknownContext)
+	assert.NoError(t, err)
+	assert.Empty(t, images)
+	_, err = projects.VerifyStorage(unknownContext)
+	assert.Equal(t, &models.ProjectError{Name: "unknown"}, err)
+	_, err = projects.Reconcile(unknownContext)
+	assert.Equal(t, &models.ProjectError{Name: "unknown"}, err)
+	_, err = projects.ListBMP(WithProject(context.Background(), "../dig-a"))
+	assert.IsType(t, &models.ParamsError{}, err)
+
+	names, err := projects.ListProjects(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dig-a", "dig-b"}, names)
+	projects.Close()
+
+	reopenedProjects := NewProjects(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(1<<20), options)
+	assert.NoError(t, reopenedProjects.Recover())
+	assert.Equal(t, usage, reopenedProjects.Usage())
+	_, err = reopenedProjects.CreateBMP(context.Background(), 1, 1)
+	assert.IsType(t, &models.QuotaError{}, err)
+	images, err = reopenedProjects.ListBMP(firstContext)
+	assert.NoError(t, err)
+	assert.Len(t, images, 2)
+	assert.NoError(t, reopenedProjects.DeleteBMP(firstContext, firstID))
+	_, err = reopenedProjects.GetPartBMP(secondContext, secondID, 0, 0, 1, 1)
+	assert.NoError(t, err)
+	reopenedProjects.Close()
+}
+
+func TestProjects_Audit(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	auditLog, err := audit.Open(pathToStorageFolder, 0, 0)
+	assert.NoError(t, err)
+	defer auditLog.Close()
+	options := integerIDOptions()
+	options.AuditLog = auditLog
+	projects := NewProjects(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), options)
+	aliceContext := requestid.WithRequestID(auth.WithPrincipal(context.Background(), auth.Principal{Name: "alice", Tenant: "lab"}), "req-1")
+	bobContext := auth.WithPrincipal(WithProject(context.Background(), "dig-a"), auth.Principal{Name: "bob", Tenant: "lab"})
+
+	assert.NoError(t, projects.CreateProject(context.Background(), "dig-a"))
+	id, err := projects.CreateBMP(aliceContext, 10, 20)
+	assert.NoError(t, err)
+	assert.NoError(t, projects.GrantAccess(aliceContext, id, "bob", []models.Permission{models.PermissionRead}))
+	fragment := bytes.NewBuffer(nil)
+	assert.NoError(t, bmp.Encode(fragment, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+	assert.NoError(t, projects.UpdateBMPBatch(aliceContext, id, []models.Fragment{{XPosition: 1, YPosition: 2, Width: 2, Height: 2, Data: fragment.Bytes()}}))
+	deniedErr := projects.DeleteBMP(auth.WithPrincipal(context.Background(), auth.Principal{Name: "bob", Tenant: "lab"}), id)
+	assert.IsType(t, &models.PermissionError{}, deniedErr)
+	projectID, err := projects.CreateBMP(bobContext, 5, 5)
+	assert.NoError(t, err)
+	assert.NoError(t, projects.RevokeAccess(aliceContext, id, "bob"))
+	assert.NoError(t, projects.DeleteBMP(aliceContext, id))
+
+	entries, err := projects.QueryAudit(context.Background(), models.AuditFilter{CanvasID: id})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 6)
+	for ind := range entries {
+		assert.False(t, entries[ind].Time.IsZero())
+		entries[ind].Time = time.Time{}
+	}
+	assert.Equal(t, []models.AuditEntry{
+		{Action: models.AuditDelete, Principal: "alice", Tenant: "lab", CanvasID: id, RequestID: "req-1", Result: models.AuditOK},
+		{Action: models.AuditRevoke, Principal: "alice", Tenant: "lab", CanvasID: id, Grantee: "bob", RequestID: "req-1", Result: models.AuditOK},
+		{Action: models.AuditDelete, Principal: "bob", Tenant: "lab", CanvasID: id, Result: models.AuditDenied, Error: deniedErr.Error()},
+		{Action: models.AuditUpdate, Principal: "alice", Tenant: "lab", CanvasID: id, Fragments: []models.Region{{XPosition: 1, YPosition: 2, Width: 2, Height: 2}}, RequestID: "req-1", Result: models.AuditOK},
+		{Action: models.AuditGrant, Principal: "alice", Tenant: "lab", CanvasID: id, Grantee: "bob", Permissions: []models.Permission{models.PermissionRead}, RequestID: "req-1", Result: models.AuditOK},
+		{Action: models.AuditCreate, Principal: "alice", Tenant: "lab", CanvasID: id, Fragments: []models.Region{{Width: 10, Height: 20}}, RequestID: "req-1", Result: models.AuditOK},
+	}, entries)
+
+	entries, err = projects.QueryAudit(WithProject(context.Background(), "dig-a"), models.AuditFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "dig-a", entries[0].Project)
+	assert.Equal(t, projectID, entries[0].CanvasID)
+}
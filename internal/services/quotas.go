@@ -0,0 +1,108 @@
+package services
+
+import (
+	"github.com/pmokeev/chartographer/internal/models"
+	"sync"
+)
+
+// QuotaOptions are the allowances of tenants. Tenants without their own
+// quota get Default.
+type QuotaOptions struct {
+	Default models.Quota
+	Tenants map[string]models.Quota
+}
+
+// quotaTracker accounts usage per tenant against QuotaOptions.
+type quotaTracker struct {
+	options QuotaOptions
+	usage   map[string]models.QuotaUsage
+
+	sync.Mutex
+}
+
+func newQuotaTracker(options QuotaOptions) *quotaTracker {
+	return &quotaTracker{
+		options: options,
+		usage:   make(map[string]models.QuotaUsage, 0)}
+}
+
+func (tracker *quotaTracker) limits(tenant string) models.Quota {
+	if quota, ok := tracker.options.Tenants[tenant]; ok {
+		return quota
+	}
+
+	return tracker.options.Default
+}
+
+// reserve adds usage to the tenant unless it would exceed the quota.
+func (tracker *quotaTracker) reserve(tenant string, usage models.QuotaUsage) error {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	current := tracker.usage[tenant]
+	limits := tracker.limits(tenant)
+	for _, resource := range []struct {
+		name            string
+		current, change int64
+		limit           int64
+	}{
+		{"images", current.Images, usage.Images, limits.MaxImages},
+		{"pixels", current.Pixels, usage.Pixels, limits.MaxPixels},
+		{"bytes", current.Bytes, usage.Bytes, limits.MaxBytes},
+	} {
+		if resource.limit > 0 && resource.change > 0 && resource.current+resource.change > resource.limit {
+			return &models.QuotaError{Tenant: tenant, Resource: resource.name, Limit: resource.limit}
+		}
+	}
+	tracker.add(tenant, usage)
+
+	return nil
+}
+
+// adjust adds usage, which may be negative, to the tenant without checks.
+func (tracker *quotaTracker) adjust(tenant string, usage models.QuotaUsage) {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	tracker.add(tenant, usage)
+}
+
+func (tracker *quotaTracker) release(tenant string, usage models.QuotaUsage) {
+	tracker.adjust(tenant, models.QuotaUsage{Images: -usage.Images, Pixels: -usage.Pixels, Bytes: -usage.Bytes})
+}
+
+func (tracker *quotaTracker) report(tenant string) models.QuotaReport {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	return models.QuotaReport{Tenant: tenant, Usage: tracker.usage[tenant], Limits: tracker.limits(tenant)}
+}
+
+func (tracker *quotaTracker) add(tenant string, usage models.QuotaUsage) {
+	current := tracker.usage[tenant]
+	current.Images += usage.Images
+	current.Pixels += usage.Pixels
+	current.Bytes += usage.Bytes
+	tracker.usage[tenant] = current
+}
+
+// total returns the usage of all tenants together.
+func (tracker *quotaTracker) total() models.QuotaUsage {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	total := models.QuotaUsage{}
+	for _, usage := range tracker.usage {
+		total.Images += usage.Images
+		total.Pixels += usage.Pixels
+		total.Bytes += usage.Bytes
+	}
+
+	return total
+}
+
+// maxFileSize is the size of a canvas file encoded with alpha, the
+// largest encoding of an image of that size.
+func maxFileSize(width, height int) int64 {
+	return 54 + 4*int64(width)*int64(height)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/utils"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reconcile brings the storage folder and the registry back in line after
+// failed writes and deletes. It removes temporary files, files of images
+// that are not registered and drops registered images whose file is gone.
+func (chartService *ChartService) Reconcile() (models.ReconcileReport, error) {
+	chartService.workerPool.Acquire()
+	defer chartService.workerPool.Release()
+
+	report := models.ReconcileReport{RemovedFiles: []string{}, DroppedImages: []string{}}
+
+	// Images are dropped first, so their leftover files are removed below.
+	for _, currentImage := range chartService.imageRegistry.Images() {
+		dropped, err := chartService.dropImageWithoutFile(currentImage)
+		if err != nil {
+			return models.ReconcileReport{}, err
+		}
+		if dropped {
+			report.DroppedImages = append(report.DroppedImages, currentImage.ID)
+		}
+	}
+
+	files, err := ioutil.ReadDir(chartService.pathToStorageFolder)
+	if err != nil {
+		return models.ReconcileReport{}, err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		removed, err := chartService.reconcileFile(chartService.pathToStorageFolder, file.Name(), ".bmp", ".sha256", ".json")
+		if err != nil {
+			return models.ReconcileReport{}, err
+		}
+		if removed {
+			report.RemovedFiles = append(report.RemovedFiles, file.Name())
+		}
+	}
+
+	logs, err := ioutil.ReadDir(chartService.pathToWALFolder)
+	if err != nil && !os.IsNotExist(err) {
+		return models.ReconcileReport{}, err
+	}
+	for _, logFile := range logs {
+		removed, err := chartService.reconcileFile(chartService.pathToWALFolder, logFile.Name(), ".wal")
+		if err != nil {
+			return models.ReconcileReport{}, err
+		}
+		if removed {
+			report.RemovedFiles = append(report.RemovedFiles, filepath.Join(filepath.Base(chartService.pathToWALFolder), logFile.Name()))
+		}
+	}
+
+	sort.Strings(report.RemovedFiles)
+	sortIDs(report.DroppedImages)
+	zap.L().Info("Storage reconciled", zap.Int("removed_files", len(report.RemovedFiles)), zap.Int("dropped_images", len(report.DroppedImages)))
+
+	return report, nil
+}
+
+// reconcileFile removes the file if it is a temporary file or a file with
+// one of the extensions of an image that is not registered. Temporary
+// files of registered images are removed under the image lock, so writes
+// in progress are not disturbed.
+func (chartService *ChartService) reconcileFile(folder, name string, extensions ...string) (bool, error) {
+	if strings.HasSuffix(name, utils.TempFileSuffix) {
+		if id := strings.SplitN(name, ".", 2)[0]; utils.IsValidID(id) {
+			if currentImage, ok := chartService.imageRegistry.Get(id); ok {
+				lockImage(currentImage)
+				defer currentImage.Unlock()
+			}
+		}
+
+		return removeFile(filepath.Join(folder, name))
+	}
+
+	for _, extension := range extensions {
+		if id, ok := parseFileID(name, extension); ok && !chartService.isRegistered(id) {
+			return removeFile(filepath.Join(folder, name))
+		}
+	}
+
+	return false, nil
+}
+
+func (chartService *ChartService) dropImageWithoutFile(currentImage *models.Image) (bool, error) {
+	lockImage(currentImage)
+	defer currentImage.Unlock()
+
+	if !currentImage.IsExist {
+		return false, nil
+	}
+	if _, err := os.Stat(currentImage.Filepath); !os.IsNotExist(err) {
+		return false, err
+	}
+
+	chartService.forgetImage(currentImage)
+
+	return true, nil
+}
+
+// removeFile removes the file at path and reports whether it was there.
+func removeFile(path string) (bool, error) {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
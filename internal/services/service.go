@@ -1,20 +1,105 @@
 package services
 
-import "image"
+import (
+	"context"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/pmokeev/chartographer/internal/workers"
+	"image"
+	"io"
+)
 
 //go:generate mockgen -source=service.go -destination=./mocks/mock.go
 
 type ChartographerServicer interface {
-	CreateBMP(width, height int) (int, error)
-	UpdateBMP(id, xPosition, yPosition, width, height int, receivedImage []byte) error
-	GetPartBMP(id, xPosition, yPosition, width, height int) (image.Image, error)
-	DeleteBMP(id int) error
+	CreateBMP(ctx context.Context, width, height int) (string, error)
+	UpdateBMP(ctx context.Context, id string, xPosition, yPosition, width, height int, receivedImage io.Reader) error
+	UpdateBMPBatch(ctx context.Context, id string, fragments []models.Fragment) error
+	GetPartBMP(ctx context.Context, id string, xPosition, yPosition, width, height int) (image.Image, error)
+	GetPartsBMP(ctx context.Context, id string, regions []models.Region, write func(ind int, part image.Image) error) error
+	ListBMP(ctx context.Context) ([]models.ImageInfo, error)
+	DeleteBMP(ctx context.Context, id string) error
+}
+
+type ChartographerUploader interface {
+	CreateUpload(ctx context.Context, id string, xPosition, yPosition, width, height int, size int64, checksum string) (string, error)
+	GetUploadOffset(ctx context.Context, id string, uploadID string) (int64, int64, error)
+	WriteUploadChunk(ctx context.Context, id string, uploadID string, offset int64, chunk io.Reader) (int64, bool, error)
+	DeleteUpload(ctx context.Context, id string, uploadID string) error
+}
+
+type ChartographerAccessManager interface {
+	GetACL(ctx context.Context, id string) (models.ACL, error)
+	GrantAccess(ctx context.Context, id string, principal string, permissions []models.Permission) error
+	RevokeAccess(ctx context.Context, id string, principal string) error
+}
+
+type ChartographerQuotaReporter interface {
+	GetQuota(ctx context.Context) models.QuotaReport
+}
+
+type ChartographerAdministrator interface {
+	GetCacheStats() models.CacheStats
+	VerifyStorage(ctx context.Context) (models.VerifyReport, error)
+	Reconcile(ctx context.Context) (models.ReconcileReport, error)
+	QueryAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type ChartographerProjectManager interface {
+	ListProjects(ctx context.Context) ([]string, error)
+	CreateProject(ctx context.Context, project string) error
 }
 
 type Service struct {
 	ChartographerServicer
+	ChartographerUploader
+	ChartographerAccessManager
+	ChartographerQuotaReporter
+	ChartographerAdministrator
+	ChartographerProjectManager
+
+	projects *Projects
+}
+
+func NewService(pathToStorageFolder string, workerPool *workers.Pool, canvasCache *cache.CanvasCache, options Options) *Service {
+	projects := NewProjects(pathToStorageFolder, workerPool, canvasCache, options)
+
+	return &Service{
+		ChartographerServicer:       projects,
+		ChartographerUploader:       projects,
+		ChartographerAccessManager:  projects,
+		ChartographerQuotaReporter:  projects,
+		ChartographerAdministrator:  projects,
+		ChartographerProjectManager: projects,
+		projects:                    projects}
+}
+
+// Recover restores the canvases stored by a previous run in and outside
+// of projects. It has to be called before the service is used.
+func (service *Service) Recover() error {
+	return service.projects.Recover()
+}
+
+// ExportBMP writes the whole image with the given id in the project of
+// ctx to writer.
+func (service *Service) ExportBMP(ctx context.Context, id string, writer io.Writer) error {
+	services, ok, err := service.projects.open(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &models.ProjectError{Name: ProjectFromContext(ctx)}
+	}
+
+	return services.chartService.ExportBMP(id, writer)
+}
+
+// Usage returns what the stored images take up in and outside of projects.
+func (service *Service) Usage() models.QuotaUsage {
+	return service.projects.Usage()
 }
 
-func NewService(pathToStorageFolder string) *Service {
-	return &Service{ChartographerServicer: NewChartService(pathToStorageFolder)}
+// Close writes buffered updates to disk.
+func (service *Service) Close() {
+	service.projects.Close()
 }
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/models"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const uploadsFolder = "uploads"
+
+// UploadOptions bound resumable uploads. MaxBytes caps the declared size
+// of an upload and uploads without a chunk written for TTL are dropped
+// with their staged file. Zero values mean no limit.
+type UploadOptions struct {
+	MaxBytes int64
+	TTL      time.Duration
+}
+
+type UploadService struct {
+	chartService        *ChartService
+	uploadMap           map[string]*models.Upload
+	pathToUploadsFolder string
+	stop                chan struct{}
+	done                chan struct{}
+
+	sync.Mutex
+}
+
+func NewUploadService(chartService *ChartService) *UploadService {
+	uploadService := &UploadService{
+		chartService:        chartService,
+		uploadMap:           make(map[string]*models.Upload, 0),
+		pathToUploadsFolder: filepath.Join(chartService.pathToStorageFolder, uploadsFolder),
+		stop:                make(chan struct{}),
+		done:                make(chan struct{})}
+	if ttl := chartService.options.Uploads.TTL; ttl > 0 && !chartService.options.ReadOnly {
+		go uploadService.run(ttl)
+	} else {
+		close(uploadService.done)
+	}
+
+	return uploadService
+}
+
+// run drops expired uploads until Close. Uploads expire at most half a TTL
+// or a minute late.
+func (uploadService *UploadService) run(ttl time.Duration) {
+	defer close(uploadService.done)
+
+	interval := ttl / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			uploadService.expire(now)
+		case <-uploadService.stop:
+			return
+		}
+	}
+}
+
+// Close stops dropping expired uploads.
+func (uploadService *UploadService) Close() {
+	select {
+	case <-uploadService.stop:
+	default:
+		close(uploadService.stop)
+	}
+	<-uploadService.done
+}
+
+// expire drops the uploads without a chunk written for the TTL and
+// releases the bytes they reserved.
+func (uploadService *UploadService) expire(now time.Time) {
+	uploadService.Lock()
+	uploads := make([]*models.Upload, 0, len(uploadService.uploadMap))
+	for _, currentUpload := range uploadService.uploadMap {
+		uploads = append(uploads, currentUpload)
+	}
+	uploadService.Unlock()
+
+	for _, currentUpload := range uploads {
+		currentUpload.Lock()
+		if !currentUpload.Removed && now.Sub(currentUpload.LastWrite) >= uploadService.chartService.options.Uploads.TTL {
+			if err := uploadService.removeUpload(currentUpload); err != nil {
+				zap.L().Error("Removing expired upload failed", zap.String("upload_id", currentUpload.ID), zap.Error(err))
+			}
+		}
+		currentUpload.Unlock()
+	}
+}
+
+// removeOrphans removes the staged files of uploads that are not in
+// progress, like the ones left behind by a previous run.
+func (uploadService *UploadService) removeOrphans() ([]string, error) {
+	uploadService.Lock()
+	defer uploadService.Unlock()
+
+	files, err := ioutil.ReadDir(uploadService.pathToUploadsFolder)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]string, 0)
+	for _, file := range files {
+		uploadID := strings.TrimSuffix(file.Name(), ".part")
+		if file.IsDir() || uploadID == file.Name() {
+			continue
+		}
+		if _, ok := uploadService.uploadMap[uploadID]; ok {
+			continue
+		}
+		ok, err := removeFile(filepath.Join(uploadService.pathToUploadsFolder, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			removed = append(removed, filepath.Join(uploadsFolder, file.Name()))
+		}
+	}
+
+	return removed, nil
+}
+
+// maxFragmentSize is the size of the largest BMP of a fragment the decoder
+// accepts: a file header, a version 5 info header, a full palette and four
+// bytes per pixel.
+func maxFragmentSize(width, height int) int64 {
+	return 14 + 124 + 1024 + 4*int64(width)*int64(height)
+}
+
+func (uploadService *UploadService) CreateUpload(ctx context.Context, id string, xPosition, yPosition, width, height int, size int64, checksum string) (string, error) {
+	checksum = strings.ToLower(checksum)
+	if width <= 0 || height <= 0 || size <= 0 || len(checksum) != sha256.Size*2 {
+		return "", &models.ParamsError{}
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return "", &models.ParamsError{}
+	}
+	if size > maxFragmentSize(width, height) {
+		return "", &models.ParamsError{}
+	}
+	if maxBytes := uploadService.chartService.options.Uploads.MaxBytes; maxBytes > 0 && size > maxBytes {
+		return "", &models.SizeLimitError{Limit: maxBytes}
+	}
+
+	currentImage, ok := uploadService.chartService.imageRegistry.Get(id)
+	if !ok {
+		return "", &models.IdError{ID: id}
+	}
+	rLockImage(currentImage)
+	err := checkUpdate(ctx, currentImage, xPosition, yPosition)
+	currentImage.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(uploadService.pathToUploadsFolder, 0777); err != nil {
+		return "", err
+	}
+	currentUpload := models.NewUpload(uploadID, id, xPosition, yPosition, width, height, size, checksum, filepath.Join(uploadService.pathToUploadsFolder, uploadID+".part"))
+	currentUpload.Tenant = auth.TenantFromContext(ctx)
+	currentUpload.Principal = ownerFromContext(ctx)
+	currentUpload.LastWrite = time.Now()
+	if err := uploadService.chartService.quotas.reserve(currentUpload.Tenant, models.QuotaUsage{Bytes: size}); err != nil {
+		return "", err
+	}
+
+	// The file is created with the lock held, so removeOrphans never
+	// takes it for a leftover.
+	uploadService.Lock()
+	defer uploadService.Unlock()
+
+	file, err := os.Create(currentUpload.Filepath)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		uploadService.chartService.quotas.release(currentUpload.Tenant, models.QuotaUsage{Bytes: size})
+		os.Remove(currentUpload.Filepath)
+		return "", err
+	}
+	uploadService.uploadMap[uploadID] = currentUpload
+
+	return uploadID, nil
+}
+
+func (uploadService *UploadService) GetUploadOffset(ctx context.Context, id string, uploadID string) (int64, int64, error) {
+	currentUpload, err := uploadService.getUpload(ctx, id, uploadID)
+	if err != nil {
+		return 0, 0, err
+	}
+	currentUpload.Lock()
+	defer currentUpload.Unlock()
+
+	if currentUpload.Removed {
+		return 0, 0, &models.UploadIdError{ID: uploadID}
+	}
+
+	return currentUpload.Offset, currentUpload.Size, nil
+}
+
+func (uploadService *UploadService) WriteUploadChunk(ctx context.Context, id string, uploadID string, offset int64, chunk io.Reader) (int64, bool, error) {
+	currentUpload, err := uploadService.getUpload(ctx, id, uploadID)
+	if err != nil {
+		return 0, false, err
+	}
+	currentUpload.Lock()
+	defer currentUpload.Unlock()
+
+	if currentUpload.Removed {
+		return 0, false, &models.UploadIdError{ID: uploadID}
+	}
+	if offset != currentUpload.Offset {
+		return currentUpload.Offset, false, &models.OffsetError{Expected: currentUpload.Offset, Actual: offset}
+	}
+
+	file, err := os.OpenFile(currentUpload.Filepath, os.O_WRONLY, 0777)
+	if err != nil {
+		return currentUpload.Offset, false, err
+	}
+	if _, err := file.Seek(currentUpload.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return currentUpload.Offset, false, err
+	}
+	written, copyErr := io.Copy(file, io.LimitReader(chunk, currentUpload.Size-currentUpload.Offset))
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return currentUpload.Offset, false, err
+	}
+	if err := file.Close(); err != nil {
+		return currentUpload.Offset, false, err
+	}
+	currentUpload.Offset += written
+	currentUpload.LastWrite = time.Now()
+	if copyErr != nil {
+		return currentUpload.Offset, false, copyErr
+	}
+
+	if currentUpload.Offset < currentUpload.Size {
+		return currentUpload.Offset, false, nil
+	}
+
+	if err := uploadService.commitUpload(ctx, currentUpload); err != nil {
+		return currentUpload.Offset, false, err
+	}
+
+	return currentUpload.Offset, true, nil
+}
+
+func (uploadService *UploadService) DeleteUpload(ctx context.Context, id string, uploadID string) error {
+	currentUpload, err := uploadService.getUpload(ctx, id, uploadID)
+	if err != nil {
+		return err
+	}
+	currentUpload.Lock()
+	defer currentUpload.Unlock()
+
+	if currentUpload.Removed {
+		return &models.UploadIdError{ID: uploadID}
+	}
+
+	return uploadService.removeUpload(currentUpload)
+}
+
+// getUpload returns the upload if it was started by the caller or the
+// caller is an admin.
+func (uploadService *UploadService) getUpload(ctx context.Context, id string, uploadID string) (*models.Upload, error) {
+	uploadService.Lock()
+	defer uploadService.Unlock()
+
+	currentUpload, ok := uploadService.uploadMap[uploadID]
+	if !ok || currentUpload.ImageID != id {
+		return nil, &models.UploadIdError{ID: uploadID}
+	}
+	principal, _ := auth.PrincipalFromContext(ctx)
+	if principal.Name != currentUpload.Principal && !principal.HasRole(auth.RoleAdmin) {
+		return nil, &models.PermissionError{ID: id, Permission: models.PermissionWrite}
+	}
+
+	return currentUpload, nil
+}
+
+// commitUpload draws the complete upload onto its canvas and drops it. It
+// is dropped even if drawing fails, as a complete upload can not be
+// resumed, so its file and reserved bytes are not held until it expires.
+func (uploadService *UploadService) commitUpload(ctx context.Context, currentUpload *models.Upload) error {
+	err := uploadService.applyUpload(ctx, currentUpload)
+	if removeErr := uploadService.removeUpload(currentUpload); err == nil {
+		err = removeErr
+	}
+
+	return err
+}
+
+func (uploadService *UploadService) applyUpload(ctx context.Context, currentUpload *models.Upload) error {
+	actualChecksum, err := fileChecksum(currentUpload.Filepath)
+	if err != nil {
+		return err
+	}
+	if actualChecksum != currentUpload.Checksum {
+		return &models.ChecksumError{Expected: currentUpload.Checksum, Actual: actualChecksum}
+	}
+
+	receivedImage, err := os.Open(currentUpload.Filepath)
+	if err != nil {
+		return err
+	}
+	err = uploadService.chartService.UpdateBMP(ctx, currentUpload.ImageID, currentUpload.XPosition, currentUpload.YPosition, currentUpload.Width, currentUpload.Height, receivedImage)
+	if closeErr := receivedImage.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// removeUpload drops the upload and its staged file. The lock of the
+// upload has to be held.
+func (uploadService *UploadService) removeUpload(currentUpload *models.Upload) error {
+	currentUpload.Removed = true
+	uploadService.Lock()
+	if _, ok := uploadService.uploadMap[currentUpload.ID]; ok {
+		delete(uploadService.uploadMap, currentUpload.ID)
+		uploadService.chartService.quotas.release(currentUpload.Tenant, models.QuotaUsage{Bytes: currentUpload.Size})
+	}
+	uploadService.Unlock()
+
+	if err := os.Remove(currentUpload.Filepath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func newUploadID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buffer), nil
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pmokeev/chartographer/internal/auth"
+	"github.com/pmokeev/chartographer/internal/cache"
+	"github.com/pmokeev/chartographer/internal/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUploadService_WriteUploadChunk(t *testing.T) {
+	pathToStorageFolder := "../utils/testData/updateBMP/"
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+	checksum := sha256.Sum256(data)
+
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err = currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+	defer os.RemoveAll(filepath.Join(pathToStorageFolder, "uploads"))
+
+	uploadID, err := currentService.CreateUpload(context.Background(), "0", 0, 0, 124, 124, int64(len(data)), hex.EncodeToString(checksum[:]))
+	assert.NoError(t, err)
+
+	half := int64(len(data) / 2)
+	offset, completed, err := currentService.WriteUploadChunk(context.Background(), "0", uploadID, 0, bytes.NewReader(data[:half]))
+	assert.NoError(t, err)
+	assert.False(t, completed)
+	assert.Equal(t, half, offset)
+
+	offset, size, err := currentService.GetUploadOffset(context.Background(), "0", uploadID)
+	assert.NoError(t, err)
+	assert.Equal(t, half, offset)
+	assert.Equal(t, int64(len(data)), size)
+
+	_, _, err = currentService.WriteUploadChunk(context.Background(), "0", uploadID, 0, bytes.NewReader(data))
+	assert.IsType(t, &models.OffsetError{}, err)
+
+	offset, completed, err = currentService.WriteUploadChunk(context.Background(), "0", uploadID, half, bytes.NewReader(data[half:]))
+	assert.NoError(t, err)
+	assert.True(t, completed)
+	assert.Equal(t, int64(len(data)), offset)
+
+	_, _, err = currentService.GetUploadOffset(context.Background(), "0", uploadID)
+	assert.IsType(t, &models.UploadIdError{}, err)
+
+	expectedFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, "correct0.bmp"), os.O_RDONLY, 0777)
+	assert.NoError(t, err)
+	expectedImage, err := bmp.Decode(expectedFile)
+	assert.NoError(t, err)
+	err = expectedFile.Close()
+	assert.NoError(t, err)
+
+	actualFile, err := os.OpenFile(filepath.Join(pathToStorageFolder, "0"+".bmp"), os.O_RDONLY, 0777)
+	assert.NoError(t, err)
+	actualImage, err := bmp.Decode(actualFile)
+	assert.NoError(t, err)
+	err = actualFile.Close()
+	assert.NoError(t, err)
+
+	assert.True(t, isEqualImages(actualImage, expectedImage))
+}
+
+func TestUploadService_WriteUploadChunk_WrongChecksum(t *testing.T) {
+	pathToStorageFolder := "../utils/testData/updateBMP/"
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+	checksum := sha256.Sum256(data[1:])
+
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err = currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+	defer os.RemoveAll(filepath.Join(pathToStorageFolder, "uploads"))
+
+	uploadID, err := currentService.CreateUpload(context.Background(), "0", 0, 0, 124, 124, int64(len(data)), hex.EncodeToString(checksum[:]))
+	assert.NoError(t, err)
+
+	_, completed, err := currentService.WriteUploadChunk(context.Background(), "0", uploadID, 0, bytes.NewReader(data))
+	assert.IsType(t, &models.ChecksumError{}, err)
+	assert.False(t, completed)
+
+	_, _, err = currentService.GetUploadOffset(context.Background(), "0", uploadID)
+	assert.IsType(t, &models.UploadIdError{}, err)
+}
+
+func TestUploadService_WriteUploadChunk_CommitFailed(t *testing.T) {
+	data, err := ioutil.ReadFile("../utils/testData/common/testImage.bmp")
+	assert.NoError(t, err)
+	checksum := sha256.Sum256(data)
+
+	pathToStorageFolder := t.TempDir()
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	id, err := currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	used := currentService.GetQuota(context.Background()).Usage.Bytes
+
+	uploadID, err := currentService.CreateUpload(context.Background(), id, 0, 0, 100, 124, int64(len(data)), hex.EncodeToString(checksum[:]))
+	assert.NoError(t, err)
+	assert.Equal(t, used+int64(len(data)), currentService.GetQuota(context.Background()).Usage.Bytes)
+
+	_, completed, err := currentService.WriteUploadChunk(context.Background(), id, uploadID, 0, bytes.NewReader(data))
+	assert.Equal(t, &models.SizeMismatchError{ExpectedWidth: 100, ExpectedHeight: 124, ActualWidth: 124, ActualHeight: 124}, err)
+	assert.False(t, completed)
+
+	_, _, err = currentService.GetUploadOffset(context.Background(), id, uploadID)
+	assert.IsType(t, &models.UploadIdError{}, err)
+	assert.Equal(t, used, currentService.GetQuota(context.Background()).Usage.Bytes)
+	assert.NoFileExists(t, filepath.Join(pathToStorageFolder, uploadsFolder, uploadID+".part"))
+}
+
+func TestUploadService_CreateUpload(t *testing.T) {
+	tests := []struct {
+		testName     string
+		id           string
+		xPosition    int
+		yPosition    int
+		width        int
+		height       int
+		size         int64
+		checksum     string
+		expectedType error
+	}{
+		{
+			testName:     "OK",
+			id:           "0",
+			width:        124,
+			height:       124,
+			size:         1,
+			checksum:     "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855",
+			expectedType: nil,
+		},
+		{
+			testName:     "Wrong id",
+			id:           "1",
+			width:        124,
+			height:       124,
+			size:         1,
+			checksum:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectedType: &models.IdError{},
+		},
+		{
+			testName:     "Wrong size",
+			id:           "0",
+			width:        124,
+			height:       124,
+			size:         0,
+			checksum:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectedType: &models.ParamsError{},
+		},
+		{
+			testName:     "Wrong checksum",
+			id:           "0",
+			width:        124,
+			height:       124,
+			size:         1,
+			checksum:     "helloWorld",
+			expectedType: &models.ParamsError{},
+		},
+		{
+			testName:     "Size above fragment",
+			id:           "0",
+			width:        1,
+			height:       1,
+			size:         14 + 124 + 1024 + 5,
+			checksum:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectedType: &models.ParamsError{},
+		},
+		{
+			testName:     "Out of image",
+			id:           "0",
+			xPosition:    124,
+			width:        124,
+			height:       124,
+			size:         1,
+			checksum:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			expectedType: &models.ParamsError{},
+		},
+	}
+
+	pathToStorageFolder := "../utils/testData/updateBMP/"
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), integerIDOptions())
+	_, err := currentService.CreateBMP(context.Background(), 124, 124)
+	assert.NoError(t, err)
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".bmp")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".sha256")
+	defer os.Remove(pathToStorageFolder + "/" + "0" + ".json")
+	defer os.RemoveAll(filepath.Join(pathToStorageFolder, "uploads"))
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			uploadID, err := currentService.CreateUpload(context.Background(), test.id, test.xPosition, test.yPosition, test.width, test.height, test.size, test.checksum)
+			if test.expectedType != nil {
+				assert.IsType(t, test.expectedType, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			err = currentService.DeleteUpload(context.Background(), test.id, uploadID)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestUploadService_CreateUpload_Quota(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	labContext := auth.WithPrincipal(context.Background(), auth.Principal{Tenant: "lab"})
+	id, err := currentService.CreateBMP(labContext, 10, 10)
+	assert.NoError(t, err)
+	used := currentService.GetQuota(labContext).Usage.Bytes
+
+	currentService.projects.root.chartService.quotas.options.Tenants = map[string]models.Quota{"lab": {MaxBytes: used + 10}}
+	checksum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	_, err = currentService.CreateUpload(labContext, id, 0, 0, 1, 1, 11, checksum)
+	assert.Equal(t, &models.QuotaError{Tenant: "lab", Resource: "bytes", Limit: used + 10}, err)
+
+	uploadID, err := currentService.CreateUpload(labContext, id, 0, 0, 1, 1, 10, checksum)
+	assert.NoError(t, err)
+	assert.Equal(t, used+10, currentService.GetQuota(labContext).Usage.Bytes)
+	assert.NoError(t, currentService.DeleteUpload(labContext, id, uploadID))
+	assert.Equal(t, used, currentService.GetQuota(labContext).Usage.Bytes)
+}
+
+func TestUploadService_CreateUpload_MaxBytes(t *testing.T) {
+	options := DefaultOptions()
+	options.Uploads.MaxBytes = 100
+	currentService := NewService(t.TempDir(), testWorkerPool, cache.NewCanvasCache(0), options)
+	id, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+
+	checksum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	_, err = currentService.CreateUpload(context.Background(), id, 0, 0, 10, 10, 101, checksum)
+	assert.Equal(t, &models.SizeLimitError{Limit: 100}, err)
+
+	uploadID, err := currentService.CreateUpload(context.Background(), id, 0, 0, 10, 10, 100, checksum)
+	assert.NoError(t, err)
+	assert.NoError(t, currentService.DeleteUpload(context.Background(), id, uploadID))
+}
+
+func TestUploadService_Expire(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	defer currentService.Close()
+	labContext := auth.WithPrincipal(context.Background(), auth.Principal{Tenant: "lab"})
+	id, err := currentService.CreateBMP(labContext, 10, 10)
+	assert.NoError(t, err)
+	used := currentService.GetQuota(labContext).Usage.Bytes
+
+	checksum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	uploadID, err := currentService.CreateUpload(labContext, id, 0, 0, 1, 1, 10, checksum)
+	assert.NoError(t, err)
+	uploadService := currentService.projects.root.uploadService
+
+	uploadService.expire(time.Now())
+	_, _, err = currentService.GetUploadOffset(labContext, id, uploadID)
+	assert.NoError(t, err)
+
+	uploadService.expire(time.Now().Add(DefaultOptions().Uploads.TTL))
+	_, _, err = currentService.GetUploadOffset(labContext, id, uploadID)
+	assert.IsType(t, &models.UploadIdError{}, err)
+	assert.Equal(t, used, currentService.GetQuota(labContext).Usage.Bytes)
+	_, err = os.Stat(filepath.Join(pathToStorageFolder, "uploads", uploadID+".part"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploadService_RemoveOrphans(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	uploadsFolder := filepath.Join(pathToStorageFolder, "uploads")
+	assert.NoError(t, os.MkdirAll(uploadsFolder, 0777))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(uploadsFolder, "stale.part"), []byte("data"), 0666))
+
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	defer currentService.Close()
+	assert.NoError(t, currentService.Recover())
+	_, err := os.Stat(filepath.Join(uploadsFolder, "stale.part"))
+	assert.True(t, os.IsNotExist(err))
+
+	id, err := currentService.CreateBMP(context.Background(), 10, 10)
+	assert.NoError(t, err)
+	checksum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	uploadID, err := currentService.CreateUpload(context.Background(), id, 0, 0, 1, 1, 10, checksum)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(uploadsFolder, "stale.part"), []byte("data"), 0666))
+
+	report, err := currentService.Reconcile(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("uploads", "stale.part")}, report.RemovedFiles)
+	_, _, err = currentService.GetUploadOffset(context.Background(), id, uploadID)
+	assert.NoError(t, err)
+}
+
+func TestUploadService_AccessControl(t *testing.T) {
+	pathToStorageFolder := t.TempDir()
+	currentService := NewService(pathToStorageFolder, testWorkerPool, cache.NewCanvasCache(0), DefaultOptions())
+	aliceContext := auth.WithPrincipal(context.Background(), auth.Principal{Name: "alice"})
+	bobContext := auth.WithPrincipal(context.Background(), auth.Principal{Name: "bob"})
+	id, err := currentService.CreateBMP(aliceContext, 10, 10)
+	assert.NoError(t, err)
+
+	checksum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	_, err = currentService.CreateUpload(bobContext, id, 0, 0, 1, 1, 10, checksum)
+	assert.Equal(t, &models.PermissionError{ID: id, Permission: models.PermissionWrite}, err)
+
+	assert.NoError(t, currentService.GrantAccess(aliceContext, id, "bob", []models.Permission{models.PermissionWrite}))
+	uploadID, err := currentService.CreateUpload(bobContext, id, 0, 0, 1, 1, 10, checksum)
+	assert.NoError(t, err)
+	_, _, err = currentService.GetUploadOffset(aliceContext, id, uploadID)
+	assert.IsType(t, &models.PermissionError{}, err)
+	assert.NoError(t, currentService.DeleteUpload(bobContext, id, uploadID))
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// WriteBackOptions controls buffering of canvas updates. Updates are made
+// durable in a write-ahead log right away and written to the canvas files
+// every FlushInterval or once MaxDirtyBytes of updates have piled up.
+// With both zero every update is written to its canvas file directly.
+type WriteBackOptions struct {
+	FlushInterval time.Duration
+	MaxDirtyBytes int64
+}
+
+func (options WriteBackOptions) enabled() bool {
+	return options.FlushInterval > 0 || options.MaxDirtyBytes > 0
+}
+
+// writeBackBuffer tracks canvases with updates that are only in their
+// write-ahead logs and wakes the flusher when they have to be written.
+type writeBackBuffer struct {
+	options    WriteBackOptions
+	dirty      map[string]int64
+	dirtyBytes int64
+	flushes    chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+
+	sync.Mutex
+}
+
+func newWriteBackBuffer(options WriteBackOptions) *writeBackBuffer {
+	return &writeBackBuffer{
+		options: options,
+		dirty:   make(map[string]int64, 0),
+		flushes: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{})}
+}
+
+// run calls flush on every tick and whenever the dirty bytes threshold is
+// crossed, until close.
+func (buffer *writeBackBuffer) run(flush func()) {
+	defer close(buffer.done)
+
+	var ticks <-chan time.Time
+	if buffer.options.FlushInterval > 0 {
+		ticker := time.NewTicker(buffer.options.FlushInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ticks:
+			flush()
+		case <-buffer.flushes:
+			flush()
+		case <-buffer.stop:
+			flush()
+			return
+		}
+	}
+}
+
+func (buffer *writeBackBuffer) close() {
+	close(buffer.stop)
+	<-buffer.done
+}
+
+func (buffer *writeBackBuffer) markDirty(id string, size int64) {
+	buffer.Lock()
+	buffer.dirty[id] += size
+	buffer.dirtyBytes += size
+	overflow := buffer.options.MaxDirtyBytes > 0 && buffer.dirtyBytes >= buffer.options.MaxDirtyBytes
+	buffer.Unlock()
+
+	if overflow {
+		select {
+		case buffer.flushes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (buffer *writeBackBuffer) markClean(id string) {
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	buffer.dirtyBytes -= buffer.dirty[id]
+	delete(buffer.dirty, id)
+}
+
+func (buffer *writeBackBuffer) isDirty(id string) bool {
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	_, ok := buffer.dirty[id]
+	return ok
+}
+
+func (buffer *writeBackBuffer) dirtyIDs() []string {
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	ids := make([]string, 0, len(buffer.dirty))
+	for id := range buffer.dirty {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
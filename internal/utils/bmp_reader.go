@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"golang.org/x/image/bmp"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// BMPReader decodes an uncompressed BMP image row by row without keeping
+// the whole image in memory.
+type BMPReader struct {
+	Width  int
+	Height int
+
+	reader       io.Reader
+	bitsPerPixel int
+	topDown      bool
+	palette      color.Palette
+	buffer       []byte
+	rowsRead     int
+	spool        *os.File
+}
+
+// NewBMPReader reads the header of the image. Width and Height come from
+// the header, so callers check them before reading any rows.
+func NewBMPReader(reader io.Reader) (*BMPReader, error) {
+	header := bytes.NewBuffer(nil)
+	config, err := bmp.DecodeConfig(io.TeeReader(reader, header))
+	if err != nil {
+		return nil, err
+	}
+
+	headerBytes := header.Bytes()
+	bitsPerPixel := int(headerBytes[28]) | int(headerBytes[29])<<8
+	topDown := headerBytes[25]&0x80 != 0
+	palette, _ := config.ColorModel.(color.Palette)
+
+	return &BMPReader{
+		Width:        config.Width,
+		Height:       config.Height,
+		reader:       reader,
+		bitsPerPixel: bitsPerPixel,
+		topDown:      topDown,
+		palette:      palette}, nil
+}
+
+// Spool reads the rows that are left ahead, into memory if they take at
+// most maxMemory bytes and into a temporary file otherwise, so ReadRow no
+// longer waits on the source. Close removes the file.
+func (bmpReader *BMPReader) Spool(maxMemory int64) error {
+	size := int64(bmpReader.rowSize()) * int64(bmpReader.Height-bmpReader.rowsRead)
+	if size <= maxMemory {
+		buffer := make([]byte, size)
+		if _, err := io.ReadFull(bmpReader.reader, buffer); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		bmpReader.reader = bytes.NewReader(buffer)
+		return nil
+	}
+
+	spool, err := ioutil.TempFile("", "fragment-*.spool")
+	if err != nil {
+		return err
+	}
+	bmpReader.spool = spool
+	written, err := io.Copy(spool, io.LimitReader(bmpReader.reader, size))
+	if err != nil {
+		return err
+	}
+	if written < size {
+		return io.ErrUnexpectedEOF
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	bmpReader.reader = bufio.NewReader(spool)
+
+	return nil
+}
+
+// Close removes the temporary file of Spool, if there is one.
+func (bmpReader *BMPReader) Close() error {
+	if bmpReader.spool == nil {
+		return nil
+	}
+	err := bmpReader.spool.Close()
+	if removeErr := os.Remove(bmpReader.spool.Name()); err == nil {
+		err = removeErr
+	}
+	bmpReader.spool = nil
+
+	return err
+}
+
+func (bmpReader *BMPReader) rowSize() int {
+	return (bmpReader.bitsPerPixel*bmpReader.Width/8 + 3) &^ 3
+}
+
+// ReadRow reads the next stored row into row as non-premultiplied RGBA
+// and returns its y coordinate. BMP images are usually stored bottom-up,
+// so rows do not come in increasing y order. It returns io.EOF after the
+// last row.
+func (bmpReader *BMPReader) ReadRow(row []byte) (int, error) {
+	if bmpReader.rowsRead == bmpReader.Height {
+		return 0, io.EOF
+	}
+	if bmpReader.buffer == nil {
+		bmpReader.buffer = make([]byte, bmpReader.rowSize())
+	}
+	if _, err := io.ReadFull(bmpReader.reader, bmpReader.buffer); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+
+	y := bmpReader.Height - 1 - bmpReader.rowsRead
+	if bmpReader.topDown {
+		y = bmpReader.rowsRead
+	}
+	bmpReader.rowsRead++
+
+	switch bmpReader.bitsPerPixel {
+	case 8:
+		for x := 0; x < bmpReader.Width; x++ {
+			pixelColor := bmpReader.palette[bmpReader.buffer[x]].(color.RGBA)
+			row[4*x+0], row[4*x+1], row[4*x+2], row[4*x+3] = pixelColor.R, pixelColor.G, pixelColor.B, pixelColor.A
+		}
+	case 24:
+		for i, j := 0, 0; i < 4*bmpReader.Width; i, j = i+4, j+3 {
+			row[i+0], row[i+1], row[i+2], row[i+3] = bmpReader.buffer[j+2], bmpReader.buffer[j+1], bmpReader.buffer[j+0], 0xFF
+		}
+	case 32:
+		for i := 0; i < 4*bmpReader.Width; i += 4 {
+			row[i+0], row[i+1], row[i+2], row[i+3] = bmpReader.buffer[i+2], bmpReader.buffer[i+1], bmpReader.buffer[i+0], bmpReader.buffer[i+3]
+		}
+	}
+
+	return y, nil
+}
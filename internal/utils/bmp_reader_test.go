@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBMPReader_ReadRow(t *testing.T) {
+	testImage, err := ioutil.ReadFile("testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	translucentImage := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 3; y++ {
+			translucentImage.SetNRGBA(x, y, color.NRGBA{R: uint8(40 * x), G: uint8(80 * y), B: 200, A: uint8(50 * x)})
+		}
+	}
+	translucentBuffer := bytes.NewBuffer(nil)
+	assert.NoError(t, bmp.Encode(translucentBuffer, translucentImage))
+
+	palettedImage := image.NewPaletted(image.Rect(0, 0, 7, 2), color.Palette{color.Black, color.White})
+	palettedImage.SetColorIndex(3, 1, 1)
+	palettedBuffer := bytes.NewBuffer(nil)
+	assert.NoError(t, bmp.Encode(palettedBuffer, palettedImage))
+
+	tests := []struct {
+		testName string
+		data     []byte
+	}{
+		{
+			testName: "24 bits per pixel",
+			data:     testImage,
+		},
+		{
+			testName: "32 bits per pixel",
+			data:     translucentBuffer.Bytes(),
+		},
+		{
+			testName: "8 bits per pixel",
+			data:     palettedBuffer.Bytes(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			expectedImage, err := bmp.Decode(bytes.NewReader(test.data))
+			assert.NoError(t, err)
+
+			bmpReader, err := NewBMPReader(bytes.NewReader(test.data))
+			assert.NoError(t, err)
+			assert.Equal(t, expectedImage.Bounds().Dx(), bmpReader.Width)
+			assert.Equal(t, expectedImage.Bounds().Dy(), bmpReader.Height)
+
+			row := make([]byte, 4*bmpReader.Width)
+			rowsCount := 0
+			for {
+				y, err := bmpReader.ReadRow(row)
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+				for x := 0; x < bmpReader.Width; x++ {
+					expectedColor := color.NRGBAModel.Convert(expectedImage.At(x, y)).(color.NRGBA)
+					assert.Equal(t, expectedColor, color.NRGBA{R: row[4*x], G: row[4*x+1], B: row[4*x+2], A: row[4*x+3]})
+				}
+				rowsCount++
+			}
+			assert.Equal(t, bmpReader.Height, rowsCount)
+		})
+	}
+}
+
+func TestBMPReader_Truncated(t *testing.T) {
+	testImage, err := ioutil.ReadFile("testData/common/testImage.bmp")
+	assert.NoError(t, err)
+
+	_, err = NewBMPReader(bytes.NewReader(testImage[:10]))
+	assert.Error(t, err)
+
+	bmpReader, err := NewBMPReader(bytes.NewReader(testImage[:len(testImage)/2]))
+	assert.NoError(t, err)
+	row := make([]byte, 4*bmpReader.Width)
+	for err == nil {
+		_, err = bmpReader.ReadRow(row)
+	}
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestBMPReader_Spool(t *testing.T) {
+	testImage, err := ioutil.ReadFile("testData/common/testImage.bmp")
+	assert.NoError(t, err)
+	expectedImage, err := bmp.Decode(bytes.NewReader(testImage))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		testName  string
+		maxMemory int64
+	}{
+		{
+			testName:  "In memory",
+			maxMemory: int64(len(testImage)),
+		},
+		{
+			testName:  "In a file",
+			maxMemory: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			source := bytes.NewReader(testImage)
+			bmpReader, err := NewBMPReader(source)
+			assert.NoError(t, err)
+			assert.NoError(t, bmpReader.Spool(test.maxMemory))
+			assert.Equal(t, 0, source.Len())
+			spool := bmpReader.spool
+
+			row := make([]byte, 4*bmpReader.Width)
+			for {
+				y, err := bmpReader.ReadRow(row)
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+				for x := 0; x < bmpReader.Width; x++ {
+					expectedColor := color.NRGBAModel.Convert(expectedImage.At(x, y)).(color.NRGBA)
+					assert.Equal(t, expectedColor, color.NRGBA{R: row[4*x], G: row[4*x+1], B: row[4*x+2], A: row[4*x+3]})
+				}
+			}
+			assert.NoError(t, bmpReader.Close())
+			if spool != nil {
+				assert.NoFileExists(t, spool.Name())
+			}
+
+			bmpReader, err = NewBMPReader(bytes.NewReader(testImage[:len(testImage)/2]))
+			assert.NoError(t, err)
+			assert.Equal(t, io.ErrUnexpectedEOF, bmpReader.Spool(test.maxMemory))
+			assert.NoError(t, bmpReader.Close())
+		})
+	}
+}
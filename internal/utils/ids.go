@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	uuidPattern    = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	integerPattern = regexp.MustCompile(`^(0|[1-9][0-9]{0,17})$`)
+)
+
+// NewUUIDv7 returns a random UUID version 7. Its first 48 bits are the unix
+// time in milliseconds, so ids created later sort after earlier ones.
+func NewUUIDv7() (string, error) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[6:]); err != nil {
+		return "", err
+	}
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(uuid[:6], timestamp[2:])
+	uuid[6] = 0x70 | uuid[6]&0x0F
+	uuid[8] = 0x80 | uuid[8]&0x3F
+
+	text := hex.EncodeToString(uuid[:])
+	return text[:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:], nil
+}
+
+// IsValidID tells whether id is a canvas id: a lowercase UUID or, for
+// canvases created before ids became UUIDs, a non-negative integer without
+// leading zeros.
+func IsValidID(id string) bool {
+	return uuidPattern.MatchString(id) || IsIntegerID(id)
+}
+
+// IsIntegerID tells whether id is an integer id of the compatibility mode.
+func IsIntegerID(id string) bool {
+	return integerPattern.MatchString(id)
+}
+
+// LessID orders ids by creation: integer ids numerically and before UUIDs,
+// UUIDs by their timestamp.
+func LessID(firstID, secondID string) bool {
+	firstInteger, secondInteger := IsIntegerID(firstID), IsIntegerID(secondID)
+	if firstInteger != secondInteger {
+		return firstInteger
+	}
+	if firstInteger {
+		firstNumber, _ := strconv.ParseInt(firstID, 10, 64)
+		secondNumber, _ := strconv.ParseInt(secondID, 10, 64)
+		return firstNumber < secondNumber
+	}
+
+	return firstID < secondID
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewUUIDv7(t *testing.T) {
+	firstID, err := NewUUIDv7()
+	assert.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	secondID, err := NewUUIDv7()
+	assert.NoError(t, err)
+
+	for _, id := range []string{firstID, secondID} {
+		assert.True(t, IsValidID(id))
+		assert.False(t, IsIntegerID(id))
+		assert.Equal(t, byte('7'), id[14])
+		assert.Contains(t, "89ab", string(id[19]))
+	}
+	assert.NotEqual(t, firstID, secondID)
+	assert.True(t, LessID(firstID, secondID))
+}
+
+func TestIsValidID(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"0":                                    true,
+		"42":                                   true,
+		"0190c6a4-3b1e-7c2d-8e4f-5a6b7c8d9e0f": true,
+		"":                                     false,
+		"-1":                                   false,
+		"007":                                  false,
+		"0190C6A4-3B1E-7C2D-8E4F-5A6B7C8D9E0F": false,
+		"0190c6a4-3b1e-7c2d-8e4f-5a6b7c8d9e0":  false,
+		"../0":                                 false,
+	} {
+		assert.Equal(t, valid, IsValidID(id), id)
+	}
+}
+
+func TestLessID(t *testing.T) {
+	ids := []string{"0190c6a4-3b1e-7c2d-8e4f-5a6b7c8d9e0f", "10", "0190c6a4-3b1d-7c2d-8e4f-5a6b7c8d9e0f", "2"}
+	sort.Slice(ids, func(i, j int) bool {
+		return LessID(ids[i], ids[j])
+	})
+
+	assert.Equal(t, []string{"2", "10", "0190c6a4-3b1d-7c2d-8e4f-5a6b7c8d9e0f", "0190c6a4-3b1e-7c2d-8e4f-5a6b7c8d9e0f"}, ids)
+}
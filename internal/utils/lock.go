@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// LockFileName is the file in the folder held by LockFolder.
+const LockFileName = ".lock"
+
+// ErrLocked is returned by LockFolder when another process holds the lock.
+var ErrLocked = errors.New("folder is locked by another process")
+
+// LockFolder takes an exclusive lock on the folder, so only one process
+// works on it at a time. The lock is released by closing the returned file
+// or when the process exits, even if it crashes.
+func LockFolder(path string) (*os.File, error) {
+	return lockFile(filepath.Join(path, LockFileName))
+}
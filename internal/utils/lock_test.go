@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLockFolder(t *testing.T) {
+	folder := t.TempDir()
+	lock, err := LockFolder(folder)
+	assert.NoError(t, err)
+
+	_, err = LockFolder(folder)
+	assert.Equal(t, ErrLocked, err)
+
+	assert.NoError(t, lock.Close())
+	lock, err = LockFolder(folder)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Close())
+}
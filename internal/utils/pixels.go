@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+)
+
+// CopyToRGBA sets the pixels of dst inside dstRect to the pixels of src
+// starting at srcPoint, exactly as dst.Set(x, y, src.At(x, y)) would.
+// *image.RGBA, *image.NRGBA and *image.Paletted sources are copied row by
+// row straight from their Pix buffers; other images fall back to Set/At.
+// dstRect must lie inside dst and the matching rectangle inside src.
+func CopyToRGBA(dst *image.RGBA, dstRect image.Rectangle, src image.Image, srcPoint image.Point) {
+	if dstRect.Empty() {
+		return
+	}
+	rowLength := 4 * dstRect.Dx()
+
+	switch src := src.(type) {
+	case *image.RGBA:
+		for y := 0; y < dstRect.Dy(); y++ {
+			dstOffset := dst.PixOffset(dstRect.Min.X, dstRect.Min.Y+y)
+			srcOffset := src.PixOffset(srcPoint.X, srcPoint.Y+y)
+			copy(dst.Pix[dstOffset:dstOffset+rowLength], src.Pix[srcOffset:srcOffset+rowLength])
+		}
+	case *image.NRGBA:
+		for y := 0; y < dstRect.Dy(); y++ {
+			dstOffset := dst.PixOffset(dstRect.Min.X, dstRect.Min.Y+y)
+			srcOffset := src.PixOffset(srcPoint.X, srcPoint.Y+y)
+			PremultiplyRow(dst.Pix[dstOffset:dstOffset+rowLength], src.Pix[srcOffset:srcOffset+rowLength])
+		}
+	case *image.Paletted:
+		palette := make([]color.RGBA, len(src.Palette))
+		for ind, paletteColor := range src.Palette {
+			palette[ind] = color.RGBAModel.Convert(paletteColor).(color.RGBA)
+		}
+		for y := 0; y < dstRect.Dy(); y++ {
+			dstOffset := dst.PixOffset(dstRect.Min.X, dstRect.Min.Y+y)
+			srcOffset := src.PixOffset(srcPoint.X, srcPoint.Y+y)
+			for x := 0; x < dstRect.Dx(); x++ {
+				pixelColor := palette[src.Pix[srcOffset+x]]
+				dst.Pix[dstOffset+4*x+0] = pixelColor.R
+				dst.Pix[dstOffset+4*x+1] = pixelColor.G
+				dst.Pix[dstOffset+4*x+2] = pixelColor.B
+				dst.Pix[dstOffset+4*x+3] = pixelColor.A
+			}
+		}
+	default:
+		for y := 0; y < dstRect.Dy(); y++ {
+			for x := 0; x < dstRect.Dx(); x++ {
+				dst.Set(dstRect.Min.X+x, dstRect.Min.Y+y, src.At(srcPoint.X+x, srcPoint.Y+y))
+			}
+		}
+	}
+}
+
+// PremultiplyRow converts the non-premultiplied RGBA pixels of src into
+// premultiplied ones in dst, rounding the same way color.RGBAModel does.
+func PremultiplyRow(dst, src []byte) {
+	for i := 0; i+3 < len(src); i += 4 {
+		alpha := uint32(src[i+3])
+		if alpha == 0xFF {
+			copy(dst[i:i+4], src[i:i+4])
+			continue
+		}
+		dst[i+0] = uint8(uint32(src[i+0]) * 0x101 * alpha / 0xFF >> 8)
+		dst[i+1] = uint8(uint32(src[i+1]) * 0x101 * alpha / 0xFF >> 8)
+		dst[i+2] = uint8(uint32(src[i+2]) * 0x101 * alpha / 0xFF >> 8)
+		dst[i+3] = src[i+3]
+	}
+}
+
+// FillRGBA sets every pixel of dst inside rect to pixelColor.
+func FillRGBA(dst *image.RGBA, rect image.Rectangle, pixelColor color.RGBA) {
+	if rect.Empty() {
+		return
+	}
+	rowLength := 4 * rect.Dx()
+
+	firstOffset := dst.PixOffset(rect.Min.X, rect.Min.Y)
+	firstRow := dst.Pix[firstOffset : firstOffset+rowLength]
+	for i := 0; i < rowLength; i += 4 {
+		firstRow[i+0], firstRow[i+1], firstRow[i+2], firstRow[i+3] = pixelColor.R, pixelColor.G, pixelColor.B, pixelColor.A
+	}
+	for y := rect.Min.Y + 1; y < rect.Max.Y; y++ {
+		offset := dst.PixOffset(rect.Min.X, y)
+		copy(dst.Pix[offset:offset+rowLength], firstRow)
+	}
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func randomImages(width, height int) map[string]image.Image {
+	random := rand.New(rand.NewSource(1))
+	rgbaImage := image.NewRGBA(image.Rect(0, 0, width, height))
+	nrgbaImage := image.NewNRGBA(image.Rect(0, 0, width, height))
+	grayImage := image.NewGray(image.Rect(0, 0, width, height))
+	palette := make(color.Palette, 256)
+	for ind := range palette {
+		palette[ind] = color.RGBA{R: uint8(ind), G: uint8(255 - ind), B: uint8(ind / 2), A: 0xFF}
+	}
+	palettedImage := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+
+	random.Read(nrgbaImage.Pix)
+	random.Read(grayImage.Pix)
+	random.Read(palettedImage.Pix)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			rgbaImage.Set(x, y, nrgbaImage.At(x, y))
+		}
+	}
+
+	return map[string]image.Image{
+		"RGBA":     rgbaImage,
+		"NRGBA":    nrgbaImage,
+		"Paletted": palettedImage,
+		"Gray":     grayImage,
+	}
+}
+
+func TestCopyToRGBA(t *testing.T) {
+	tests := []struct {
+		testName string
+		dstRect  image.Rectangle
+		srcPoint image.Point
+	}{
+		{
+			testName: "Whole image",
+			dstRect:  image.Rect(0, 0, 64, 48),
+			srcPoint: image.Pt(0, 0),
+		},
+		{
+			testName: "Shifted rectangle",
+			dstRect:  image.Rect(10, 5, 40, 30),
+			srcPoint: image.Pt(20, 13),
+		},
+		{
+			testName: "Single pixel",
+			dstRect:  image.Rect(63, 47, 64, 48),
+			srcPoint: image.Pt(0, 0),
+		},
+		{
+			testName: "Empty rectangle",
+			dstRect:  image.Rect(10, 10, 10, 20),
+			srcPoint: image.Pt(0, 0),
+		},
+	}
+
+	for srcType, src := range randomImages(64, 48) {
+		for _, test := range tests {
+			t.Run(srcType+"/"+test.testName, func(t *testing.T) {
+				expectedImage := image.NewRGBA(image.Rect(0, 0, 64, 48))
+				for y := 0; y < test.dstRect.Dy(); y++ {
+					for x := 0; x < test.dstRect.Dx(); x++ {
+						expectedImage.Set(test.dstRect.Min.X+x, test.dstRect.Min.Y+y, src.At(test.srcPoint.X+x, test.srcPoint.Y+y))
+					}
+				}
+
+				actualImage := image.NewRGBA(image.Rect(0, 0, 64, 48))
+				CopyToRGBA(actualImage, test.dstRect, src, test.srcPoint)
+
+				assert.Equal(t, expectedImage.Pix, actualImage.Pix)
+			})
+		}
+	}
+}
+
+func TestFillRGBA(t *testing.T) {
+	pixelColor := color.RGBA{R: 1, G: 2, B: 3, A: 0xFF}
+	rect := image.Rect(3, 2, 9, 7)
+
+	expectedImage := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			expectedImage.Set(x, y, pixelColor)
+		}
+	}
+
+	actualImage := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	FillRGBA(actualImage, rect, pixelColor)
+
+	assert.Equal(t, expectedImage.Pix, actualImage.Pix)
+}
+
+func BenchmarkCopyToRGBA(b *testing.B) {
+	images := randomImages(5000, 5000)
+	for _, srcType := range []string{"RGBA", "NRGBA", "Paletted", "Gray"} {
+		src := images[srcType]
+		b.Run(srcType, func(b *testing.B) {
+			dst := image.NewRGBA(src.Bounds())
+			b.SetBytes(int64(len(dst.Pix)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				CopyToRGBA(dst, dst.Bounds(), src, image.Point{})
+			}
+		})
+	}
+}
+
+func BenchmarkSetAt(b *testing.B) {
+	images := randomImages(5000, 5000)
+	for _, srcType := range []string{"RGBA", "NRGBA", "Paletted", "Gray"} {
+		src := images[srcType]
+		b.Run(srcType, func(b *testing.B) {
+			dst := image.NewRGBA(src.Bounds())
+			b.SetBytes(int64(len(dst.Pix)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for y := 0; y < 5000; y++ {
+					for x := 0; x < 5000; x++ {
+						dst.Set(x, y, src.At(x, y))
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,21 +1,60 @@
 package utils
 
 import (
-	"golang.org/x/image/bmp"
-	"image"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 )
 
-func WriteInFile(file *os.File, image image.Image) error {
-	err := bmp.Encode(file, image)
+// TempFileSuffix ends the names of files written by WriteFileAtomic that
+// have not been renamed into place yet.
+const TempFileSuffix = ".tmp"
+
+// WriteFileAtomic lets write fill a temporary file next to path, syncs it
+// and renames it over path, so path holds either the old or the new
+// content even if the process dies or the disk fills up midway.
+func WriteFileAtomic(path string, write func(writer io.Writer) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*"+TempFileSuffix)
 	if err != nil {
 		return err
 	}
-	if err = file.Close(); err != nil {
+	if err = file.Chmod(0644); err == nil {
+		if err = write(file); err == nil {
+			err = file.Sync()
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
 		return err
 	}
 
-	return nil
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes a rename in the directory durable. Windows can not sync
+// directories and makes renames durable by itself.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+
+	return dir.Close()
 }
 
 func Abs(number int) int {
@@ -31,3 +70,10 @@ func Min(firstNumber, secondNumber int) int {
 	}
 	return secondNumber
 }
+
+func Max(firstNumber, secondNumber int) int {
+	if firstNumber > secondNumber {
+		return firstNumber
+	}
+	return secondNumber
+}
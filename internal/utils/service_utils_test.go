@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encodeBMP(img image.Image) func(writer io.Writer) error {
+	return func(writer io.Writer) error {
+		return bmp.Encode(writer, img)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	folder := t.TempDir()
+	path := filepath.Join(folder, "0.bmp")
+
+	assert.NoError(t, WriteFileAtomic(path, encodeBMP(image.NewRGBA(image.Rect(0, 0, 2, 3)))))
+	assert.NoError(t, WriteFileAtomic(path, encodeBMP(image.NewRGBA(image.Rect(0, 0, 4, 5)))))
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	config, err := bmp.DecodeConfig(file)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	assert.Equal(t, 4, config.Width)
+	assert.Equal(t, 5, config.Height)
+
+	files, err := ioutil.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestWriteFileAtomic_Failed(t *testing.T) {
+	folder := t.TempDir()
+	path := filepath.Join(folder, "0.bmp")
+	assert.NoError(t, WriteFileAtomic(path, encodeBMP(image.NewRGBA(image.Rect(0, 0, 2, 3)))))
+	before, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	brokenImage := &image.RGBA{Rect: image.Rectangle{Min: image.Pt(1, 1)}}
+	assert.Error(t, WriteFileAtomic(path, encodeBMP(brokenImage)))
+
+	after, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+	files, err := ioutil.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
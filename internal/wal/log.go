@@ -0,0 +1,190 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"math"
+	"os"
+)
+
+// Record is a rectangle of canvas pixels after a write. Records hold
+// absolute pixel values, so replaying one more than once is harmless.
+type Record struct {
+	Rect image.Rectangle
+	Pix  []byte
+}
+
+// NewRecord copies the pixels of rect from img.
+func NewRecord(img *image.RGBA, rect image.Rectangle) Record {
+	rect = rect.Intersect(img.Bounds())
+	rowLength := 4 * rect.Dx()
+	record := Record{Rect: rect, Pix: make([]byte, rowLength*rect.Dy())}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		offset := img.PixOffset(rect.Min.X, y)
+		copy(record.Pix[(y-rect.Min.Y)*rowLength:], img.Pix[offset:offset+rowLength])
+	}
+
+	return record
+}
+
+// Apply writes the pixels of the record into img.
+func (record Record) Apply(img *image.RGBA) {
+	rect := record.Rect.Intersect(img.Bounds())
+	rowLength := 4 * record.Rect.Dx()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		srcOffset := (y-record.Rect.Min.Y)*rowLength + 4*(rect.Min.X-record.Rect.Min.X)
+		dstOffset := img.PixOffset(rect.Min.X, y)
+		copy(img.Pix[dstOffset:dstOffset+4*rect.Dx()], record.Pix[srcOffset:])
+	}
+}
+
+// Append durably writes records to the log at path as one frame, so they
+// are either all replayed or none of them are. A failed append is cut off
+// the log to keep later frames readable.
+func Append(path string, records []Record) error {
+	payload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(payload, uint32(len(records)))
+	for _, record := range records {
+		if len(record.Pix) != 4*record.Rect.Dx()*record.Rect.Dy() {
+			return errors.New("wal: record pixels do not match its rectangle")
+		}
+		header := make([]byte, 16)
+		binary.LittleEndian.PutUint32(header[0:], uint32(int32(record.Rect.Min.X)))
+		binary.LittleEndian.PutUint32(header[4:], uint32(int32(record.Rect.Min.Y)))
+		binary.LittleEndian.PutUint32(header[8:], uint32(int32(record.Rect.Max.X)))
+		binary.LittleEndian.PutUint32(header[12:], uint32(int32(record.Rect.Max.Y)))
+		payload = append(payload, header...)
+		payload = append(payload, record.Pix...)
+	}
+	if int64(len(payload)) > math.MaxUint32 {
+		return errors.New("wal: frame too large")
+	}
+	frame := make([]byte, 4, len(payload)+8)
+	binary.LittleEndian.PutUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = append(frame, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(frame[len(frame)-4:], crc32.ChecksumIEEE(payload))
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err = file.Write(frame); err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Truncate(size)
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Replay calls apply for every record of the log at path in the order
+// they were appended. A missing log has no records. A torn frame at the
+// end, left by a crash in the middle of Append, was never acknowledged
+// and is skipped. Any other damage fails with ErrCorrupt, as the frames
+// after it were acknowledged and would be lost.
+func Replay(path string, apply func(record Record)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	for offset := int64(0); offset < info.Size(); {
+		records, frameLength, err := readFrame(reader, info.Size()-offset)
+		if err == errTornFrame {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s at offset %d: %s", ErrCorrupt, path, offset, err)
+		}
+		for _, record := range records {
+			apply(record)
+		}
+		offset += frameLength
+	}
+
+	return nil
+}
+
+// ErrCorrupt is returned by Replay for a log damaged before its end.
+var ErrCorrupt = errors.New("wal: corrupt log")
+
+var errTornFrame = errors.New("wal: torn frame")
+
+// readFrame reads the next frame of the remaining bytes of the log and
+// returns its records and length. A frame reaching past the end of the
+// log, or one failing its checksum that ends the log, is torn.
+func readFrame(reader io.Reader, remaining int64) ([]Record, int64, error) {
+	lengthBuffer := make([]byte, 4)
+	if _, err := io.ReadFull(reader, lengthBuffer); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, errTornFrame
+		}
+		return nil, 0, err
+	}
+	payloadLength := int64(binary.LittleEndian.Uint32(lengthBuffer))
+	frameLength := payloadLength + 8
+	if frameLength > remaining {
+		return nil, 0, errTornFrame
+	}
+	if payloadLength < 4 {
+		return nil, 0, errors.New("frame too short")
+	}
+	payload := make([]byte, frameLength-4)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, err
+	}
+	checksum := binary.LittleEndian.Uint32(payload[payloadLength:])
+	payload = payload[:payloadLength]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		if frameLength == remaining {
+			return nil, 0, errTornFrame
+		}
+		return nil, 0, errors.New("checksum mismatch")
+	}
+
+	count := binary.LittleEndian.Uint32(payload)
+	payload = payload[4:]
+	records := make([]Record, 0)
+	for ind := uint32(0); ind < count; ind++ {
+		if len(payload) < 16 {
+			return nil, 0, errors.New("record header cut off")
+		}
+		rect := image.Rect(
+			int(int32(binary.LittleEndian.Uint32(payload[0:]))),
+			int(int32(binary.LittleEndian.Uint32(payload[4:]))),
+			int(int32(binary.LittleEndian.Uint32(payload[8:]))),
+			int(int32(binary.LittleEndian.Uint32(payload[12:]))))
+		payload = payload[16:]
+		pixLength := 4 * int64(rect.Dx()) * int64(rect.Dy())
+		if int64(len(payload)) < pixLength {
+			return nil, 0, errors.New("record pixels cut off")
+		}
+		records = append(records, Record{Rect: rect, Pix: payload[:pixLength]})
+		payload = payload[pixLength:]
+	}
+
+	return records, frameLength, nil
+}
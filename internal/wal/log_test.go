@@ -0,0 +1,131 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecord_Apply(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	src.SetRGBA(3, 4, color.RGBA{R: 1, G: 2, B: 3, A: 4})
+	record := NewRecord(src, image.Rect(2, 2, 12, 6))
+	assert.Equal(t, image.Rect(2, 2, 8, 6), record.Rect)
+
+	dst := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	record.Apply(dst)
+	assert.Equal(t, src.Pix, dst.Pix)
+}
+
+func TestAppendReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0.wal")
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+
+	img.SetRGBA(0, 0, color.RGBA{R: 1, A: 1})
+	first := NewRecord(img, image.Rect(0, 0, 2, 2))
+	assert.NoError(t, Append(path, []Record{first}))
+	img.SetRGBA(0, 0, color.RGBA{R: 2, A: 2})
+	img.SetRGBA(3, 3, color.RGBA{B: 2, A: 2})
+	second := []Record{NewRecord(img, image.Rect(0, 0, 1, 1)), NewRecord(img, image.Rect(3, 3, 4, 4))}
+	assert.NoError(t, Append(path, second))
+
+	replayed := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	count := 0
+	err := Replay(path, func(record Record) {
+		record.Apply(replayed)
+		count++
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, img.Pix, replayed.Pix)
+}
+
+func TestReplay_Missing(t *testing.T) {
+	err := Replay(filepath.Join(t.TempDir(), "0.wal"), func(record Record) {
+		t.Fatal("record replayed from a missing log")
+	})
+	assert.NoError(t, err)
+}
+
+func TestReplay_TornFrame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0.wal")
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	assert.NoError(t, Append(path, []Record{NewRecord(img, img.Bounds())}))
+	assert.NoError(t, Append(path, []Record{NewRecord(img, img.Bounds())}))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-3))
+
+	count := 0
+	err = Replay(path, func(record Record) {
+		count++
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestReplay_CorruptFrame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0.wal")
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	assert.NoError(t, Append(path, []Record{NewRecord(img, img.Bounds())}))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	data[10] ^= 0xFF
+	assert.NoError(t, ioutil.WriteFile(path, data, 0777))
+
+	err = Replay(path, func(record Record) {
+		t.Fatal("corrupt record replayed")
+	})
+	assert.NoError(t, err)
+}
+
+func TestReplay_CorruptFrameBeforeEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0.wal")
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	assert.NoError(t, Append(path, []Record{NewRecord(img, img.Bounds())}))
+	assert.NoError(t, Append(path, []Record{NewRecord(img, img.Bounds())}))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	data[10] ^= 0xFF
+	assert.NoError(t, ioutil.WriteFile(path, data, 0777))
+
+	err = Replay(path, func(record Record) {
+		t.Fatal("corrupt record replayed")
+	})
+	assert.True(t, errors.Is(err, ErrCorrupt))
+}
+
+func TestReplay_CorruptLength(t *testing.T) {
+	for _, length := range []uint32{0, 3, 0xFFFFFFFC, 0xFFFFFFFF} {
+		path := filepath.Join(t.TempDir(), "0.wal")
+		img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		assert.NoError(t, Append(path, []Record{NewRecord(img, img.Bounds())}))
+		assert.NoError(t, Append(path, []Record{NewRecord(img, img.Bounds())}))
+
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		binary.LittleEndian.PutUint32(data, length)
+		assert.NoError(t, ioutil.WriteFile(path, data, 0777))
+
+		count := 0
+		err = Replay(path, func(record Record) {
+			count++
+		})
+		if length > 3 {
+			// A frame reaching past the end of the log is taken as torn.
+			assert.NoError(t, err)
+		} else {
+			assert.True(t, errors.Is(err, ErrCorrupt))
+		}
+		assert.Equal(t, 0, count)
+	}
+}
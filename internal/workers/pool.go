@@ -0,0 +1,94 @@
+package workers
+
+import (
+	"github.com/pmokeev/chartographer/internal/metrics"
+	"github.com/pmokeev/chartographer/internal/utils"
+	"runtime"
+	"sync"
+)
+
+// Pool is a fixed set of goroutines shared by every request. Pixel loops
+// are split into row bands and handed to the workers, and Acquire/Release
+// bound the number of heavy jobs running at once, so extra requests wait
+// in line instead of competing for the CPU.
+type Pool struct {
+	tasks        chan func()
+	jobs         chan struct{}
+	workersCount int
+	closeOnce    sync.Once
+}
+
+// NewPool starts workersCount workers and admits maxConcurrentJobs jobs at
+// once. Non-positive values default to GOMAXPROCS and workersCount.
+func NewPool(workersCount, maxConcurrentJobs int) *Pool {
+	if workersCount <= 0 {
+		workersCount = runtime.GOMAXPROCS(0)
+	}
+	if maxConcurrentJobs <= 0 {
+		maxConcurrentJobs = workersCount
+	}
+
+	pool := &Pool{
+		tasks:        make(chan func()),
+		jobs:         make(chan struct{}, maxConcurrentJobs),
+		workersCount: workersCount}
+	for i := 0; i < workersCount; i++ {
+		go pool.work()
+	}
+
+	return pool
+}
+
+func (pool *Pool) work() {
+	for task := range pool.tasks {
+		metrics.WorkersBusy.Inc()
+		task()
+		metrics.WorkersBusy.Dec()
+	}
+}
+
+// Acquire blocks until the pool admits one more job.
+func (pool *Pool) Acquire() {
+	pool.jobs <- struct{}{}
+}
+
+func (pool *Pool) Release() {
+	<-pool.jobs
+}
+
+// RunRows splits rows [0, height) into contiguous bands, one per worker,
+// calls process for every band on the workers and waits for all of them.
+// Bands follow the row-major layout of image buffers.
+func (pool *Pool) RunRows(height int, process func(minY, maxY int)) {
+	if height <= 0 {
+		return
+	}
+	bandsCount := utils.Min(pool.workersCount, height)
+	if bandsCount == 1 {
+		process(0, height)
+		return
+	}
+	bandSize := (height + bandsCount - 1) / bandsCount
+
+	var wg sync.WaitGroup
+	for minY := 0; minY < height; minY += bandSize {
+		wg.Add(1)
+
+		maxY := utils.Min(minY+bandSize, height)
+		band := func(minY, maxY int) func() {
+			return func() {
+				defer wg.Done()
+				process(minY, maxY)
+			}
+		}(minY, maxY)
+		pool.tasks <- band
+	}
+	wg.Wait()
+}
+
+// Close stops the workers. The pool must not be used afterwards.
+func (pool *Pool) Close() {
+	pool.closeOnce.Do(func() {
+		close(pool.tasks)
+	})
+}
@@ -0,0 +1,97 @@
+package workers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_RunRows(t *testing.T) {
+	tests := []struct {
+		testName     string
+		workersCount int
+		height       int
+	}{
+		{
+			testName:     "Zero height",
+			workersCount: 4,
+			height:       0,
+		},
+		{
+			testName:     "Single row",
+			workersCount: 4,
+			height:       1,
+		},
+		{
+			testName:     "Less rows than workers",
+			workersCount: 4,
+			height:       3,
+		},
+		{
+			testName:     "Rows not divisible by workers",
+			workersCount: 4,
+			height:       426,
+		},
+		{
+			testName:     "Single worker",
+			workersCount: 1,
+			height:       100,
+		},
+		{
+			testName:     "Default workers",
+			workersCount: 0,
+			height:       1000,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			pool := NewPool(test.workersCount, 0)
+			defer pool.Close()
+
+			rows := make([]int32, test.height)
+			pool.RunRows(test.height, func(minY, maxY int) {
+				for y := minY; y < maxY; y++ {
+					atomic.AddInt32(&rows[y], 1)
+				}
+			})
+
+			for y := range rows {
+				assert.Equal(t, int32(1), rows[y])
+			}
+		})
+	}
+}
+
+func TestPool_Acquire(t *testing.T) {
+	pool := NewPool(2, 3)
+	defer pool.Close()
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			pool.Acquire()
+			defer pool.Release()
+
+			current := atomic.AddInt32(&running, 1)
+			for {
+				observed := atomic.LoadInt32(&maxRunning)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			pool.RunRows(10, func(minY, maxY int) {})
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, maxRunning <= 3)
+}